@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const USAGE_ADOPT = "Usage:\n\trun -adopt\n\nRegisters the scripts of the script folder which are not in the index under\ntheir file name without extension. To do so whenever such a script is run:\n\trun -config autoAdopt true\n"
+
+// AdoptCmd registers the unregistered scripts of the script folder with
+// default options. Scripts whose name is taken are skipped.
+func AdoptCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf(tr(USAGE_ADOPT))
+	}
+	scripts, names, err := unregisteredScripts(scriptDp, indexFp)
+	if err != nil {
+		return err
+	}
+
+	var adopted int
+	for _, fp := range scripts {
+		name := scriptName(fp)
+		if err := checkName(name); err != nil {
+			fmt.Printf(tr("Not adopting %s: %s"), fp, err)
+			continue
+		}
+		if names[name] {
+			fmt.Printf(tr("Not adopting %s, there already is a command named %q.\n"), fp, name)
+			continue
+		}
+		if err := adopt(indexFp, name, fp); err != nil {
+			return err
+		}
+		names[name] = true
+		adopted++
+	}
+	fmt.Printf(tr("Adopted %d script(s).\n"), adopted)
+	return nil
+}
+
+// unregisteredScripts returns the scripts of the script folder, sorted, which
+// no command refers to, and the names of all commands. Hidden and ignored
+// files are skipped.
+func unregisteredScripts(scriptDp, indexFp string) ([]string, map[string]bool, error) {
+	names := make(map[string]bool)
+	registered := make(map[string]bool)
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		names[cmd.Name] = true
+		registered[filepath.Clean(cmd.Script)] = true
+		for _, script := range cmd.Meta.ScriptOverrides {
+			registered[filepath.Clean(script)] = true
+		}
+		for _, script := range cmd.Meta.Candidates {
+			registered[filepath.Clean(script)] = true
+		}
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := os.ReadDir(scriptDp)
+	if err != nil {
+		return nil, nil, err
+	}
+	ignore, err := loadIgnore(scriptDp)
+	if err != nil {
+		return nil, nil, err
+	}
+	var scripts []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || ignore.Ignored(entry.Name(), false) {
+			continue
+		}
+		fp := filepath.Join(scriptDp, entry.Name())
+		if !registered[fp] {
+			scripts = append(scripts, fp)
+		}
+	}
+	sort.Strings(scripts)
+	return scripts, names, nil
+}
+
+// scriptName is the command name of a script, its file name without extension.
+func scriptName(fp string) string {
+	base := filepath.Base(fp)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// adopt registers the script fp as name with default options.
+func adopt(indexFp, name, fp string) error {
+	cmd := jsonCmd{Name: name, Script: fp, Meta: meta{MaxNumArgs: -1}}
+	if err := insertIntoIndex(indexFp, &cmd); err != nil {
+		return err
+	}
+	fmt.Printf(tr("Registered %s with %s\n"), name, fp)
+	return nil
+}
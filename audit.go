@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const AUDIT_FILE string = "audit.log"
+
+// auditEntry is a line of ~/.run/audit.log.
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`               // the user executing run
+	RealUser string    `json:"realUser,omitempty"` // the user behind sudo & co.
+	Command  string    `json:"command"`
+	Args     []string  `json:"args,omitempty"`
+}
+
+func auditFp(scriptDp string) string {
+	return filepath.Join(baseDir(scriptDp), AUDIT_FILE)
+}
+
+// audit appends the invocation of an internal command to the audit log. The
+// file is only ever appended to, so it can be protected with chattr +a.
+func audit(scriptDp, command string, args []string) (err error) {
+	entry := auditEntry{Time: time.Now(), Command: command, Args: args}
+	if usr, err := user.Current(); err == nil {
+		entry.User = usr.Username
+	}
+	if usr, env, err := realUser(); err == nil && usr != nil && usr.Username != entry.User {
+		entry.RealUser = fmt.Sprintf("%s (via $%s)", usr.Username, env)
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(auditFp(scriptDp), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer closeFile(file, &err)
+	_, err = file.Write(append(raw, '\n'))
+	return err
+}
+
+/******************************************************************************/
+
+const USAGE_AUDIT = "Usage:\n\trun -audit [-n <count>]\n"
+
+// AuditCmd prints the latest changes to the registry and who made them.
+func AuditCmd(scriptDp string, args []string) error {
+	fs := newFlagSet("-audit")
+	n := fs.Int("n", 50, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_AUDIT))
+	}
+
+	file, err := os.Open(auditFp(scriptDp))
+	if os.IsNotExist(err) {
+		fmt.Println("The registry has not been changed yet.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var latest []auditEntry
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			continue
+		}
+		latest = append(latest, entry)
+		if len(latest) > *n {
+			latest = latest[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range latest {
+		who := e.User
+		if e.RealUser != "" {
+			who += " for " + e.RealUser
+		}
+		fmt.Printf("%s  %-25s %s\n", e.Time.Local().Format("2006-01-02 15:04:05 MST"), who, quoteCmdLine(append([]string{e.Command}, e.Args...)))
+	}
+	return nil
+}
+
+// quoteCmdLine joins args for display, quoting those which would otherwise
+// be ambiguous.
+func quoteCmdLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const BACKUP_DIR string = "backup"
+
+const USAGE_BACKUP = "Usage:\n\trun -backup <cmd> [<cmd2> ...]\n"
+
+// backupDir returns ~/.run/backup/:platform/<name>. Every backup is a copy of
+// the script named by the unix time it was taken at.
+func backupDir(scriptDp, name string) string {
+	return filepath.Join(baseDir(scriptDp), BACKUP_DIR, filepath.Base(scriptDp), name)
+}
+
+// BackupCmd copies the scripts of the given commands into the backup folder,
+// so that later changes can be reviewed with -diff.
+func BackupCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf(tr(USAGE_BACKUP))
+	}
+	now := time.Now().Unix()
+	for _, name := range args {
+		cmd := jsonCmd{}
+		if err := Find(indexFp, name, &cmd); err != nil {
+			return fmt.Errorf("%q: %w", name, err)
+		}
+		content, err := os.ReadFile(cmd.Script)
+		if err != nil {
+			return err
+		}
+		dir := backupDir(scriptDp, name)
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+		fp := filepath.Join(dir, strconv.FormatInt(now, 10))
+		if err := os.WriteFile(fp, content, 0640); err != nil {
+			return err
+		}
+		fmt.Printf("Backed up %s to %s\n", cmd.Script, fp)
+	}
+	return nil
+}
+
+// latestBackup returns the path and time of the newest backup of name. It
+// returns an empty path if no backup exists.
+func latestBackup(scriptDp, name string) (string, time.Time, error) {
+	dir := backupDir(scriptDp, name)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var stamps []int64
+	for _, entry := range entries {
+		if n, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil {
+			stamps = append(stamps, n)
+		}
+	}
+	if len(stamps) == 0 {
+		return "", time.Time{}, nil
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] > stamps[j] })
+	return filepath.Join(dir, strconv.FormatInt(stamps[0], 10)), time.Unix(stamps[0], 0), nil
+}
+
+/******************************************************************************/
+
+const USAGE_DIFF = "Usage:\n\trun -diff <cmd>\n"
+
+// DiffCmd prints what changed in the script of a command since its last backup.
+func DiffCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(tr(USAGE_DIFF))
+	}
+	name := args[0]
+	cmd := jsonCmd{}
+	if err := Find(indexFp, name, &cmd); err != nil {
+		return err
+	}
+
+	fp, at, err := latestBackup(scriptDp, name)
+	if err != nil {
+		return err
+	}
+	if fp == "" {
+		return fmt.Errorf("There is no backup of %q. Create one with:\n\trun -backup %s\n", name, name)
+	}
+	old, err := os.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	cur, err := os.ReadFile(cmd.Script)
+	if err != nil {
+		return err
+	}
+
+	diff := unifiedDiff(
+		fmt.Sprintf("%s (backup %s)", name, at.Format("2006-01-02 15:04:05")),
+		cmd.Script,
+		string(old), string(cur), 3)
+	if diff == "" {
+		fmt.Printf("%s is unchanged since %s.\n", cmd.Script, at.Format("2006-01-02 15:04:05"))
+		return nil
+	}
+	fmt.Print(diff)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const USAGE_ALL = "Usage:\n\trun -all [--parallel] @<tag>\n\nRuns every command with the tag, one after another or with --parallel at once,\nand summarizes their exit codes and durations. Exits with 1 if one failed.\n"
+
+// batchResult is the outcome of a command run by -all.
+type batchResult struct {
+	name     string
+	err      error
+	duration time.Duration
+}
+
+// AllCmd runs all commands tagged with the given tag, f. e. from a single cron
+// entry, and prints a summary.
+func AllCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-all")
+	parallel := fs.Bool("parallel", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 || !strings.HasPrefix(fs.Arg(0), "@") {
+		return fmt.Errorf(tr(USAGE_ALL))
+	}
+	tag := strings.TrimPrefix(fs.Arg(0), "@")
+
+	var results []batchResult
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		if hasTag(cmd, tag) {
+			results = append(results, batchResult{name: cmd.Name})
+		}
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf(tr("No command is tagged %q.\n"), tag)
+	}
+
+	if *parallel {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(r *batchResult) {
+				defer wg.Done()
+				start := time.Now()
+				r.err = runProcess(exe, r.name)
+				r.duration = time.Since(start)
+			}(&results[i])
+		}
+		wg.Wait()
+	} else {
+		for i := range results {
+			r := &results[i]
+			start := time.Now()
+			r.err = Run([]string{r.name}, scriptDp, indexFp)
+			r.duration = time.Since(start)
+		}
+	}
+
+	failed := 0
+	fmt.Printf("\n%-20s %5s %10s\n", tr("Command"), tr("Exit"), tr("Duration"))
+	for _, r := range results {
+		fmt.Printf("%-20s %5d %10s", r.name, exitCode(r.err), formatDuration(r.duration))
+		if r.err != nil {
+			failed++
+			// errors of run itself, scripts print their own
+			if exitCode(r.err) == -1 {
+				msg := strings.TrimSpace(tr(r.err.Error()))
+				fmt.Printf("  %s", strings.SplitN(msg, "\n", 2)[0])
+			}
+		}
+		fmt.Println()
+	}
+	if failed > 0 {
+		fmt.Printf(tr("%d of %d commands failed.\n"), failed, len(results))
+		return &SilentExit{Code: 1}
+	}
+	return nil
+}
+
+// runProcess runs the command name in a run process of its own. Run changes
+// state of the process, f. e. the umask, the console code page and the
+// terminal status, thus parallel commands cannot share one. The commands do
+// not read stdin, they would compete for it.
+func runProcess(exe, name string) error {
+	child := exec.Command(exe, append(append([]string{}, globalArgs...), name)...)
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	return child.Run()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DEFAULT_MAX_OUTPUT limits the output run holds of a script, f. e. for the
+// clipboard, unless maxOutput of the command or the config says otherwise.
+const DEFAULT_MAX_OUTPUT = 50 << 20
+
+// sizeUnits are the suffixes of parseSize, 1024-based like formatSize.
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseSize parses a size like 50MB, 512K or 1048576.
+func parseSize(s string) (int64, error) {
+	num, unit := strings.TrimSpace(s), int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(num), strings.ToUpper(u.suffix)) {
+			num, unit = strings.TrimSpace(num[:len(num)-len(u.suffix)]), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf(tr("Invalid size %q, expected f. e. 50MB or 512K.\n"), s)
+	}
+	return n * unit, nil
+}
+
+// maxOutput returns the limit of the output held of the script of entry.
+func maxOutput(entry *jsonCmd, conf *config) int64 {
+	for _, s := range []string{entry.Meta.MaxOutput, conf.MaxOutput} {
+		if n, err := parseSize(s); s != "" && err == nil {
+			return n
+		}
+	}
+	return DEFAULT_MAX_OUTPUT
+}
+
+// tailBuffer keeps the last max bytes written to it. A script printing
+// without end cannot exhaust the memory of run.
+type tailBuffer struct {
+	max     int
+	buf     []byte
+	written int64
+}
+
+func newTailBuffer(max int64) *tailBuffer {
+	return &tailBuffer{max: int(max)}
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.written += int64(len(b))
+	if len(b) >= t.max {
+		t.buf = append(t.buf[:0], b[len(b)-t.max:]...)
+		return len(b), nil
+	}
+	t.buf = append(t.buf, b...)
+	// drop the head only now and then, not on every write
+	if len(t.buf) >= 2*t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(b), nil
+}
+
+// Bytes returns the last max bytes written.
+func (t *tailBuffer) Bytes() []byte {
+	if len(t.buf) > t.max {
+		return t.buf[len(t.buf)-t.max:]
+	}
+	return t.buf
+}
+
+// Truncated reports whether more than max bytes were written.
+func (t *tailBuffer) Truncated() bool {
+	return t.written > int64(t.max)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// catalogEntry is a script of a catalog. A catalog is a JSON array of them,
+// served over HTTPS. Only these options are taken over; a catalog cannot set
+// the environment, filters or other scripts of a command.
+type catalogEntry struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Url         string    `json:"url"`
+	Sha256      string    `json:"sha256"`
+	Tags        []string  `json:"tags,omitempty"`
+	MinNumArgs  int       `json:"minNumArgs,omitempty"`
+	MaxNumArgs  *int      `json:"maxNumArgs,omitempty"` // unset is unlimited
+	Args        []argSpec `json:"args,omitempty"`
+}
+
+// loadCatalog downloads the catalog of the config.
+func loadCatalog(scriptDp string) ([]catalogEntry, error) {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return nil, err
+	}
+	if conf.CatalogUrl == "" {
+		return nil, fmt.Errorf(tr("No catalog is configured. Set one with:\n\trun -config catalogUrl https://...\n"))
+	}
+	raw, err := download(scriptDp, conf.CatalogUrl)
+	if err != nil {
+		return nil, err
+	}
+	var entries []catalogEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf(tr("The catalog %s is invalid: %s\n"), conf.CatalogUrl, err)
+	}
+	return entries, nil
+}
+
+/******************************************************************************/
+
+const USAGE_CATALOG = "Usage:\n\trun -catalog search [<term>]\n\nLists the scripts of the catalog whose name, description or tags contain the\nterm, all without. Set the catalog with:\n\trun -config catalogUrl https://...\n"
+
+// CatalogCmd searches the catalog.
+func CatalogCmd(scriptDp string, args []string) error {
+	if len(args) < 1 || len(args) > 2 || args[0] != "search" {
+		return fmt.Errorf(tr(USAGE_CATALOG))
+	}
+	entries, err := loadCatalog(scriptDp)
+	if err != nil {
+		return err
+	}
+	term := ""
+	if len(args) == 2 {
+		term = strings.ToLower(args[1])
+	}
+	found := 0
+	for _, e := range entries {
+		haystack := strings.ToLower(strings.Join(append([]string{e.Name, e.Description}, e.Tags...), " "))
+		if !strings.Contains(haystack, term) {
+			continue
+		}
+		found++
+		fmt.Printf("%-20s %s\n", e.Name, e.Description)
+	}
+	if found == 0 {
+		fmt.Printf(tr("No script in the catalog matches %q.\n"), term)
+	}
+	return nil
+}
+
+const USAGE_INSTALL = "Usage:\n\trun -install <name> [<cmdName>]\n\nDownloads the script <name> of the catalog into the script folder, verifies\nits checksum and registers it, optionally under another name.\n"
+
+// InstallCmd installs a script of the catalog.
+func InstallCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) < 1 || len(args) > 2 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf(tr(USAGE_INSTALL))
+	}
+	entries, err := loadCatalog(scriptDp)
+	if err != nil {
+		return err
+	}
+	var entry *catalogEntry
+	for i := range entries {
+		if entries[i].Name == args[0] {
+			entry = &entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf(tr("There is no script %q in the catalog. Search it with:\n\trun -catalog search %s\n"), args[0], args[0])
+	}
+	name := entry.Name
+	if len(args) == 2 {
+		name = args[1]
+	}
+	// the name becomes the file name, it must not lead out of the folder
+	if err := checkName(name); err != nil {
+		return err
+	}
+	switch err := Find(indexFp, name, &jsonCmd{}); {
+	case err == nil:
+		return fmt.Errorf(tr("There already is a command named %q. Pass another name:\n\trun -install %s <name>\n"), name, entry.Name)
+	case !errors.Is(err, CmdNotFoundErr):
+		return err
+	}
+
+	u, err := url.Parse(entry.Url)
+	if err != nil {
+		return err
+	}
+	// the extension of the URL selects the interpreter, f. e. on Windows
+	base := path.Base(u.Path)
+	fp := filepath.Join(scriptDp, name+path.Ext(base))
+	if _, err := os.Stat(fp); err == nil {
+		return fmt.Errorf(tr("%s already exists.\n"), fp)
+	}
+	content, err := download(scriptDp, entry.Url)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(checksum(content), entry.Sha256) {
+		return fmt.Errorf(tr("Checksum of %s does not match the catalog, it is not installed.\n"), entry.Url)
+	}
+	if err := os.WriteFile(fp, content, 0750); err != nil {
+		return err
+	}
+
+	cmd := jsonCmd{Name: name, Script: fp, Meta: meta{
+		MinNumArgs:  entry.MinNumArgs,
+		MaxNumArgs:  -1,
+		Args:        entry.Args,
+		Tags:        entry.Tags,
+		Description: entry.Description,
+	}}
+	if entry.MaxNumArgs != nil {
+		cmd.Meta.MaxNumArgs = *entry.MaxNumArgs
+	}
+	if err := insertIntoIndex(indexFp, &cmd); err != nil {
+		os.Remove(fp)
+		return err
+	}
+	fmt.Printf(tr("Registered %s with %s\n"), cmd.Name, cmd.Script)
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// subcommand is an internal command of run. It is invoked as "run <name>" or,
+// as it always was, "run -<name>". A registered command of the same name takes
+// precedence over the first spelling, never over the second.
+type subcommand struct {
+	name    string
+	summary string // one line for run help
+	usage   string // printed for -h and --help
+	// mutating commands change the index or move scripts. Every successful
+	// invocation is recorded in the audit log.
+	mutating bool
+	run      func(scriptDp, indexFp string, args []string) error
+}
+
+var subcommands []subcommand
+
+// InternalCmds are the dash spellings of the subcommands, f. e. -new.
+var InternalCmds []string
+
+// The table is built in init, because -all runs commands through Run, which
+// depends on the table.
+func init() {
+	subcommands = []subcommand{
+		{"init", "create the script folder and the index", USAGE_INIT, false,
+			func(scriptDp, indexFp string, args []string) error { return SetUp(scriptDp, indexFp) }},
+		{"new", "register a script as command", USAGE_NEW, true, CreateCmd},
+		{"mod", "change a command or its options", USAGE_MOD, true,
+			func(scriptDp, indexFp string, args []string) error { return ModifyCmd(indexFp, args) }},
+		{"del", "delete commands", USAGE_DEL, true,
+			func(scriptDp, indexFp string, args []string) error { return DeleteCmd(indexFp, args) }},
+		{"tidy", "move scripts into the script folder", USAGE_TIDY, true, TidyCmd},
+		{"list", "list all commands", USAGE_LIST, false, ListCmd},
+		{"path", "print the locations run uses", USAGE_PATH, false,
+			func(scriptDp, indexFp string, args []string) error { return PathCmd(scriptDp, indexFp) }},
+		{"env", "print the environment of a command's script", USAGE_ENV, false, EnvCmd},
+		{"doc", "render the documentation of commands", USAGE_DOC, false, DocCmd},
+		{"backup", "back up the scripts of commands", USAGE_BACKUP, false, BackupCmd},
+		{"diff", "compare a script with its backup", USAGE_DIFF, false, DiffCmd},
+		{"diff-index", "compare two index files command by command", USAGE_DIFF_INDEX, false,
+			func(scriptDp, indexFp string, args []string) error { return DiffIndexCmd(indexFp, args) }},
+		{"args", "name the arguments of a command", USAGE_ARGS, true,
+			func(scriptDp, indexFp string, args []string) error { return ArgsCmd(indexFp, args) }},
+		{"variant", "register a command with default arguments for a script", USAGE_VARIANT, true,
+			func(scriptDp, indexFp string, args []string) error { return VariantCmd(indexFp, args) }},
+		{"tag", "set the tags of a command", USAGE_TAG, true,
+			func(scriptDp, indexFp string, args []string) error { return TagCmd(indexFp, args) }},
+		{"fmt", "format the index", USAGE_FMT, true,
+			func(scriptDp, indexFp string, args []string) error { return FmtCmd(indexFp) }},
+		{"compact", "rewrite the index and empty old trash", USAGE_COMPACT, true, CompactCmd},
+		{"lint-index", "check the commands of the index", USAGE_LINT_INDEX, false, LintIndexCmd},
+		{"doctor", "check the health of the registry", USAGE_DOCTOR, false, DoctorCmd},
+		{"verify-all", "check that this machine can run every command", USAGE_VERIFY_ALL, false, VerifyAllCmd},
+		{"config", "show or change settings", USAGE_CONFIG, false,
+			func(scriptDp, indexFp string, args []string) error { return ConfigCmd(scriptDp, args) }},
+		{"history", "show or prune the executions", USAGE_HISTORY, false,
+			func(scriptDp, indexFp string, args []string) error { return HistoryCmd(scriptDp, args) }},
+		{"exec-last-failed", "run the latest failed execution again", USAGE_EXEC_LAST_FAILED, false, ExecLastFailedCmd},
+		{"stats", "summarize the executions per command", USAGE_STATS, false,
+			func(scriptDp, indexFp string, args []string) error { return StatsCmd(scriptDp, args) }},
+		{"size", "show the disk usage of the registry", USAGE_SIZE, false, SizeCmd},
+		{"audit", "show the changes to the registry", USAGE_AUDIT, false,
+			func(scriptDp, indexFp string, args []string) error { return AuditCmd(scriptDp, args) }},
+		{"note", "keep notes on a command", USAGE_NOTE, false, NoteCmd},
+		{"pin", "pin favorite commands", USAGE_PIN, true,
+			func(scriptDp, indexFp string, args []string) error { return PinCmd(indexFp, args) }},
+		{"pack", "bundle a command into a runfile", USAGE_PACK, false,
+			func(scriptDp, indexFp string, args []string) error { return PackCmd(indexFp, args) }},
+		{"unpack", "register the command of a runfile", USAGE_UNPACK, true, UnpackCmd},
+		{"export", "write commands as justfile or Taskfile", USAGE_EXPORT, false,
+			func(scriptDp, indexFp string, args []string) error { return ExportCmd(indexFp, args) }},
+		{"import", "register the recipes of a justfile or Taskfile", USAGE_IMPORT, true, ImportCmd},
+		{"adopt", "register the scripts of the script folder", USAGE_ADOPT, true, AdoptCmd},
+		{"catalog", "search the catalog of scripts", USAGE_CATALOG, false,
+			func(scriptDp, indexFp string, args []string) error { return CatalogCmd(scriptDp, args) }},
+		{"install", "install a script of the catalog", USAGE_INSTALL, true, InstallCmd},
+		{"edit-index", "edit the index in your editor", USAGE_EDIT_INDEX, true,
+			func(scriptDp, indexFp string, args []string) error { return EditIndexCmd(indexFp, args) }},
+		{"edit-meta", "edit the options of a command in your editor", USAGE_EDIT_META, true,
+			func(scriptDp, indexFp string, args []string) error { return EditMetaCmd(indexFp, args) }},
+		{"merge", "merge two indexes, f. e. as git merge driver", USAGE_MERGE, false,
+			func(scriptDp, indexFp string, args []string) error { return MergeCmd(args) }},
+		{"all", "run all commands of a tag", USAGE_ALL, false, AllCmd},
+		{"prune", "delete unused commands", USAGE_PRUNE, true, PruneCmd},
+		{"rename-script", "rename a script and the commands' references", USAGE_RENAME_SCRIPT, true, RenameScriptCmd},
+		{"selftest", "check that this build of run works", USAGE_SELFTEST, false,
+			func(scriptDp, indexFp string, args []string) error { return SelftestCmd(scriptDp, args) }},
+		{"uninstall", "remove run and what it generated", USAGE_UNINSTALL, false,
+			func(scriptDp, indexFp string, args []string) error { return UninstallCmd(scriptDp, args) }},
+		{"help", "show the help of run or of a subcommand", USAGE_HELP, false,
+			func(scriptDp, indexFp string, args []string) error { return HelpCmd(args) }},
+	}
+	for _, sub := range subcommands {
+		InternalCmds = append(InternalCmds, "-"+sub.name)
+	}
+}
+
+// lookupSubcommand returns the subcommand word names. Without a dash, a
+// registered command of that name is preferred, so existing commands named
+// f. e. "list" keep working.
+func lookupSubcommand(word, indexFp string) (*subcommand, error) {
+	name := strings.TrimPrefix(word, "-")
+	for i := range subcommands {
+		if subcommands[i].name != name {
+			continue
+		}
+		if name == word {
+			switch err := Find(indexFp, name, &jsonCmd{}); {
+			case err == nil:
+				return nil, nil
+			case !errors.Is(err, CmdNotFoundErr) && !errors.Is(err, os.ErrNotExist):
+				return nil, err
+			}
+		}
+		return &subcommands[i], nil
+	}
+	return nil, nil
+}
+
+// wantsHelp reports whether the arguments of a subcommand ask for its help.
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "-h", "-help", "--help":
+			return true
+		}
+	}
+	return false
+}
+
+// printUsage prints the translated usage, terminated by a newline.
+func printUsage(usage string) {
+	usage = tr(usage)
+	if !strings.HasSuffix(usage, "\n") {
+		usage += "\n"
+	}
+	fmt.Print(usage)
+}
+
+/******************************************************************************/
+
+// globalFlags are the options of run given before the command, f. e.
+// $ run --platform windows list
+type globalFlags struct {
+	platform string
+	lang     string
+	profile  string
+	portable bool
+	system   bool
+	trace    bool
+	offline  bool
+}
+
+// globalArgs are the global options run was started with, which the run
+// processes started by -all --parallel get as well.
+var globalArgs []string
+
+// parseGlobalFlags parses the global options up to the command.
+func parseGlobalFlags(args []string) (flags globalFlags, rest []string, err error) {
+	for len(args) > 0 {
+		opt, val, hasVal := args[0], "", false
+		if i := strings.IndexByte(opt, '='); strings.HasPrefix(opt, "--") && i >= 0 {
+			opt, val, hasVal = opt[:i], opt[i+1:], true
+		}
+		var target *string
+		switch opt {
+		case "--platform":
+			target = &flags.platform
+		case "--lang":
+			target = &flags.lang
+		case "--profile":
+			target = &flags.profile
+		case "--portable":
+			flags.portable = true
+			args = args[1:]
+			continue
+		case "--system":
+			flags.system = true
+			args = args[1:]
+			continue
+		case "--trace":
+			flags.trace = true
+			args = args[1:]
+			continue
+		case "--offline":
+			flags.offline = true
+			args = args[1:]
+			continue
+		case "-h", "--help":
+			return flags, []string{"help"}, nil
+		default:
+			return flags, args, nil
+		}
+		if !hasVal {
+			if len(args) < 2 {
+				return flags, nil, fmt.Errorf(tr("Option %s requires a value.\n"), opt)
+			}
+			args, val = args[1:], args[1]
+		}
+		*target = val
+		args = args[1:]
+	}
+	return flags, args, nil
+}
+
+/******************************************************************************/
+
+const USAGE_HELP = "Usage:\n\trun help [<subcommand>]\n"
+
+// HelpCmd prints the usage of run with all subcommands, or of one subcommand.
+func HelpCmd(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf(tr(USAGE_HELP))
+	}
+	if len(args) == 1 {
+		name := strings.TrimPrefix(args[0], "-")
+		for _, sub := range subcommands {
+			if sub.name == name {
+				printUsage(sub.usage)
+				return nil
+			}
+		}
+		return fmt.Errorf(tr("There is no subcommand %q.\n"), args[0])
+	}
+
+	fmt.Print(tr(USAGE_RUN))
+	for _, sub := range subcommands {
+		fmt.Printf("\t%-14s %s\n", sub.name, tr(sub.summary))
+	}
+	fmt.Print(tr(USAGE_GLOBAL_FLAGS))
+	return nil
+}
+
+const USAGE_RUN = `Usage:
+	run [<global options>] <cmd> [<run options>] [--] [<args>]
+	run [<global options>] <subcommand> [<args>]
+
+Every subcommand can also be spelled with a dash, f. e. -new. If you registered
+a command named like a subcommand, "run <name>" runs your command.
+-h after a subcommand shows its help.
+
+Subcommands:
+`
+
+const USAGE_GLOBAL_FLAGS = `
+Global options:
+	--platform <p>     use the registry of another platform: unix, windows or plan9
+	--lang <lang>      language of the messages, f. e. de
+	--profile <name>   use a profile of the config, default $RUN_PROFILE
+	--portable         keep the registry next to the run executable
+	--system           manage the system registry shared by all users
+	--trace            print the timing of the phases of run to stderr
+	--offline          download nothing, use cached catalogs, scripts and tools
+	-h, --help         show this help
+`
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardPasteTools lists the commands reading the clipboard per platform, in
+// order of preference. The first one installed is used.
+var clipboardPasteTools = map[string][][]string{
+	"darwin":  {{"pbpaste"}},
+	"windows": {{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}},
+	"android": {{"termux-clipboard-get"}},
+	"linux": {
+		{"wl-paste", "--no-newline"},
+		{"xclip", "-selection", "clipboard", "-out"},
+		{"xsel", "--clipboard", "--output"},
+	},
+}
+
+// clipboardCopyTools lists the commands writing their input to the clipboard
+// per platform, in order of preference.
+var clipboardCopyTools = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"powershell", "-NoProfile", "-Command", "[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"}},
+	"android": {{"termux-clipboard-set"}},
+	"linux": {
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard", "-in"},
+		{"xsel", "--clipboard", "--input"},
+	},
+}
+
+// readClipboard returns the text on the system clipboard.
+func readClipboard() (string, error) {
+	tools := clipboardPasteTools[runtime.GOOS]
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+		var out, stderr bytes.Buffer
+		cmd := exec.Command(tool[0], tool[1:]...)
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("%s failed: %w %s", tool[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return out.String(), nil
+	}
+	return "", fmt.Errorf("No clipboard tool found. Install one of: %s\n", toolNames(tools))
+}
+
+func toolNames(tools [][]string) string {
+	if len(tools) == 0 {
+		return "(none supported on " + runtime.GOOS + ")"
+	}
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool[0]
+	}
+	return strings.Join(names, ", ")
+}
+
+// writeClipboard puts text on the system clipboard.
+func writeClipboard(text string) error {
+	tools := clipboardCopyTools[runtime.GOOS]
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(tool[0], tool[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		// xclip and wl-copy fork to serve the clipboard. A pipe would stay
+		// open until then, so their errors go to stderr directly.
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", tool[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("No clipboard tool found. Install one of: %s\n", toolNames(tools))
+}
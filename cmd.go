@@ -2,21 +2,34 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
 	_ "embed" // See https://golang.org/pkg/embed/
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/user"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 // Do not remove. Functional comment. See https://golang.org/pkg/embed/
+//
 //go:embed What_is_this.txt
 var WHAT_IS_THIS_MSG []byte
 
-func SetUp(scriptDp, indexFp string) error {
+const USAGE_INIT = "Usage:\n\trun -init\n\nCreates the script folder and an empty index.\n"
+
+func SetUp(scriptDp, indexFp string) (err error) {
 	if err := os.MkdirAll(scriptDp, 0750); err != nil {
 		return err
 	}
@@ -27,19 +40,15 @@ func SetUp(scriptDp, indexFp string) error {
 		if err != nil {
 			return err
 		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				panic(err) // do not edit, intentionally panics.
-			}
-		}()
-		if _, err := file.Write([]byte{'[', ']'}); err != nil {
+		defer closeFile(file, &err)
+		if _, err := file.Write([]byte("[]\n")); err != nil {
 			return err
 		}
 	case err != nil:
 		return err
 	}
 
-	runDir := filepath.Dir(filepath.Dir(scriptDp))
+	runDir := baseDir(scriptDp)
 	whatIsThisFp := filepath.Join(runDir, "What_is_this.txt")
 	switch _, err := os.Stat(whatIsThisFp); {
 	case err == nil:
@@ -57,59 +66,532 @@ func SetUp(scriptDp, indexFp string) error {
 
 /******************************************************************************/
 
-var InvalidJsonErrTemplate = "Invalid JSON template: %s \n Please check cmd_mapping.json\n"
 var InvalidPathToScriptErr = fmt.Errorf("There is no such script in the provided directory.")
-var USAGE_NEW = "Usage:\n\trun -new <name> <scriptPath> [<minArgsCount> <maxArgsCount>]"
+var USAGE_NEW = "Usage:\n\trun -new <name> <scriptPath> [<minArgsCount> <maxArgsCount>]\n\trun -new <name> --from-clipboard [<minArgsCount> <maxArgsCount>]\n\trun -new <name> --template <tpl> [--var <name>=<value>]... [<minArgsCount> <maxArgsCount>]\n\trun -new [<name>]\n\nWithout a script path, the other values are asked for on the terminal. Templates\nlive in ~/.run/templates; their variables are asked for on the terminal, else\ntheir defaults are used."
 
 // CreateCmd only wants the args that are unspecific to the call of CreateCmd,
 // i. e. $ run -new make make.sh 2 3 will result in [make, make.sh, 2, 3].
 // Will by default not set an upper or lower bound for max or min arguments. (i.e. 0 and -1)
-func CreateCmd(indexFp string, args []string) error {
+// With --from-clipboard instead of a script path, the script is written from
+// the clipboard into the script folder, with --template from a template. Without a script path, the values are
+// asked for on the terminal.
+func CreateCmd(scriptDp, indexFp string, args []string) (err error) {
+	if len(args) < 2 && isTerminal() {
+		return createInteractive(scriptDp, indexFp, args)
+	}
+	// a script written for the command is removed if it is not registered
+	created := ""
+	defer func() {
+		if err != nil && created != "" {
+			os.Remove(created)
+		}
+	}()
+	if len(args) >= 2 && args[1] == "--from-clipboard" {
+		if err := checkName(args[0]); err != nil {
+			return err
+		}
+		text, err := readClipboard()
+		if err != nil {
+			return err
+		}
+		fp, err := createScript(scriptDp, args[0], text)
+		if err != nil {
+			return err
+		}
+		created = fp
+		fmt.Printf(tr("Created %s from the clipboard.\n"), fp)
+		args = append([]string{args[0], fp}, args[2:]...)
+	}
+	if len(args) >= 2 && args[1] == "--template" {
+		tpl, vars, rest, err := parseTemplateArgs(args[1:])
+		if err != nil {
+			return fmt.Errorf("%w%s", err, tr(USAGE_NEW))
+		}
+		if err := checkName(args[0]); err != nil {
+			return err
+		}
+		tplFp, err := findTemplate(scriptDp, tpl)
+		if err != nil {
+			return err
+		}
+		text, err := fillTemplate(tplFp, vars)
+		if err != nil {
+			return err
+		}
+		fp, err := createScript(scriptDp, args[0], text)
+		if err != nil {
+			return err
+		}
+		created = fp
+		fmt.Printf(tr("Created %s from the template %s.\n"), fp, tpl)
+		args = append([]string{args[0], fp}, rest...)
+	}
+
 	cmd := jsonCmd{
 		Meta: meta{
 			MaxNumArgs: -1, // allow any number of args by default
 		},
 	}
 	if err := parseCmd(args, &cmd); err != nil {
-		return fmt.Errorf("%w%s", err, USAGE_NEW)
+		return fmt.Errorf("%w%s", err, tr(USAGE_NEW))
+	}
+	if err := checkName(cmd.Name); err != nil {
+		return err
+	}
+	warnInternalName(cmd.Name)
+	if activeDirContext != nil {
+		cmd.Meta.Tags = append(cmd.Meta.Tags, activeDirContext.Tags...)
 	}
 
 	if _, err := os.Stat(cmd.Script); os.IsNotExist(err) {
-		return InvalidPathToScriptErr
+		fp, err := findInSources(scriptDp, args[1])
+		if err != nil {
+			return err
+		}
+		if fp == "" {
+			return InvalidPathToScriptErr
+		}
+		fmt.Printf(tr("Using %s of the script sources.\n"), fp)
+		cmd.Script = fp
 	}
 
-	rawJson, err := json.Marshal(cmd)
-	if err != nil {
+	if err := insertIntoIndex(indexFp, &cmd); err != nil {
 		return err
 	}
 
-	if err := appendToIndex(indexFp, rawJson); err != nil {
-		return err
+	return nil
+}
+
+// findInSources returns the first existing script path relative to the
+// scriptSources of the config, "" if there is none.
+func findInSources(scriptDp, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", nil
+	}
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return "", err
 	}
+	for _, dp := range conf.ScriptSources {
+		dp, err := expandHome(dp)
+		if err != nil {
+			return "", err
+		}
+		fp := filepath.Join(dp, path)
+		trace("script sources: trying %s", fp)
+		if fi, err := os.Stat(fp); err == nil && !fi.IsDir() {
+			return fp, nil
+		}
+	}
+	return "", nil
+}
 
-	return nil
+// scriptExts maps interpreters of shebangs to the usual file extension.
+var scriptExts = map[string]string{
+	"sh": ".sh", "bash": ".sh", "zsh": ".sh", "dash": ".sh",
+	"python": ".py", "python3": ".py", "node": ".js", "ruby": ".rb",
+	"perl": ".pl", "pwsh": ".ps1", "rc": ".rc",
+}
+
+// createScript writes text as script name into the script folder and returns
+// its path. On unix, text without a shebang gets #!/bin/sh; the extension is
+// derived from the interpreter. Existing files are never overwritten.
+func createScript(scriptDp, name, text string) (fp string, err error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	ext := ".sh"
+	switch {
+	case runtime.GOOS == "windows":
+		ext = ".bat"
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	case runtime.GOOS == "plan9" && !strings.HasPrefix(text, "#!"):
+		ext = ".rc"
+		text = "#!/bin/rc\n" + text
+	case !strings.HasPrefix(text, "#!"):
+		text = "#!/bin/sh\n" + text
+	default:
+		shebang := strings.Fields(strings.SplitN(text[2:], "\n", 2)[0])
+		if len(shebang) > 0 {
+			interp := filepath.Base(shebang[0])
+			if interp == "env" && len(shebang) > 1 {
+				interp = shebang[1]
+			}
+			if e, ok := scriptExts[interp]; ok {
+				ext = e
+			}
+		}
+	}
+
+	fp = filepath.Join(scriptDp, name+ext)
+	file, err := os.OpenFile(fp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0750)
+	if os.IsExist(err) {
+		return "", fmt.Errorf(tr("%s already exists.\n"), fp)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer closeFile(file, &err)
+	if _, err := file.WriteString(text); err != nil {
+		return "", err
+	}
+	return fp, nil
 }
 
 /******************************************************************************/
 
-const USAGE_MOD = "Usage:\n\trun -mod <cmd> <newName> [<newScriptPath> [<minArgsCount> <maxArgsCount>]]\n\nAn underscore (_) denotes the orginal value."
+const USAGE_MOD = `Usage:
+	run -mod <cmd> [<options>] [<newName> [<newScriptPath> [<minArgsCount> <maxArgsCount>]]]
+	run -mod <pattern> [--tag <tag>] <options>
+	run -mod --tag <tag> <options>
+
+An underscore (_) denotes the orginal value. A pattern like 'db-*' or --tag
+selects several commands at once; then only options can be changed.
+
+Options:
+	--description <text>
+	                   what the command does, shown by -list
+	--encoding <enc>   encoding of the script's output, f. e. cp850
+	--env KEY=VALUE    set an environment variable, KEY alone removes it (repeatable)
+	--workdir <dir>    directory the script is run in, "" for the current one
+	--expect-every <d> cadence the command should succeed in, f. e. 24h or 7d
+	--script-for <os>=<script>
+	                   script to use instead on an OS, f. e. darwin=./mac.sh,
+	                   <os>= removes it (repeatable)
+	--candidate <script>
+	                   script to run instead if it exists on this machine, the
+	                   first existing one wins; "" removes all (repeatable)
+	--stdin <text>     default input of the script, "" for none
+	--stdin-file <fp>  file used as default input of the script, "" for none
+	--nice <n>         scheduling priority from -20 (highest) to 19 (lowest)
+	--low-priority     lower CPU and IO priority, --low-priority=false undoes it
+	--umask <mode>     umask of the script on unix, f. e. 077, "" for the inherited
+	--cooldown <d>     refuse to run again within this duration after a success
+	--clean-env        start the script with only PATH, HOME, LANG and --env,
+	                   --clean-env=false undoes it
+	--validate <script>
+	                   script checking the arguments before each run, "" for none
+	--clip             copy the output to the clipboard after a success,
+	                   --clip=false undoes it
+	--filter <cmd>     shell command line the output is piped through, f. e.
+	                   "jq .", "" for none; run <cmd> --raw skips it
+	--progress         show the "::progress <percent> [<text>]" lines of stderr
+	                   as a bar, --progress=false undoes it
+	--requires <bin>[@<version>][=<hint>]
+	                   program the script needs in PATH, optionally with how to
+	                   install it, "" removes all (repeatable); a version is
+	                   downloaded into the tool cache if tools of the config
+	                   has a source
+	--log-level <lvl>  $RUN_LOG_LEVEL of the script: debug, info, warn or error,
+	                   "" for info; run <cmd> --verbose or --quiet overrides it
+	--example <args>[ # <text>]
+	                   invocation shown by -doc, optionally explained, "" removes
+	                   all (repeatable)
+	--max-output <size>
+	                   output held for --clip and --plain-output, f. e. 50MB,
+	                   "" for maxOutput of the config
+	--os <os>          run only on this OS, a GOOS like linux, darwin or windows,
+	                   "" removes all (repeatable)
+	--arch <arch>      run only on this architecture, a GOARCH like amd64 or
+	                   arm64, "" removes all (repeatable)
+	--path-prepend <dir>
+	                   folder put in front of PATH, f. e. ./node_modules/.bin,
+	                   relative to the working directory, "" removes all
+	                   (repeatable)
+`
 
 func ModifyCmd(indexFp string, args []string) error {
 	if len(args) < 2 {
-		return fmt.Errorf("Wrong argument count passed.\n%s\n", USAGE_MOD)
+		return fmt.Errorf(tr("Wrong argument count passed.\n%s\n"), tr(USAGE_MOD))
 	}
-	name, updateArg := args[0], args[1:]
-	var hit bool
+	// the first argument is a name or pattern, unless --tag selects
+	pattern, named := "*", !strings.HasPrefix(args[0], "-")
+	if named {
+		pattern, args = args[0], args[1:]
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf(tr("Invalid pattern %q: %w\n"), pattern, err)
+	}
+
+	fs := newFlagSet("-mod")
+	tag := fs.String("tag", "", "")
+	description := fs.String("description", "", "")
+	encoding := fs.String("encoding", "", "")
+	workdir := fs.String("workdir", "", "")
+	expectEvery := fs.String("expect-every", "", "")
+	stdin := fs.String("stdin", "", "")
+	stdinFile := fs.String("stdin-file", "", "")
+	nice := fs.String("nice", "0", "")
+	lowPriority := fs.Bool("low-priority", false, "")
+	umask := fs.String("umask", "", "")
+	cooldown := fs.String("cooldown", "", "")
+	cleanEnv := fs.Bool("clean-env", false, "")
+	validate := fs.String("validate", "", "")
+	clip := fs.Bool("clip", false, "")
+	filter := fs.String("filter", "", "")
+	progress := fs.Bool("progress", false, "")
+	level := fs.String("log-level", "", "")
+	maxOut := fs.String("max-output", "", "")
+	var env, scriptFor, requires, candidates, examples, oses, arches, pathPrepend stringList
+	fs.Var(&env, "env", "")
+	fs.Var(&requires, "requires", "")
+	fs.Var(&scriptFor, "script-for", "")
+	fs.Var(&candidates, "candidate", "")
+	fs.Var(&examples, "example", "")
+	fs.Var(&oses, "os", "")
+	fs.Var(&arches, "arch", "")
+	fs.Var(&pathPrepend, "path-prepend", "")
+	// options may follow the positional arguments, f. e.
+	// run -mod beta _ _ 0 3 --encoding cp850
+	var updateArg []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return fmt.Errorf("%w\n%s", err, tr(USAGE_MOD))
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		updateArg, args = append(updateArg, fs.Arg(0)), fs.Args()[1:]
+	}
+	if len(updateArg) > 4 {
+		return fmt.Errorf(tr("Wrong argument count passed.\n%s\n"), tr(USAGE_MOD))
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !named && !set["tag"] {
+		// changing every command takes an explicit "*"
+		return fmt.Errorf(tr("Wrong argument count passed.\n%s\n"), tr(USAGE_MOD))
+	}
+
+	batch := set["tag"] || strings.ContainsAny(pattern, "*?[")
+	if batch && len(updateArg) > 0 {
+		return fmt.Errorf(tr("Cannot rename or change the script of several commands at once.\n%s"), tr(USAGE_MOD))
+	}
+	if len(updateArg) == 0 && len(set) == 0 || len(set) == 1 && set["tag"] {
+		return fmt.Errorf(tr("Wrong argument count passed.\n%s\n"), tr(USAGE_MOD))
+	}
+	if set["encoding"] {
+		if _, err := codePage(*encoding); err != nil {
+			return err
+		}
+	}
+	if set["expect-every"] && *expectEvery != "" {
+		if _, err := parseDuration(*expectEvery); err != nil {
+			return err
+		}
+	}
+	for _, goos := range oses {
+		if goos != "" && !contains(knownOS, goos) {
+			return fmt.Errorf(tr("Unknown OS %q, expected one of %s.\n"), goos, strings.Join(knownOS, ", "))
+		}
+	}
+	for _, arch := range arches {
+		if arch != "" && !contains(knownArch, arch) {
+			return fmt.Errorf(tr("Unknown architecture %q, expected one of %s.\n"), arch, strings.Join(knownArch, ", "))
+		}
+	}
+	overrides := make(map[string]string, len(scriptFor))
+	for _, kv := range scriptFor {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return fmt.Errorf(tr("--script-for expects <os>=<script>, got %q.\n"), kv)
+		}
+		goos, script := kv[:i], kv[i+1:]
+		if script != "" {
+			abs, err := filepath.Abs(script)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(abs); os.IsNotExist(err) {
+				return InvalidPathToScriptErr
+			}
+			script = abs
+		}
+		overrides[goos] = script
+	}
+	for i, script := range candidates {
+		if script == "" {
+			continue
+		}
+		// candidates need not exist on this machine
+		abs, err := filepath.Abs(script)
+		if err != nil {
+			return err
+		}
+		candidates[i] = abs
+	}
+	niceVal, err := parseNice(*nice)
+	if err != nil {
+		return err
+	}
+	if set["cooldown"] && *cooldown != "" {
+		if _, err := parseDuration(*cooldown); err != nil {
+			return err
+		}
+	}
+	if set["validate"] && *validate != "" {
+		abs, err := filepath.Abs(*validate)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); os.IsNotExist(err) {
+			return InvalidPathToScriptErr
+		}
+		*validate = abs
+	}
+	if set["log-level"] && *level != "" && !contains(logLevels, *level) {
+		return fmt.Errorf(tr("The log level must be one of %s, got %q.\n"), strings.Join(logLevels, ", "), *level)
+	}
+	if set["max-output"] && *maxOut != "" {
+		if _, err := parseSize(*maxOut); err != nil {
+			return err
+		}
+	}
+	if set["umask"] && *umask != "" {
+		if _, err := parseUmask(*umask); err != nil {
+			return err
+		}
+	}
+	if set["stdin"] && set["stdin-file"] && *stdin != "" && *stdinFile != "" {
+		return fmt.Errorf(tr("Use either --stdin or --stdin-file, not both.\n"))
+	}
+	if set["stdin-file"] && *stdinFile != "" {
+		abs, err := filepath.Abs(*stdinFile)
+		if err != nil {
+			return err
+		}
+		*stdinFile = abs
+	}
+	if set["workdir"] && *workdir != "" {
+		abs, err := filepath.Abs(*workdir)
+		if err != nil {
+			return err
+		}
+		*workdir = abs
+	}
+	var hits int
 
 	// Will still result in rewriting hole index file, because we cannot know
 	// if the file was changed, thus cannot set esc.
 	var modify modFn = func(cmd *jsonCmd) (inc bool, esc bool, err error) {
 		inc = true
 
-		if cmd.Name != name {
+		if ok, _ := path.Match(pattern, cmd.Name); !ok {
+			return
+		}
+		if set["tag"] && !hasTag(cmd, *tag) {
+			return
+		}
+		hits++
+
+		if set["encoding"] {
+			cmd.Meta.Encoding = *encoding
+		}
+		if set["workdir"] {
+			cmd.Meta.Workdir = *workdir
+		}
+		if set["expect-every"] {
+			cmd.Meta.ExpectEvery = *expectEvery
+		}
+		if set["nice"] {
+			cmd.Meta.Nice = niceVal
+		}
+		if set["low-priority"] {
+			cmd.Meta.LowPriority = *lowPriority
+		}
+		if set["umask"] {
+			cmd.Meta.Umask = *umask
+		}
+		if set["cooldown"] {
+			cmd.Meta.Cooldown = *cooldown
+		}
+		if set["clean-env"] {
+			cmd.Meta.CleanEnv = *cleanEnv
+		}
+		if set["validate"] {
+			cmd.Meta.Validate = *validate
+		}
+		if set["clip"] {
+			cmd.Meta.Clip = *clip
+		}
+		if set["filter"] {
+			cmd.Meta.Filter = *filter
+		}
+		if set["progress"] {
+			cmd.Meta.Progress = *progress
+		}
+		if set["log-level"] {
+			cmd.Meta.LogLevel = *level
+		}
+		if set["max-output"] {
+			cmd.Meta.MaxOutput = *maxOut
+		}
+		if set["description"] {
+			cmd.Meta.Description = *description
+		}
+		// the input is either a literal or a file, setting one drops the other
+		if set["stdin"] {
+			cmd.Meta.Stdin, cmd.Meta.StdinFile = *stdin, ""
+		}
+		if set["stdin-file"] {
+			cmd.Meta.Stdin, cmd.Meta.StdinFile = "", *stdinFile
+		}
+		for goos, script := range overrides {
+			if script == "" {
+				delete(cmd.Meta.ScriptOverrides, goos)
+				continue
+			}
+			if cmd.Meta.ScriptOverrides == nil {
+				cmd.Meta.ScriptOverrides = make(map[string]string)
+			}
+			cmd.Meta.ScriptOverrides[goos] = script
+		}
+		for _, kv := range env {
+			cmd.Meta.Env = setEnv(cmd.Meta.Env, kv)
+		}
+		for _, req := range requires {
+			requireBin(&cmd.Meta, req)
+		}
+		for _, script := range candidates {
+			if script == "" {
+				cmd.Meta.Candidates = nil
+			} else if !contains(cmd.Meta.Candidates, script) {
+				cmd.Meta.Candidates = append(cmd.Meta.Candidates, script)
+			}
+		}
+		for _, example := range examples {
+			if example == "" {
+				cmd.Meta.Examples = nil
+			} else if !contains(cmd.Meta.Examples, example) {
+				cmd.Meta.Examples = append(cmd.Meta.Examples, example)
+			}
+		}
+		for _, goos := range oses {
+			if goos == "" {
+				cmd.Meta.OS = nil
+			} else if !contains(cmd.Meta.OS, goos) {
+				cmd.Meta.OS = append(cmd.Meta.OS, goos)
+			}
+		}
+		for _, arch := range arches {
+			if arch == "" {
+				cmd.Meta.Arch = nil
+			} else if !contains(cmd.Meta.Arch, arch) {
+				cmd.Meta.Arch = append(cmd.Meta.Arch, arch)
+			}
+		}
+		for _, dir := range pathPrepend {
+			if dir == "" {
+				cmd.Meta.PathPrepend = nil
+			} else if !contains(cmd.Meta.PathPrepend, dir) {
+				cmd.Meta.PathPrepend = append(cmd.Meta.PathPrepend, dir)
+			}
+		}
+		if len(updateArg) == 0 {
 			return
 		}
-		hit = true
 
 		// allow old values
 		n := cmd.Name
@@ -132,9 +614,15 @@ func ModifyCmd(indexFp string, args []string) error {
 			max = updateArg[3]
 		}
 
+		if n != cmd.Name {
+			if err := checkName(n); err != nil {
+				return inc, esc, err
+			}
+			warnInternalName(n)
+		}
 		// make updated command
 		if err := parseCmd([]string{n, s, min, max}, cmd); err != nil {
-			return inc, esc, fmt.Errorf("%w%s\n", err, USAGE_MOD)
+			return inc, esc, fmt.Errorf("%w%s\n", err, tr(USAGE_MOD))
 		}
 		return
 	}
@@ -143,20 +631,53 @@ func ModifyCmd(indexFp string, args []string) error {
 		return err
 	}
 
-	if !hit {
+	if hits == 0 {
 		return CmdNotFoundErr
 	}
+	if batch && hits == 1 {
+		fmt.Println(tr("Modified 1 command."))
+	} else if batch {
+		fmt.Printf(tr("Modified %d commands.\n"), hits)
+	}
 
 	return nil
 }
 
+// setEnv sets KEY=VALUE in env, replacing an existing value of KEY. A kv
+// without '=' removes KEY.
+func setEnv(env []string, kv string) []string {
+	key := kv
+	if i := strings.IndexByte(kv, '='); i >= 0 {
+		key = kv[:i]
+	}
+	out := env[:0]
+	for _, e := range env {
+		if e != key && !strings.HasPrefix(e, key+"=") {
+			out = append(out, e)
+		}
+	}
+	if key != kv {
+		out = append(out, kv)
+	}
+	return out
+}
+
+func hasTag(cmd *jsonCmd, tag string) bool {
+	for _, t := range cmd.Meta.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 /******************************************************************************/
 
 const USAGE_DEL = "Usage:\n\trun -del <cmd> [<cmd2> ...]\n"
 
 func DeleteCmd(indexFp string, args []string) error {
 	if len(args) < 1 {
-		return fmt.Errorf(USAGE_DEL)
+		return fmt.Errorf(tr(USAGE_DEL))
 	}
 
 	excl := make(map[string]struct{}, len(args))
@@ -183,17 +704,58 @@ func DeleteCmd(indexFp string, args []string) error {
 	if len(rm) < len(excl) {
 		for k := range excl {
 			if _, yes := rm[k]; !yes {
-				fmt.Printf("Cannot delete non-existent command %q.\n", k)
+				fmt.Printf(tr("Cannot delete non-existent command %q.\n"), k)
 			}
 		}
-		fmt.Println("See all commands:\n\trun -list")
+		fmt.Println(tr("See all commands:\n\trun -list"))
 	}
 	return nil
 }
 
 /******************************************************************************/
 
-func TidyCmd(scriptDp, indexFp string) error {
+const USAGE_TIDY = "Usage:\n\trun -tidy [<cmd>...] [--tag <tag>]\n\nMoves the scripts of the commands given by name or tag, without either, of all\ncommands, into the script folder and summarizes which were moved, skipped and\nfailed. A command whose move failed keeps its script. Commands sharing a moved\nscript move along.\n"
+
+// tidyResult is the outcome of -tidy for a command.
+type tidyResult struct {
+	name, result, detail string
+}
+
+func TidyCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-tidy")
+	tag := fs.String("tag", "", "")
+	var names []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return fmt.Errorf("%w\n%s", err, tr(USAGE_TIDY))
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		names, args = append(names, fs.Arg(0)), fs.Args()[1:]
+	}
+	scoped := len(names) > 0 || *tag != ""
+	found := make(map[string]bool, len(names))
+	selected := make(map[string]bool) // the scripts to move
+	var sel findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		if !scoped || contains(names, cmd.Name) || *tag != "" && hasTag(cmd, *tag) {
+			found[cmd.Name] = true
+			selected[cmd.Script] = true
+		}
+		return
+	}
+	if err := findOperation(indexFp, sel); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !found[name] {
+			return fmt.Errorf(tr("Cannot tidy non-existent command %q.\nSee all commands:\n\trun -list\n"), name)
+		}
+	}
+	if *tag != "" && len(selected) == 0 {
+		return fmt.Errorf(tr("No command is tagged %q.\n"), *tag)
+	}
+
 	entries, err := os.ReadDir(scriptDp)
 	if err != nil {
 		return err
@@ -202,6 +764,14 @@ func TidyCmd(scriptDp, indexFp string) error {
 	for _, entry := range entries {
 		takenNames[entry.Name()] = struct{}{}
 	}
+	ignore, err := loadIgnore(scriptDp)
+	if err != nil {
+		return err
+	}
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
 
 	// tidy moves all scripts into a single directory. This has two
 	// effects:
@@ -209,52 +779,156 @@ func TidyCmd(scriptDp, indexFp string) error {
 	//    activly prevent name collisions.
 	// 2) The IO should be reduced, i. e. the calls to os.Rename should
 	//    be limited. To do so check if script is already in the dir.
+	var results []tidyResult
+	alreadyTidy := 0                 // unlisted if not scoped
+	moved := make(map[string]string) // scripts shared by commands move once
+	var renames [][]string           // recorded in the audit log
 	var tidy modFn = func(cmd *jsonCmd) (inc, esc bool, err error) {
 		inc = true
+		// a script shared with a selected command moves along
+		if !selected[cmd.Script] {
+			return
+		}
+		skip := func(format string, a ...interface{}) {
+			results = append(results, tidyResult{cmd.Name, tr("skipped"), fmt.Sprintf(tr(format), a...)})
+		}
 
+		if newPath, ok := moved[cmd.Script]; ok {
+			results = append(results, tidyResult{cmd.Name, tr("moved"), fmt.Sprintf(tr("to %s, shares the script"), newPath)})
+			cmd.Script = newPath
+			return
+		}
 		scriptName := filepath.Base(cmd.Script)
 
 		// check if already in registry
-		if strings.HasPrefix(cmd.Script, scriptDp) {
+		if isInside(scriptDp, cmd.Script) {
+			alreadyTidy++
+			if scoped {
+				skip("already in the script folder")
+			}
+			return
+		}
+		// helpers and libraries listed in .runignore stay where they are
+		if ignore.Ignored(scriptName, false) {
+			skip("ignored by %s", IGNORE_FILE)
 			return
 		}
+		if isBrokenLink(cmd.Script) {
+			skip("a broken symlink to %s", linkTarget(cmd.Script))
+			return
+		}
+		detail := ""
 		// check for name collison
+		renamed := false
 		if _, exists := takenNames[scriptName]; exists {
-			// search for fitting name. Pattern: name + NUM_ASC + ext; start 1
-			// f. e. update.sh -> update1.sh
-			ext := filepath.Ext(scriptName)
-			n := 1
-			name := cmd.Script[:len(cmd.Script)-len(ext)]
-			pattern := name + "%d" + ext
-
-			var newName = fmt.Sprintf(pattern, n)
-			for {
-				if _, exist := takenNames[newName]; exist {
-					n++
-					newName = fmt.Sprintf(pattern, n)
-					continue
-				}
-				break
-			}
-			fmt.Printf("Renaming %s to %s because of script name collision in registry.", scriptName, newName)
-			scriptName = newName
+			newName := collisionName(conf.TidyRenamePattern, scriptName, takenNames)
+			detail = fmt.Sprintf(tr(", renamed, %s is taken"), scriptName)
+			scriptName, renamed = newName, true
 		}
 
 		newPath := filepath.Join(scriptDp, scriptName)
-		if err := os.Rename(cmd.Script, newPath); err != nil {
-			fmt.Printf("Failed to move %q to %q: %s\n", scriptName, newPath, err.Error())
-			return inc, esc, err
+		var moveErr error
+		if target := linkTarget(cmd.Script); target != "" {
+			moveErr = moveLink(cmd.Script, target, newPath)
+		} else {
+			moveErr = os.Rename(cmd.Script, newPath)
+		}
+		if moveErr != nil {
+			// the command keeps its script, the others are still moved
+			results = append(results, tidyResult{cmd.Name, tr("failed"), moveErr.Error()})
+			return
+		}
+		results = append(results, tidyResult{cmd.Name, tr("moved"), fmt.Sprintf(tr("to %s"), newPath) + detail})
+		if renamed {
+			renames = append(renames, []string{"--renamed", cmd.Script, newPath})
 		}
+		takenNames[scriptName] = struct{}{}
+		moved[cmd.Script] = newPath
 		cmd.Script = newPath
 		return
 	}
 
-	return modOperation(indexFp, tidy)
+	if err := modOperation(indexFp, tidy); err != nil {
+		return err
+	}
+	for _, args := range renames {
+		if err := audit(scriptDp, "-tidy", args); err != nil {
+			return err
+		}
+	}
+	counts := make(map[string]int)
+	if len(results) > 0 {
+		fmt.Printf("%-20s %-8s %s\n", tr("Command"), tr("Result"), tr("Details"))
+	}
+	for _, r := range results {
+		counts[r.result]++
+		fmt.Printf("%-20s %-8s %s\n", r.name, r.result, r.detail)
+	}
+	fmt.Printf(tr("%d moved, %d skipped, %d failed.\n"), counts[tr("moved")], counts[tr("skipped")], counts[tr("failed")])
+	if !scoped && alreadyTidy > 0 {
+		fmt.Printf(tr("%d already in the script folder.\n"), alreadyTidy)
+	}
+	if counts[tr("failed")] > 0 {
+		return &SilentExit{Code: 1}
+	}
+	return nil
+}
+
+// DEFAULT_TIDY_RENAME is the tidyRenamePattern if the config has none.
+const DEFAULT_TIDY_RENAME = "{name}{n}{ext}"
+
+// collisionName returns a name for the script file scriptName, which is taken
+// in the script folder, after pattern. Its placeholders are {name} and {ext} of
+// scriptName, {n}, a number counting up from 1, {host} and {date}. If pattern
+// has no {n} and its name is taken as well, the number is appended to it, f. e.
+// update-laptop.sh -> update-laptop1.sh.
+func collisionName(pattern, scriptName string, taken map[string]struct{}) string {
+	if pattern == "" {
+		pattern = DEFAULT_TIDY_RENAME
+	}
+	ext := filepath.Ext(scriptName)
+	host, _ := os.Hostname()
+	r := strings.NewReplacer("{name}", scriptName[:len(scriptName)-len(ext)], "{ext}", ext,
+		"{host}", host, "{date}", time.Now().Format("2006-01-02"))
+	// split first, a {n} in the name of the script is no placeholder
+	parts := strings.Split(pattern, "{n}")
+	for i := range parts {
+		parts[i] = r.Replace(parts[i])
+	}
+	if len(parts) == 1 {
+		if _, exists := taken[parts[0]]; !exists {
+			return parts[0]
+		}
+		ext := filepath.Ext(parts[0])
+		parts = []string{parts[0][:len(parts[0])-len(ext)], ext}
+	}
+	for n := 1; ; n++ {
+		name := strings.Join(parts, strconv.Itoa(n))
+		if _, exists := taken[name]; !exists {
+			return name
+		}
+	}
 }
 
 /******************************************************************************/
 
-func ListCmd(scriptDp, indexFp string) error {
+const USAGE_LIST = "Usage:\n\trun -list [--smart | --tree [--by dir|namespace|tag]]\n\n--smart lists pinned commands first, then the most recently used.\n"
+
+func ListCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-list")
+	tree := fs.Bool("tree", false, "")
+	by := fs.String("by", "dir", "")
+	smart := fs.Bool("smart", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || (*tree && *smart) {
+		return fmt.Errorf("%s", tr(USAGE_LIST))
+	}
+	if *tree {
+		return listTree(indexFp, *by)
+	}
+	if *smart {
+		return listSmart(scriptDp, indexFp)
+	}
+
 	templt := "%-10s %s\n"
 	intTemplt := "%-10s internal\n"
 
@@ -264,11 +938,244 @@ func ListCmd(scriptDp, indexFp string) error {
 		fmt.Printf(intTemplt, cmd)
 	}
 
+	last, err := lastSuccesses(scriptDp)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
 	var print findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		line := fmt.Sprintf("%-10s %s", cmd.Name, cmd.Script)
+		if target := linkTarget(cmd.Script); target != "" {
+			line += " -> " + target
+		}
+		if reason := unavailable(cmd); reason != "" {
+			line += fmt.Sprintf(tr(" (unavailable, %s)"), reason)
+		} else if stale := staleness(cmd, last, now, tr); stale != "" {
+			line += fmt.Sprintf(tr(" (stale, %s)"), stale)
+		}
+		if cmd.Meta.VariantOf != "" {
+			line += fmt.Sprintf(tr(" [variant of %s: %s]"), cmd.Meta.VariantOf, strings.Join(cmd.Meta.DefaultArgs, " "))
+		}
+		if cmd.Meta.Description != "" {
+			line += "  # " + cmd.Meta.Description
+		}
+		fmt.Println(line)
+		return
+	}
+	personal := make(map[string]bool)
+	var listPersonal findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		personal[cmd.Name] = true
+		return print(cmd)
+	}
+	// users of a jump host may have no registry of their own
+	sysIndexFp := systemIndex(scriptDp)
+	personalErr := findOperation(indexFp, listPersonal)
+	if personalErr != nil && (!os.IsNotExist(personalErr) || sysIndexFp == indexFp) {
+		return personalErr
+	}
+
+	// the commands of the system registry, unless shadowed by personal ones
+	if sysIndexFp == indexFp {
+		return nil
+	}
+	var listSystem findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		if personal[cmd.Name] {
+			return
+		}
+		cmd.Meta.Description = strings.TrimSpace(tr("(system)") + " " + cmd.Meta.Description)
+		return print(cmd)
+	}
+	if err := findOperation(sysIndexFp, listSystem); os.IsNotExist(err) {
+		return personalErr
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// listSmart prints the pinned commands first, then the others by their last
+// execution, most recent first. Never executed commands follow by name.
+func listSmart(scriptDp, indexFp string) error {
+	last, err := lastRuns(scriptDp)
+	if err != nil {
+		return err
+	}
+	var cmds []jsonCmd
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		cmds = append(cmds, *cmd)
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	sort.SliceStable(cmds, func(i, j int) bool {
+		a, b := &cmds[i], &cmds[j]
+		if a.Meta.Pinned != b.Meta.Pinned {
+			return a.Meta.Pinned
+		}
+		return last[a.Name].After(last[b.Name])
+	})
+
+	fmt.Println("run commands:")
+	fmt.Printf("%-10s %s\n", "Name", "Location")
+	for _, cmd := range cmds {
+		if cmd.Meta.Pinned {
+			fmt.Printf("%-10s %s (pinned)\n", cmd.Name, cmd.Script)
+			continue
+		}
 		fmt.Printf("%-10s %s\n", cmd.Name, cmd.Script)
+	}
+	for _, cmd := range InternalCmds {
+		fmt.Printf("%-10s internal\n", cmd)
+	}
+	return nil
+}
+
+// listTree prints the commands grouped by the directory of their script, their
+// namespace (the part of the name before ':', f. e. db:migrate) or their tags.
+// Groups and commands are sorted by name.
+func listTree(indexFp, by string) error {
+	var groupsOf func(cmd *jsonCmd) []string
+	switch by {
+	case "dir":
+		groupsOf = func(cmd *jsonCmd) []string {
+			return []string{filepath.Dir(cmd.Script)}
+		}
+	case "namespace":
+		groupsOf = func(cmd *jsonCmd) []string {
+			if i := strings.IndexByte(cmd.Name, ':'); i > 0 {
+				return []string{cmd.Name[:i]}
+			}
+			return []string{"(none)"}
+		}
+	case "tag":
+		groupsOf = func(cmd *jsonCmd) []string {
+			if len(cmd.Meta.Tags) == 0 {
+				return []string{"(untagged)"}
+			}
+			return cmd.Meta.Tags
+		}
+	default:
+		return fmt.Errorf(tr("Cannot group by %q.\n%s"), by, tr(USAGE_LIST))
+	}
+
+	groups := make(map[string][]string)
+	var total int
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		total++
+		for _, g := range groupsOf(cmd) {
+			groups[g] = append(groups[g], cmd.Name)
+		}
 		return
 	}
-	return findOperation(indexFp, print)
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+
+	printGroup := func(g string, cmds []string) {
+		cmds = append([]string(nil), cmds...)
+		sort.Strings(cmds)
+		fmt.Printf("%s (%d)\n", g, len(cmds))
+		for i, name := range cmds {
+			branch := "├── "
+			if i == len(cmds)-1 {
+				branch = "└── "
+			}
+			fmt.Println(branch + name)
+		}
+	}
+	fmt.Printf("run commands (%d):\n", total+len(InternalCmds))
+	for _, g := range names {
+		printGroup(g, groups[g])
+	}
+	printGroup("internal", InternalCmds)
+	return nil
+}
+
+/******************************************************************************/
+
+const USAGE_PIN = "Usage:\n\trun -pin [--remove] <cmd> [<cmd2> ...]\n\nPinned commands are listed first by -list --smart.\n"
+
+// PinCmd marks commands as favorites, or with --remove unmarks them.
+func PinCmd(indexFp string, args []string) error {
+	fs := newFlagSet("-pin")
+	remove := fs.Bool("remove", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return fmt.Errorf(tr(USAGE_PIN))
+	}
+	for _, name := range fs.Args() {
+		err := modifyOne(indexFp, name, func(cmd *jsonCmd) error {
+			cmd.Meta.Pinned = !*remove
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/******************************************************************************/
+
+const USAGE_TAG = "Usage:\n\trun -tag <cmd> [<tag> ...]\n\nReplaces the tags of <cmd>. Without tags, all tags are removed."
+
+func TagCmd(indexFp string, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf(tr(USAGE_TAG))
+	}
+	tags := args[1:]
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, " \t,") {
+			return fmt.Errorf(tr("Invalid tag %q, tags must not contain spaces or commas.\n"), tag)
+		}
+	}
+	return modifyOne(indexFp, args[0], func(cmd *jsonCmd) error {
+		cmd.Meta.Tags = tags
+		return nil
+	})
+}
+
+/******************************************************************************/
+
+// FmtCmd rewrites the index sorted by name with one command per line. All
+// other commands keep this format, so it is only needed after manual edits.
+const USAGE_FMT = "Usage:\n\trun -fmt\n\nRewrites the index sorted by name, one command per line.\n"
+
+func FmtCmd(indexFp string) error {
+	if err := formatIndex(indexFp); err != nil {
+		return err
+	}
+	fmt.Printf(tr("Formatted %s\n"), indexFp)
+	return nil
+}
+
+/******************************************************************************/
+
+const USAGE_PATH = "Usage:\n\trun -path\n\nPrints the user run acts on behalf of, the script folder and the index.\n"
+
+// PathCmd prints the user run acts on behalf of and the locations derived from
+// it. Useful to debug sudo, doas or run0 setups.
+func PathCmd(scriptDp, indexFp string) error {
+	templt := "%-10s %s\n"
+
+	usr, env, err := realUser()
+	if err != nil {
+		return err
+	}
+	if usr != nil {
+		fmt.Printf(templt, "User", fmt.Sprintf("%s (via $%s)", usr.Username, env))
+	} else if usr, err := user.Current(); err == nil {
+		fmt.Printf(templt, "User", usr.Username)
+	}
+	fmt.Printf(templt, "Home", filepath.Dir(baseDir(scriptDp)))
+	fmt.Printf(templt, "Scripts", scriptDp)
+	fmt.Printf(templt, "Index", indexFp)
+	return nil
 }
 
 /******************************************************************************/
@@ -298,7 +1205,132 @@ func parseCmd(args []string, cmd *jsonCmd) (err error) {
 		cmd.Meta.MaxNumArgs = i
 	}
 	if !ran {
-		return fmt.Errorf("Wrong argument count.\n")
+		return fmt.Errorf(tr("Wrong argument count.\n"))
+	}
+	return nil
+}
+
+// checkName returns an error if name cannot be run as command: run takes a
+// leading dash for an internal command, and path separators and spaces make
+// it a path or several arguments. The error suggests a name which works.
+func checkName(name string) error {
+	var problem string
+	switch {
+	case name == "":
+		return fmt.Errorf(tr("The name of a command must not be empty.\n"))
+	case strings.HasPrefix(name, "-"):
+		problem = tr("must not start with -, run takes it for an internal command")
+	case strings.ContainsAny(name, `/\`):
+		problem = tr("must not contain path separators")
+	case strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+		problem = tr("must not contain spaces")
+	default:
+		return nil
+	}
+	if suggestion := sanitizeName(name); suggestion != "" {
+		return fmt.Errorf(tr("The name %q %s. Use %q instead.\n"), name, problem, suggestion)
+	}
+	return fmt.Errorf(tr("The name %q %s.\n"), name, problem)
+}
+
+// sanitizeName turns name into one checkName accepts, f. e. "-my backup" into
+// "my-backup". It returns "" if nothing is left.
+func sanitizeName(name string) string {
+	fields := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '/' || r == '\\' || unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+	return strings.TrimLeft(strings.Join(fields, "-"), "-")
+}
+
+// warnInternalName warns if name is also the name of an internal command.
+// It works, but the internal command then needs its dash.
+func warnInternalName(name string) {
+	for _, sub := range subcommands {
+		if sub.name == name {
+			fmt.Printf(tr("Note: %s is also an internal command. run %s runs your command, run -%s the internal one.\n"), name, name, name)
+		}
+	}
+}
+
+// isInside reports whether fp is dir itself or below it. Symlinks are
+// resolved, f. e. for a home on another disk, and on macOS and Windows, whose
+// file systems are case-insensitive by default, case is ignored. A symlink is
+// inside dir if the link is, wherever its target is.
+func isInside(dir, fp string) bool {
+	dir, fp = resolvePath(dir), resolveLocation(fp)
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		dir, fp = strings.ToLower(dir), strings.ToLower(fp)
+	}
+	rel, err := filepath.Rel(dir, fp)
+	if err != nil {
+		return false // f. e. different volumes on Windows
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute, clean path of fp with all symlinks
+// resolved. If fp does not exist, its parent is resolved instead.
+func resolvePath(fp string) string {
+	abs, err := filepath.Abs(fp)
+	if err != nil {
+		return filepath.Clean(fp)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	if real, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(real, filepath.Base(abs))
+	}
+	return abs
+}
+
+// resolveLocation is resolvePath for the folder of fp only. If fp is a
+// symlink, the path of the link is returned, not of its target.
+func resolveLocation(fp string) string {
+	abs, err := filepath.Abs(fp)
+	if err != nil {
+		return filepath.Clean(fp)
+	}
+	return filepath.Join(resolvePath(filepath.Dir(abs)), filepath.Base(abs))
+}
+
+// newFlagSet returns a flag set for the options of an internal command. Errors
+// are not printed, the caller reports them with the usage of the command.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// stringList is a flag which can be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// modifyOne applies fn to the command name. It returns CmdNotFoundErr if
+// there is no such command.
+func modifyOne(indexFp, name string, fn func(cmd *jsonCmd) error) error {
+	var hit bool
+	var modify modFn = func(cmd *jsonCmd) (inc, esc bool, err error) {
+		inc = true
+		if cmd.Name == name {
+			hit = true
+			err = fn(cmd)
+		}
+		return
+	}
+	if err := modOperation(indexFp, modify); err != nil {
+		return err
+	}
+	if !hit {
+		return CmdNotFoundErr
 	}
 	return nil
 }
@@ -308,11 +1340,14 @@ func parseCmd(args []string, cmd *jsonCmd) (err error) {
 
 // Find return CmdNotFoundErr if no matching command could be found.
 func Find(indexFp string, name string, lCmd *jsonCmd) error {
-	var hit bool
+	if err := findLine(indexFp, name, lCmd); err != errNotCanonical {
+		return err
+	}
 
+	var hit bool
 	var find findFn = func(cmd *jsonCmd) (esc bool, err error) {
 		if cmd.Name == name {
-			lCmd = cmd
+			*lCmd = *cmd
 			hit = true
 			esc = true
 			return
@@ -329,6 +1364,58 @@ func Find(indexFp string, name string, lCmd *jsonCmd) error {
 	return nil
 }
 
+var errNotCanonical = errors.New("index is not in the canonical layout")
+
+// findLine implements Find for an index in the layout of indexWriter, one
+// command per line starting with its name. Only the line of the command is
+// decoded, instead of every command before it. Indexes edited by hand may
+// have another layout, then it returns errNotCanonical.
+func findLine(indexFp, name string, lCmd *jsonCmd) error {
+	file, err := openIndex(indexFp)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	quoted, err := json.Marshal(name)
+	if err != nil {
+		return err
+	}
+	prefix := []byte(`{"commandName":`)
+	want := append(append(append([]byte(nil), prefix...), quoted...), ',')
+
+	r := bufio.NewReader(file)
+	for i := 0; ; i++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		trimmed := bytes.TrimSpace(line)
+		switch {
+		case i == 0 && bytes.Equal(trimmed, []byte("[]")):
+			return CmdNotFoundErr
+		case i == 0:
+			if !bytes.Equal(trimmed, []byte("[")) {
+				return errNotCanonical
+			}
+		case bytes.Equal(trimmed, []byte("]")):
+			return CmdNotFoundErr
+		case !bytes.HasPrefix(trimmed, prefix):
+			return errNotCanonical
+		case bytes.HasPrefix(trimmed, want):
+			var cmd jsonCmd
+			if err := json.Unmarshal(bytes.TrimSuffix(trimmed, []byte(",")), &cmd); err != nil {
+				return errNotCanonical // the full decode reports where
+			}
+			cmd.absPaths()
+			*lCmd = cmd
+			return nil
+		}
+		if err == io.EOF {
+			return errNotCanonical // no closing bracket
+		}
+	}
+}
+
 // fn func(cmd *jsonCmd) (inc bool, esc bool, err error)
 // inc: include the cmd. inc == false will not include the command.
 // esc: escape the same as err but semantically more expressive.
@@ -336,26 +1423,23 @@ func Find(indexFp string, name string, lCmd *jsonCmd) error {
 type findFn func(cmd *jsonCmd) (esc bool, err error)
 
 func findOperation(indexFp string, fn findFn) error {
-	file, err := os.Open(indexFp)
+	file, err := openIndex(indexFp)
 	if err != nil {
 		return err
 	}
-	defer saveClose(file)
-	dec := json.NewDecoder(file)
+	defer file.Close()
+	dec := newIndexDecoder(file, indexFp)
 
-	t, err := dec.Token()
-	if err != nil {
+	if err := dec.Open(); err != nil {
 		return err
 	}
-	if t != json.Delim('[') {
-		return fmt.Errorf(InvalidJsonErrTemplate, t)
-	}
 
 	for dec.More() {
 		var cmd jsonCmd
-		if err := dec.Decode(&cmd); err != nil {
+		if err := dec.Next(&cmd); err != nil {
 			return err
 		}
+		cmd.absPaths()
 
 		esc, err := fn(&cmd)
 		if err != nil {
@@ -366,7 +1450,7 @@ func findOperation(indexFp string, fn findFn) error {
 			return nil
 		}
 	}
-	return nil
+	return dec.Close()
 }
 
 // modFn is a callback provided to modOperation, which will be called for every
@@ -378,40 +1462,53 @@ func findOperation(indexFp string, fn findFn) error {
 type modFn func(cmd *jsonCmd) (inc, esc bool, err error)
 
 func modOperation(indexFp string, fn modFn) error {
-	src, err := os.Open(indexFp)
+	return rewriteIndex(indexFp, fn, nil)
+}
+
+// insertIntoIndex adds cmd to the index at its sorted position.
+func insertIntoIndex(indexFp string, cmd *jsonCmd) error {
+	var keep modFn = func(cmd *jsonCmd) (inc, esc bool, err error) {
+		inc = true
+		return
+	}
+	return rewriteIndex(indexFp, keep, cmd)
+}
+
+// rewriteIndex implements modOperation. If insert is not nil, it is written
+// in front of the first command sorting after it. If the result is not sorted,
+// f. e. because fn renamed a command, the index is formatted afterwards.
+func rewriteIndex(indexFp string, fn modFn, insert *jsonCmd) (err error) {
+	src, err := openIndex(indexFp)
 	if err != nil {
 		return err
 	}
-	defer saveClose(src)
-	dec := json.NewDecoder(src)
+	defer src.Close()
+	dec := newIndexDecoder(src, indexFp)
 
 	fpExt := indexFp + ".tmp"
 	dst, err := os.OpenFile(fpExt, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0660)
 	if err != nil {
 		return err
 	}
-
-	var rmTmp = true
-	defer func(fp string) {
-		if rmTmp { // closure because we need value of rmTmp at end of exec.
-			if err := os.Remove(fp); err != nil {
-				panic(err)
-			}
+	// unless it replaced the index, the temporary file is removed, f. e. on
+	// errors or if fn escaped
+	var renamed bool
+	defer func() {
+		if renamed {
+			return
 		}
-	}(fpExt)
-
-	defer saveClose(dst)
-	dstWr := bufio.NewWriter(dst)
-
-	// read '['
-	t, err := dec.Token()
-	if err != nil {
+		dst.Close() // may be closed already, its content is dropped anyway
+		if rmErr := os.Remove(fpExt); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}()
+	if err := keepMode(dst, indexFp); err != nil {
 		return err
 	}
-	if t != json.Delim('[') {
-		return fmt.Errorf(InvalidJsonErrTemplate, t)
-	}
-	if err := dstWr.WriteByte('['); err != nil {
+	dstWr := newIndexWriter(dst)
+
+	// read '['
+	if err := dec.Open(); err != nil {
 		return err
 	}
 
@@ -419,143 +1516,205 @@ func modOperation(indexFp string, fn modFn) error {
 		inc bool
 		esc bool
 	)
-	// another is used to check if we need to insert a ',' before adding rawJson
-	another := false
 	for dec.More() {
 		var cmd jsonCmd
-		if err := dec.Decode(&cmd); err != nil {
+		if err := dec.Next(&cmd); err != nil {
 			return err
 		}
+		cmd.absPaths()
 
 		inc, esc, err = fn(&cmd)
 		if err != nil {
 			return err
 		}
 
-		// defered functions will take care, f. e. rm tmp file
+		// the deferred function removes the temporary file
 		if esc {
 			return nil
 		}
 
 		if inc {
-			raw, err := json.Marshal(cmd)
-			if err != nil {
-				return err
-			}
-			if another {
-				if err := dstWr.WriteByte(','); err != nil {
+			if insert != nil && insert.Name < cmd.Name {
+				if err := dstWr.Add(insert); err != nil {
 					return err
 				}
+				insert = nil
 			}
-			if _, err := dstWr.Write(raw); err != nil {
+			if err := dstWr.Add(&cmd); err != nil {
 				return err
 			}
-			if !another {
-				another = true
-			}
 		}
 	}
-
-	if err := dstWr.WriteByte(']'); err != nil {
+	if err := dec.Close(); err != nil {
 		return err
 	}
+	if insert != nil {
+		if err := dstWr.Add(insert); err != nil {
+			return err
+		}
+	}
 
-	if err := dstWr.Flush(); err != nil {
+	if err := dstWr.Close(); err != nil {
+		return err
+	}
+	// Windows cannot rename open files
+	if err := dst.Close(); err != nil {
 		return err
 	}
-
 	if err := os.Rename(fpExt, indexFp); err != nil {
 		return err
 	}
-	// defered os.Remove() function unnecessary.
-	rmTmp = false
+	renamed = true
+
+	if !dstWr.sorted {
+		return formatIndex(indexFp)
+	}
 	return nil
 }
 
-func appendToIndex(indexFp string, rawJson []byte) error {
-	file, err := os.OpenFile(indexFp, os.O_RDWR|os.O_CREATE, 0550)
+// indexWriter writes the canonical layout of the index, one command per line,
+// so that diffs of a synced index are readable:
+//
+//	[
+//	  {"commandName":"a",...},
+//	  {"commandName":"b",...}
+//	]
+type indexWriter struct {
+	w       *bufio.Writer
+	another bool // insert a ',' before the next command
+	last    string
+	sorted  bool
+	// with encryptIndex, the plain index is collected and encrypted to dst
+	plain *bytes.Buffer
+	dst   io.Writer
+}
+
+func newIndexWriter(w io.Writer) *indexWriter {
+	if encryption.index {
+		plain := &bytes.Buffer{}
+		return &indexWriter{w: bufio.NewWriter(plain), sorted: true, plain: plain, dst: w}
+	}
+	return &indexWriter{w: bufio.NewWriter(w), sorted: true}
+}
+
+func (iw *indexWriter) Add(cmd *jsonCmd) error {
+	raw, err := json.Marshal(cmd.relPaths())
 	if err != nil {
 		return err
 	}
-	defer saveClose(file)
+	sep := ",\n  "
+	if !iw.another {
+		sep = "[\n  "
+		iw.another = true
+	} else if cmd.Name < iw.last {
+		iw.sorted = false
+	}
+	iw.last = cmd.Name
+	if _, err := iw.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = iw.w.Write(raw)
+	return err
+}
 
-	fi, err := file.Stat()
+// Close writes the end of the index and flushes. It does not close the
+// underlying writer.
+func (iw *indexWriter) Close() error {
+	end := "\n]\n"
+	if !iw.another {
+		end = "[]\n"
+	}
+	if _, err := iw.w.WriteString(end); err != nil {
+		return err
+	}
+	if err := iw.w.Flush(); err != nil || iw.plain == nil {
+		return err
+	}
+	plain := iw.plain.Bytes()
+	raw, err := ageCmd(iw.plain, "--encrypt")
 	if err != nil {
 		return err
 	}
+	decryptedIndexes[sha256.Sum256(raw)] = plain // read back without age
+	_, err = iw.dst.Write(raw)
+	return err
+}
 
-	// if file is empty ("") or ("[]\n"), just add json
-	if fi.Size() <= 3 {
-		cap := len(rawJson) + 2
-		buf := make([]byte, cap)
-		buf[0] = '['
-		copy(buf[1:cap], rawJson)
-		buf[cap-1] = ']'
-		if _, err := file.Write(buf); err != nil {
-			return err
-		}
-		return nil
+// formatIndex rewrites the index sorted by name in the canonical layout.
+// Unlike modOperation, it needs to hold all commands in memory.
+func formatIndex(indexFp string) error {
+	var cmds []jsonCmd
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		cmds = append(cmds, *cmd)
+		return
 	}
-	// Else, allow efficient writes by appending to end.
-	// account for trailing spaces:
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	return writeIndex(indexFp, cmds)
+}
 
-	// read up to 9 other bytes till ']' is the last.
-	// " x x x x x x x x x ] ... "
-	// later write a max of 9 other bytes + ',' + rawJson + ']'.
-	// " x x x x x x x x x , jsonRaw ] "
-	buf := make([]byte, 10+len(rawJson)+1)
+// writeIndex atomically replaces the index with cmds, sorted by name.
+func writeIndex(indexFp string, cmds []jsonCmd) error {
+	sort.SliceStable(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
 
-	offset := fi.Size() - 10
-	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+	fpExt := indexFp + ".tmp"
+	dst, err := os.OpenFile(fpExt, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0660)
+	if err != nil {
 		return err
 	}
-	n, err := file.Read(buf)
-	if err != nil { // does NOT return io.EOF because we read exactly till end.
+	if err := keepMode(dst, indexFp); err != nil {
+		dst.Close()
+		os.Remove(fpExt)
 		return err
 	}
-
-	// find ']', the real end of json
-	var end = -1
-	for i, b := range buf[:n] { // :n actually not needed?
-		if b == ']' {
-			end = i
+	dstWr := newIndexWriter(dst)
+	for i := range cmds {
+		if err = dstWr.Add(&cmds[i]); err != nil {
 			break
 		}
 	}
-	if end == -1 {
-		return fmt.Errorf(InvalidJsonErrTemplate, end)
+	if err == nil {
+		err = dstWr.Close()
 	}
-
-	// replace ']'
-	buf[end] = ','
-	// append serialised cmd
-	copy(buf[end+1:], rawJson)
-	// add ']' again
-	cap := end + 2 + len(rawJson)
-	buf[cap-1] = ']'
-	if _, err := file.WriteAt(buf[:cap], offset); err != nil {
+	closeFile(dst, &err)
+	if err != nil {
+		os.Remove(fpExt)
 		return err
 	}
-	return nil
+	return os.Rename(fpExt, indexFp)
+}
+
+// keepMode gives the file replacing the index the permissions of the index,
+// f. e. readable by all users for the system registry.
+func keepMode(file *os.File, indexFp string) error {
+	fi, err := os.Stat(indexFp)
+	if err != nil {
+		return nil
+	}
+	return file.Chmod(fi.Mode().Perm())
 }
 
 func invalidArgsError(cmd *jsonCmd, argsLen int) error {
-	var s = "at least"
+	// whole sentences, as the plural differs between languages
+	var msg = "%q expects at least %d arguments."
 	var n = cmd.Meta.MinNumArgs
-	var plural = "s"
 	if argsLen > cmd.Meta.MaxNumArgs {
-		s = "at most"
+		msg = "%q expects at most %d arguments."
 		n = cmd.Meta.MaxNumArgs
 	}
 	if n == 1 || n == -1 {
-		plural = ""
+		msg = strings.TrimSuffix(msg, "s.") + "."
 	}
 
-	return fmt.Errorf("%q expects %s %d argument%s.", cmd.Name, s, n, plural)
+	return fmt.Errorf(tr(msg), cmd.Name, n)
 }
 
-func saveClose(f *os.File) {
-	if err := f.Close(); err != nil {
-		panic(err)
+// closeFile closes a written file. A close error, f. e. of a full disk or a
+// network file system, means the data may be lost, thus it becomes *err,
+// unless there already is an error.
+func closeFile(f *os.File, err *error) {
+	if cerr := f.Close(); cerr != nil && *err == nil {
+		*err = cerr
 	}
 }
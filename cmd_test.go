@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestIndex writes an index of n commands named cmd-00000 onwards.
+func writeTestIndex(tb testing.TB, n int) string {
+	tb.Helper()
+	cmds := make([]jsonCmd, n)
+	for i := range cmds {
+		name := fmt.Sprintf("cmd-%05d", i)
+		cmds[i] = jsonCmd{Name: name, Script: "/scripts/" + name + ".sh", Meta: meta{
+			MaxNumArgs: -1,
+			Tags:       []string{"bench"},
+		}}
+	}
+	indexFp := filepath.Join(tb.TempDir(), INDEX_FILE)
+	if err := writeIndex(indexFp, cmds); err != nil {
+		tb.Fatal(err)
+	}
+	return indexFp
+}
+
+func BenchmarkFind(b *testing.B) {
+	indexFp := writeTestIndex(b, 10000)
+	name := "cmd-09000"
+	b.Run("findLine", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var cmd jsonCmd
+			if err := findLine(indexFp, name, &cmd); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// the fallback for indexes not in the canonical layout
+	b.Run("findOperation", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			hit := false
+			var find findFn = func(cmd *jsonCmd) (esc bool, err error) {
+				hit = cmd.Name == name
+				return hit, nil
+			}
+			if err := findOperation(indexFp, find); err != nil || !hit {
+				b.Fatal(err, hit)
+			}
+		}
+	})
+}
+
+// newTestRegistry creates an empty registry in a temporary home and returns
+// its script folder and index.
+func newTestRegistry(t *testing.T) (scriptDp, indexFp string) {
+	t.Helper()
+	scriptDp = filepath.Join(t.TempDir(), BASE_DIR, SCRIPT_DIR, "unix")
+	if err := os.MkdirAll(scriptDp, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	indexFp = filepath.Join(scriptDp, INDEX_FILE)
+	if err := writeIndex(indexFp, nil); err != nil {
+		t.Fatal(err)
+	}
+	return scriptDp, indexFp
+}
+
+// register adds commands to the index, the script of each is named like it.
+func register(t *testing.T, indexFp string, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		cmd := jsonCmd{Name: name, Script: filepath.Join(dir, name+".sh"), Meta: meta{MaxNumArgs: -1}}
+		if err := insertIntoIndex(indexFp, &cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// indexNames returns the names of the index in the order of the file.
+func indexNames(t *testing.T, indexFp string) []string {
+	t.Helper()
+	names := []string{}
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		names = append(names, cmd.Name)
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestInsertIntoIndex(t *testing.T) {
+	scriptDp, indexFp := newTestRegistry(t)
+	register(t, indexFp, scriptDp, "c", "a", "e", "b")
+	if got, want := indexNames(t, indexFp), []string{"a", "b", "c", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("index has %q, want %q", got, want)
+	}
+	// inserted commands keep the index canonical
+	var cmd jsonCmd
+	if err := findLine(indexFp, "b", &cmd); err != nil || cmd.Script != filepath.Join(scriptDp, "b.sh") {
+		t.Errorf("findLine(b) = %v, %+v", err, cmd)
+	}
+}
+
+func TestModOperation(t *testing.T) {
+	scriptDp, indexFp := newTestRegistry(t)
+	register(t, indexFp, scriptDp, "a", "b", "c")
+
+	var mod modFn = func(cmd *jsonCmd) (inc, esc bool, err error) {
+		switch cmd.Name {
+		case "b":
+			return false, false, nil
+		case "c":
+			cmd.Meta.Description = "changed"
+		}
+		return true, false, nil
+	}
+	if err := modOperation(indexFp, mod); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := indexNames(t, indexFp), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("index has %q, want %q", got, want)
+	}
+	var cmd jsonCmd
+	if err := Find(indexFp, "c", &cmd); err != nil || cmd.Meta.Description != "changed" {
+		t.Errorf("Find(c) = %v, %+v", err, cmd)
+	}
+
+	// an error or escape leaves the index as it is
+	before, err := os.ReadFile(indexFp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := errors.New("failing")
+	for _, fn := range []modFn{
+		func(cmd *jsonCmd) (inc, esc bool, err error) { return false, false, failing },
+		func(cmd *jsonCmd) (inc, esc bool, err error) { return false, true, nil },
+	} {
+		if err := modOperation(indexFp, fn); err != nil && err != failing {
+			t.Fatal(err)
+		}
+		if after, _ := os.ReadFile(indexFp); !bytes.Equal(before, after) {
+			t.Errorf("index changed to %s", after)
+		}
+	}
+	if _, err := os.Stat(indexFp + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary index is left: %v", err)
+	}
+}
+
+func TestRewriteIndexRenameSorts(t *testing.T) {
+	scriptDp, indexFp := newTestRegistry(t)
+	register(t, indexFp, scriptDp, "a", "b", "c")
+	if err := modifyOne(indexFp, "a", func(cmd *jsonCmd) error {
+		cmd.Name = "d"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := indexNames(t, indexFp), []string{"b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("index has %q, want %q", got, want)
+	}
+	if err := modifyOne(indexFp, "a", func(cmd *jsonCmd) error { return nil }); err != CmdNotFoundErr {
+		t.Errorf("modifyOne(a) = %v, want CmdNotFoundErr", err)
+	}
+}
+
+func TestModifyCmdOptionsAfterPositionals(t *testing.T) {
+	scriptDp, indexFp := newTestRegistry(t)
+	register(t, indexFp, scriptDp, "a")
+	if err := ModifyCmd(indexFp, []string{"a", "_", "_", "0", "3", "--description", "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	var cmd jsonCmd
+	if err := Find(indexFp, "a", &cmd); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Meta.Description != "hello" || cmd.Meta.MinNumArgs != 0 || cmd.Meta.MaxNumArgs != 3 {
+		t.Errorf("Find(a) = %+v, want description hello and 0 to 3 arguments", cmd.Meta)
+	}
+	if err := ModifyCmd(indexFp, []string{"a", "_", "_", "0", "3", "4"}); err == nil {
+		t.Error("ModifyCmd with 5 positional arguments succeeded")
+	}
+}
+
+func TestFindLine(t *testing.T) {
+	scriptDp, indexFp := newTestRegistry(t)
+	register(t, indexFp, scriptDp, "a", "b")
+
+	var cmd jsonCmd
+	if err := findLine(indexFp, "b", &cmd); err != nil || cmd.Name != "b" {
+		t.Errorf("findLine(b) = %v, %+v", err, cmd)
+	}
+	if err := findLine(indexFp, "missing", &cmd); err != CmdNotFoundErr {
+		t.Errorf("findLine(missing) = %v, want CmdNotFoundErr", err)
+	}
+	// a prefix of a name is no match
+	if err := findLine(indexFp, "", &cmd); err != CmdNotFoundErr {
+		t.Errorf(`findLine("") = %v, want CmdNotFoundErr`, err)
+	}
+
+	for _, layout := range []string{
+		`[{"commandName":"a","scriptName":"/a.sh","options":{}}, {"commandName":"b","scriptName":"/b.sh","options":{}}]`,
+		"[\n  {\n    \"commandName\": \"b\",\n    \"scriptName\": \"/b.sh\"\n  }\n]\n",
+		"[\n",
+	} {
+		if err := os.WriteFile(indexFp, []byte(layout), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		if err := findLine(indexFp, "b", &cmd); err != errNotCanonical {
+			t.Errorf("findLine(b) in %q = %v, want errNotCanonical", layout, err)
+		}
+		if layout == "[\n" {
+			continue // broken, the fallback reports why
+		}
+		cmd = jsonCmd{}
+		if err := Find(indexFp, "b", &cmd); err != nil || cmd.Script != "/b.sh" {
+			t.Errorf("Find(b) in %q = %v, %+v", layout, err, cmd)
+		}
+	}
+}
+
+func TestTidyCmd(t *testing.T) {
+	scriptDp, indexFp := newTestRegistry(t)
+	outside := t.TempDir()
+	for _, fp := range []string{
+		filepath.Join(outside, "deploy.sh"),
+		filepath.Join(outside, "backup.sh"),
+		filepath.Join(scriptDp, "backup.sh"), // unrelated, takes the name
+		filepath.Join(scriptDp, "inside.sh"),
+	} {
+		if err := os.WriteFile(fp, []byte("#!/bin/sh\n"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	register(t, indexFp, outside, "deploy", "backup")
+	register(t, indexFp, scriptDp, "inside")
+	shared := jsonCmd{Name: "deploy-prod", Script: filepath.Join(outside, "deploy.sh"), Meta: meta{MaxNumArgs: -1}}
+	if err := insertIntoIndex(indexFp, &shared); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := TidyCmd(scriptDp, indexFp, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"deploy":      filepath.Join(scriptDp, "deploy.sh"),
+		"deploy-prod": filepath.Join(scriptDp, "deploy.sh"),
+		"backup":      filepath.Join(scriptDp, "backup1.sh"),
+		"inside":      filepath.Join(scriptDp, "inside.sh"),
+	} {
+		var cmd jsonCmd
+		if err := Find(indexFp, name, &cmd); err != nil {
+			t.Fatal(err)
+		}
+		if cmd.Script != want {
+			t.Errorf("script of %s is %s, want %s", name, cmd.Script, want)
+		}
+		if _, err := os.Stat(want); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, fp := range []string{"deploy.sh", "backup.sh"} {
+		if _, err := os.Stat(filepath.Join(outside, fp)); !os.IsNotExist(err) {
+			t.Errorf("%s was not moved: %v", fp, err)
+		}
+	}
+
+	if err := TidyCmd(scriptDp, indexFp, []string{"missing"}); err == nil {
+		t.Error("tidying a missing command succeeded")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const USAGE_COMPACT = "Usage:\n\trun -compact [--trash-max-age <duration>]\n\nRewrites the index sorted by name without identical duplicates and removes the\nscripts in the trash older than --trash-max-age, trashMaxAge by default, f. e.\n30d. Reports the sizes before and after. The index is replaced at once, runs in\nthe meantime see the old or the new one.\n"
+
+// CompactCmd is the maintenance of the registry: -fmt, the identical
+// duplicates of -lint-index --fix and the retention of the trash in one go.
+func CompactCmd(scriptDp, indexFp string, args []string) error {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	fs := newFlagSet("-compact")
+	maxAge := fs.String("trash-max-age", conf.TrashMaxAge, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_COMPACT))
+	}
+	var keepFor time.Duration
+	if *maxAge != "" {
+		if keepFor, err = parseDuration(*maxAge); err != nil {
+			return err
+		}
+	}
+	trashDp := filepath.Join(baseDir(scriptDp), TRASH_DIR)
+	indexBefore, err := fileSize(indexFp)
+	if err != nil {
+		return err
+	}
+	trashBefore, err := dirSize(trashDp)
+	if err != nil {
+		return err
+	}
+
+	var cmds []jsonCmd
+	seen := make(map[string]bool)
+	dropped := 0
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		raw, err := json.Marshal(cmd)
+		if err != nil {
+			return
+		}
+		if seen[string(raw)] {
+			dropped++
+			return
+		}
+		seen[string(raw)] = true
+		cmds = append(cmds, *cmd)
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	if err := writeIndex(indexFp, cmds); err != nil {
+		return err
+	}
+	removed := 0
+	if keepFor > 0 {
+		if removed, err = pruneTrash(trashDp, time.Now().Add(-keepFor)); err != nil {
+			return err
+		}
+	}
+
+	indexAfter, err := fileSize(indexFp)
+	if err != nil {
+		return err
+	}
+	trashAfter, err := dirSize(trashDp)
+	if err != nil {
+		return err
+	}
+	templt := "%-8s %10s -> %10s  %s\n"
+	fmt.Printf(templt, tr("Index"), formatSize(indexBefore), formatSize(indexAfter),
+		fmt.Sprintf(tr("%d commands, %d identical duplicates dropped"), len(cmds), dropped))
+	trashNote := tr("kept, no trashMaxAge")
+	if keepFor > 0 {
+		trashNote = fmt.Sprintf(tr("%d scripts older than %s removed"), removed, *maxAge)
+	}
+	fmt.Printf(templt, tr("Trash"), formatSize(trashBefore), formatSize(trashAfter), trashNote)
+	return nil
+}
+
+// pruneTrash removes the scripts of the trash moved there before cutoff, as
+// told by the time moveToTrash prefixed them with.
+func pruneTrash(trashDp string, cutoff time.Time) (int, error) {
+	platforms, err := os.ReadDir(trashDp)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, platform := range platforms {
+		if !platform.IsDir() {
+			continue
+		}
+		dp := filepath.Join(trashDp, platform.Name())
+		entries, err := os.ReadDir(dp)
+		if err != nil {
+			return removed, err
+		}
+		for _, entry := range entries {
+			// 20060102-150405-<script>
+			name := entry.Name()
+			if len(name) < 16 {
+				continue
+			}
+			at, err := time.ParseInLocation("20060102-150405", name[:15], time.Local)
+			if err != nil || !at.Before(cutoff) {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(dp, name)); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// fileSize returns the size of fp, 0 if it does not exist.
+func fileSize(fp string) (int64, error) {
+	fi, err := os.Stat(fp)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
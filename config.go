@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const CONFIG_FILE string = "config.json"
+
+// config holds the settings of ~/.run/config.json. Every field must have a
+// json tag; it is the key used by -config. Zero values are the defaults.
+type config struct {
+	// HistoryMaxEntries limits the history to the latest entries, 0 keeps all.
+	HistoryMaxEntries int `json:"historyMaxEntries,omitempty"`
+	// HistoryMaxAge drops entries older than this duration, f. e. 90d.
+	HistoryMaxAge string `json:"historyMaxAge,omitempty"`
+	// TrashMaxAge is the age after which -compact removes scripts from the
+	// trash, f. e. 30d. Empty keeps them.
+	TrashMaxAge string `json:"trashMaxAge,omitempty"`
+	// RequireRegistered disables running unregistered scripts of the script
+	// folder by their file name, the index is the single source of truth.
+	RequireRegistered bool `json:"requireRegistered,omitempty"`
+	// ConfirmUnregistered asks before running an unregistered script.
+	ConfirmUnregistered bool `json:"confirmUnregistered,omitempty"`
+	// ScriptSources are folders -new looks for a relative script path in,
+	// if it does not exist in the working directory, f. e. ~/scripts.
+	ScriptSources []string `json:"scriptSources,omitempty"`
+	// TidyRenamePattern names a script -tidy moves into the script folder if
+	// its name is taken there, f. e. {name}-{host}{ext}. See collisionName.
+	TidyRenamePattern string `json:"tidyRenamePattern,omitempty"`
+	// ResolveOrder decides whether a command or a script of the script
+	// folder is run if the name matches both: index or file.
+	ResolveOrder string `json:"resolveOrder,omitempty"`
+	// PathFallback runs a program of PATH if the name is neither a command
+	// nor a script of the script folder.
+	PathFallback bool `json:"pathFallback,omitempty"`
+	// WslInterop runs the commands of the registry of the other side of WSL,
+	// Windows or Linux, if a name is found nowhere else.
+	WslInterop bool `json:"wslInterop,omitempty"`
+	// AutoAdopt registers unregistered scripts when they are run by their
+	// file name, as -adopt does.
+	AutoAdopt bool `json:"autoAdopt,omitempty"`
+	// Hints is always, once or off. With once, every hint is shown once.
+	Hints string `json:"hints,omitempty"`
+	// PruneUnusedFor is the default window of -prune, f. e. 180d.
+	PruneUnusedFor string `json:"pruneUnusedFor,omitempty"`
+	// MaxDepth limits how deep scripts may call run, 0 is 10.
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// MetricsCmd is a script called after every execution with the command
+	// name, exit code and duration in milliseconds.
+	MetricsCmd string `json:"metricsCmd,omitempty"`
+	// StatsdAddr is the host:port of a StatsD server receiving a counter and
+	// a timer per execution.
+	StatsdAddr string `json:"statsdAddr,omitempty"`
+	// MaxConcurrentRuns limits the commands running at once across all run
+	// processes, 0 is unlimited.
+	MaxConcurrentRuns int `json:"maxConcurrentRuns,omitempty"`
+	// Language of the messages, f. e. de. Empty follows $LANG.
+	Language string `json:"language,omitempty"`
+	// EncryptIndex encrypts the index with age when it is written.
+	EncryptIndex bool `json:"encryptIndex,omitempty"`
+	// AgeIdentity is the age identity file to encrypt and decrypt with.
+	// Without, age asks for a passphrase.
+	AgeIdentity string `json:"ageIdentity,omitempty"`
+	// CatalogUrl is the HTTPS URL of the catalog -install installs from.
+	CatalogUrl string `json:"catalogUrl,omitempty"`
+	// TerminalTitle shows the running command in the title of the terminal.
+	TerminalTitle bool `json:"terminalTitle,omitempty"`
+	// TerminalNotify shows the progress in the tab and notifies when the
+	// command ends, where the terminal supports it.
+	TerminalNotify bool `json:"terminalNotify,omitempty"`
+	// Summary prints a line with the result after a command: never,
+	// on-failure or always.
+	Summary string `json:"summary,omitempty"`
+	// ReceiptsFile is a file the summaries are also appended to, as JSON
+	// lines.
+	ReceiptsFile string `json:"receiptsFile,omitempty"`
+	// ShowNotes prints the notes of a command before it runs.
+	ShowNotes bool `json:"showNotes,omitempty"`
+	// OnSuccess and OnFailure are run in the shell after a command succeeded
+	// or failed, f. e. to play a sound; "bell" rings the terminal bell.
+	OnSuccess string `json:"onSuccess,omitempty"`
+	OnFailure string `json:"onFailure,omitempty"`
+	// OnExitAfter skips onSuccess and onFailure for commands which ended
+	// sooner than this duration, f. e. 30s.
+	OnExitAfter string `json:"onExitAfter,omitempty"`
+	// MaxOutput is the maxOutput of commands without their own, 50MB if
+	// empty.
+	MaxOutput string `json:"maxOutput,omitempty"`
+	// Profiles are the environments selected with --profile, by name. They
+	// cannot be set with -config.
+	Profiles map[string]profile `json:"profiles,omitempty"`
+	// Tools are the sources of programs required with a version, f. e.
+	// --requires terraform@1.7.5, by name. They cannot be set with -config.
+	Tools map[string]toolSource `json:"tools,omitempty"`
+}
+
+func configFp(scriptDp string) string {
+	return filepath.Join(baseDir(scriptDp), CONFIG_FILE)
+}
+
+// loadConfig reads the config. A missing file is the default config.
+func loadConfig(scriptDp string) (*config, error) {
+	conf := &config{}
+	raw, err := os.ReadFile(configFp(scriptDp))
+	if os.IsNotExist(err) {
+		return conf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, conf); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFp(scriptDp), err)
+	}
+	return conf, nil
+}
+
+func saveConfig(scriptDp string, conf *config) error {
+	raw, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configFp(scriptDp), append(raw, '\n'), 0640)
+}
+
+/******************************************************************************/
+
+const USAGE_CONFIG = "Usage:\n\trun -config [<key> [<value>]]\n\nWithout a key, all settings are listed. An empty value restores the default.\n"
+
+// ConfigCmd lists, prints or sets the settings of config.json.
+func ConfigCmd(scriptDp string, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf(tr(USAGE_CONFIG))
+	}
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	fields := configFields(conf)
+
+	if len(args) == 0 {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("%-20s %v\n", key, fields[key].Interface())
+		}
+		return nil
+	}
+
+	field, ok := fields[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown setting %q. See all settings:\n\trun -config\n", args[0])
+	}
+	if len(args) == 1 {
+		fmt.Println(field.Interface())
+		return nil
+	}
+
+	val := args[1]
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(val)
+	case reflect.Int:
+		n := 0
+		if val != "" {
+			if n, err = strconv.Atoi(val); err != nil {
+				return fmt.Errorf("%s must be a number: %w", args[0], err)
+			}
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b := false
+		if val != "" {
+			if b, err = strconv.ParseBool(val); err != nil {
+				return fmt.Errorf("%s must be true or false: %w", args[0], err)
+			}
+		}
+		field.SetBool(b)
+	case reflect.Slice: // []string, comma separated
+		var list []string
+		if val != "" {
+			list = strings.Split(val, ",")
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("%s cannot be set with -config, edit %s instead.\n", args[0], configFp(scriptDp))
+	}
+	if err := conf.validate(); err != nil {
+		return err
+	}
+	return saveConfig(scriptDp, conf)
+}
+
+// configFields maps the json keys of conf to its settable fields.
+func configFields(conf *config) map[string]reflect.Value {
+	v := reflect.ValueOf(conf).Elem()
+	fields := make(map[string]reflect.Value, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		key := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		fields[key] = v.Field(i)
+	}
+	return fields
+}
+
+func (c *config) validate() error {
+	if c.HistoryMaxEntries < 0 {
+		return fmt.Errorf("historyMaxEntries must not be negative")
+	}
+	if c.HistoryMaxAge != "" {
+		if _, err := parseDuration(c.HistoryMaxAge); err != nil {
+			return fmt.Errorf("historyMaxAge: %w", err)
+		}
+	}
+	if c.TrashMaxAge != "" {
+		if _, err := parseDuration(c.TrashMaxAge); err != nil {
+			return fmt.Errorf("trashMaxAge: %w", err)
+		}
+	}
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("maxDepth must not be negative")
+	}
+	if c.MaxConcurrentRuns < 0 {
+		return fmt.Errorf("maxConcurrentRuns must not be negative")
+	}
+	if c.PruneUnusedFor != "" {
+		if _, err := parseDuration(c.PruneUnusedFor); err != nil {
+			return fmt.Errorf("pruneUnusedFor: %w", err)
+		}
+	}
+	switch c.Hints {
+	case "", HINTS_ALWAYS, HINTS_ONCE, HINTS_OFF:
+	default:
+		return fmt.Errorf(tr("hints must be %s, %s or %s.\n"), HINTS_ALWAYS, HINTS_ONCE, HINTS_OFF)
+	}
+	for _, dp := range c.ScriptSources {
+		if !filepath.IsAbs(dp) && !strings.HasPrefix(dp, "~/") {
+			return fmt.Errorf(tr("scriptSources: %q must be an absolute path or start with ~/.\n"), dp)
+		}
+	}
+	for bin, src := range c.Tools {
+		if !strings.HasPrefix(src.Url, "https://") {
+			return fmt.Errorf(tr("tools.%s.url must be an HTTPS URL.\n"), bin)
+		}
+	}
+	if strings.ContainsAny(c.TidyRenamePattern, `/\`) || c.TidyRenamePattern != "" && !strings.Contains(c.TidyRenamePattern, "{name}") {
+		return fmt.Errorf(tr("tidyRenamePattern must contain {name} and no path separators.\n"))
+	}
+	if c.MaxOutput != "" {
+		if _, err := parseSize(c.MaxOutput); err != nil {
+			return fmt.Errorf("maxOutput: %w", err)
+		}
+	}
+	switch c.ResolveOrder {
+	case "", RESOLVE_INDEX, RESOLVE_FILE:
+	default:
+		return fmt.Errorf(tr("resolveOrder must be %s or %s.\n"), RESOLVE_INDEX, RESOLVE_FILE)
+	}
+	switch c.Summary {
+	case "", SUMMARY_NEVER, SUMMARY_ON_FAILURE, SUMMARY_ALWAYS:
+	default:
+		return fmt.Errorf(tr("summary must be %s, %s or %s.\n"), SUMMARY_NEVER, SUMMARY_ON_FAILURE, SUMMARY_ALWAYS)
+	}
+	if c.ReceiptsFile != "" && !filepath.IsAbs(c.ReceiptsFile) {
+		return fmt.Errorf(tr("receiptsFile must be an absolute path.\n"))
+	}
+	if c.OnExitAfter != "" {
+		if _, err := parseDuration(c.OnExitAfter); err != nil {
+			return fmt.Errorf("onExitAfter: %w", err)
+		}
+	}
+	if c.MetricsCmd != "" && !filepath.IsAbs(c.MetricsCmd) {
+		return fmt.Errorf(tr("metricsCmd must be an absolute path.\n"))
+	}
+	if c.StatsdAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdAddr); err != nil {
+			return fmt.Errorf("statsdAddr: %w", err)
+		}
+	}
+	if c.CatalogUrl != "" && !strings.HasPrefix(c.CatalogUrl, "https://") {
+		return fmt.Errorf(tr("catalogUrl must be an HTTPS URL.\n"))
+	}
+	if c.AgeIdentity != "" {
+		if !filepath.IsAbs(c.AgeIdentity) {
+			return fmt.Errorf(tr("ageIdentity must be an absolute path.\n"))
+		}
+		if _, err := os.Stat(c.AgeIdentity); err != nil {
+			return fmt.Errorf("ageIdentity: %w", err)
+		}
+	}
+	if err := validateProfiles(c.Profiles); err != nil {
+		return err
+	}
+	if c.Language != "" {
+		supported := false
+		for _, lang := range languages() {
+			supported = supported || langCode(c.Language) == lang
+		}
+		if !supported {
+			return fmt.Errorf(tr("Unsupported language %q, use one of: %s\n"), c.Language, strings.Join(languages(), ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleCP       = kernel32.NewProc("GetConsoleCP")
+	procSetConsoleCP       = kernel32.NewProc("SetConsoleCP")
+	procGetConsoleOutputCP = kernel32.NewProc("GetConsoleOutputCP")
+	procSetConsoleOutputCP = kernel32.NewProc("SetConsoleOutputCP")
+	procGetFileInfoEx      = kernel32.NewProc("GetFileInformationByHandleEx")
+)
+
+const cpUTF8 = 65001
+
+// setConsoleUTF8 switches the console to UTF-8 while a script runs, so that
+// its non-ASCII output is not garbled by the OEM code page. The returned
+// function restores the previous code pages. Without a console, this does
+// nothing.
+func setConsoleUTF8() (restore func()) {
+	in, _, _ := procGetConsoleCP.Call()
+	out, _, _ := procGetConsoleOutputCP.Call()
+	if in == 0 || out == 0 { // no console attached
+		return func() {}
+	}
+	procSetConsoleCP.Call(cpUTF8)
+	procSetConsoleOutputCP.Call(cpUTF8)
+	return func() {
+		procSetConsoleCP.Call(in)
+		procSetConsoleOutputCP.Call(out)
+	}
+}
+
+// fileNameInfo is the FILE_NAME_INFO class of GetFileInformationByHandleEx.
+const fileNameInfo = 2
+
+// isPtyPipe reports whether f is the terminal of mintty, the terminal of Git
+// Bash and Cygwin. It is no console but a named pipe, like
+// \msys-1888ae32e00d56aa-pty0-from-master, so that prompts would be skipped
+// in Git Bash although they are shown in cmd.exe and PowerShell.
+func isPtyPipe(f *os.File) bool {
+	if ft, err := syscall.GetFileType(syscall.Handle(f.Fd())); err != nil || ft != syscall.FILE_TYPE_PIPE {
+		return false
+	}
+	// FILE_NAME_INFO: the length in bytes, followed by the UTF-16 name
+	buf := make([]uint16, 2+syscall.MAX_PATH)
+	r, _, _ := procGetFileInfoEx.Call(f.Fd(), fileNameInfo, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)*2))
+	if r == 0 {
+		return false
+	}
+	n := int(*(*uint32)(unsafe.Pointer(&buf[0]))) / 2
+	if n > len(buf)-2 {
+		n = len(buf) - 2
+	}
+	name := string(utf16.Decode(buf[2 : 2+n]))
+	return (strings.HasPrefix(name, `\msys-`) || strings.HasPrefix(name, `\cygwin-`)) &&
+		strings.Contains(name, "-pty")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const DIR_CONTEXT_FILE = ".run-context"
+
+// dirContext are the settings of a project folder and everything below it,
+// read from its DIR_CONTEXT_FILE, f. e.
+//
+//	{"namespace": "foo", "env": ["KUBE_CONTEXT=foo"], "tags": ["foo"]}
+type dirContext struct {
+	// Namespace is tried first for the names of commands without one, so
+	// that run deploy runs foo:deploy, if it exists.
+	Namespace string `json:"namespace,omitempty"`
+	// Env is set for every command, KEY=VALUE. It overrides the environment
+	// stored with -mod, but not the profile and parameters.
+	Env []string `json:"env,omitempty"`
+	// Tags are given to the commands registered with -new.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// activeDirContext is the context of the working directory, nil without.
+var activeDirContext *dirContext
+
+// loadDirContext makes the DIR_CONTEXT_FILE nearest to the working directory
+// the active one. On unix, a file everybody may write is ignored, since its
+// variables would reach every command.
+func loadDirContext() error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil // f. e. the working directory was removed
+	}
+	for dp := wd; ; dp = filepath.Dir(dp) {
+		fp := filepath.Join(dp, DIR_CONTEXT_FILE)
+		// unreadable folders above the working directory are passed over
+		if fi, err := os.Stat(fp); err == nil && !fi.IsDir() {
+			if runtime.GOOS != "windows" && fi.Mode().Perm()&0o002 != 0 {
+				fmt.Fprintf(os.Stderr, tr("run: ignoring %s, everybody may write it.\n"), fp)
+				return nil
+			}
+			return readDirContext(fp)
+		}
+		if filepath.Dir(dp) == dp {
+			return nil
+		}
+	}
+}
+
+// readDirContext reads and checks the context of fp.
+func readDirContext(fp string) error {
+	raw, err := os.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	var ctx dirContext
+	if err := json.Unmarshal(raw, &ctx); err != nil {
+		return fmt.Errorf(tr("%s is no valid context: %w\n"), fp, err)
+	}
+	if ctx.Namespace != "" {
+		if err := checkName(ctx.Namespace); err != nil || strings.Contains(ctx.Namespace, ":") {
+			return fmt.Errorf(tr("%s: invalid namespace %q.\n"), fp, ctx.Namespace)
+		}
+	}
+	for _, kv := range ctx.Env {
+		if i := strings.IndexByte(kv, '='); i <= 0 {
+			return fmt.Errorf(tr("%s: %q is no KEY=VALUE.\n"), fp, kv)
+		}
+	}
+	trace("directory context: %s", fp)
+	activeDirContext = &ctx
+	return nil
+}
+
+// dirContextEnv returns the variables of the active context.
+func dirContextEnv() []string {
+	if activeDirContext == nil {
+		return nil
+	}
+	return activeDirContext.Env
+}
+
+// contextName returns the name of the command name of the namespace of the
+// active context, if there is one, else name.
+func contextName(scriptDp, indexFp, name string) (string, error) {
+	if activeDirContext == nil || activeDirContext.Namespace == "" || strings.Contains(name, ":") {
+		return name, nil
+	}
+	full := activeDirContext.Namespace + ":" + name
+	var cmd jsonCmd
+	switch err := findRegistered(scriptDp, indexFp, full, &cmd); {
+	case err == nil:
+		trace("directory context: %s runs %s", name, full)
+		return full, nil
+	case errors.Is(err, CmdNotFoundErr):
+		return name, nil
+	default:
+		return "", err
+	}
+}
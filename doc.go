@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Formats of -doc.
+const (
+	DOC_MAN      = "man"
+	DOC_MARKDOWN = "md"
+)
+
+const USAGE_DOC = "Usage:\n\trun -doc <cmd> [--format man|md]\n\trun -doc --all --out <dir> [--format man|md]\n\nRenders the documentation of a command from its options: the description, the\narguments of its spec, the environment and programs it needs, its examples and\nvariants. man pages are written in roff, view one with\n\trun -doc deploy | man -l -\n--all writes a file per command and, for md, an index README.md into <dir>,\nf. e. to browse the commands of a shared registry.\n"
+
+// DocCmd prints or writes the reference of commands.
+func DocCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-doc")
+	format := fs.String("format", DOC_MARKDOWN, "")
+	all := fs.Bool("all", false, "")
+	out := fs.String("out", "", "")
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *all == (name != "") || *all && *out == "" ||
+		*format != DOC_MAN && *format != DOC_MARKDOWN {
+		return fmt.Errorf(tr(USAGE_DOC))
+	}
+
+	var cmds []jsonCmd
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		cmds = append(cmds, *cmd)
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	render := renderMarkdown
+	if *format == DOC_MAN {
+		render = renderMan
+	}
+
+	if !*all {
+		var cmd jsonCmd
+		if err := findRegistered(scriptDp, indexFp, name, &cmd); err != nil {
+			return err
+		}
+		doc := render(&cmd, variantsOf(cmds, cmd.Name))
+		if *out == "" {
+			_, err := os.Stdout.Write(doc)
+			return err
+		}
+		return os.WriteFile(*out, doc, 0644)
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	ext := ".md"
+	if *format == DOC_MAN {
+		ext = ".1"
+	}
+	var index bytes.Buffer
+	fmt.Fprintf(&index, "# %s\n\n| %s | %s |\n| --- | --- |\n", tr("Commands"), tr("Command"), tr("Description"))
+	for i := range cmds {
+		cmd := &cmds[i]
+		if err := os.WriteFile(filepath.Join(*out, cmd.Name+ext), render(cmd, variantsOf(cmds, cmd.Name)), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(&index, "| [%s](%s%s) | %s |\n", cmd.Name, cmd.Name, ext, mdEscape(firstLine(cmd.Meta.Description)))
+	}
+	if *format == DOC_MARKDOWN {
+		if err := os.WriteFile(filepath.Join(*out, "README.md"), index.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf(tr("Wrote the documentation of %d command(s) to %s.\n"), len(cmds), *out)
+	return nil
+}
+
+// variantsOf returns the commands which are variants of name.
+func variantsOf(cmds []jsonCmd, name string) []jsonCmd {
+	var variants []jsonCmd
+	for _, cmd := range cmds {
+		if cmd.Meta.VariantOf == name {
+			variants = append(variants, cmd)
+		}
+	}
+	return variants
+}
+
+// variantLine returns the command line of cmd the variant v stands for.
+func variantLine(cmd, v *jsonCmd) string {
+	args := v.Meta.DefaultArgs
+	// the defaults of cmd are passed by both
+	if len(args) >= len(cmd.Meta.DefaultArgs) && strings.Join(args[:len(cmd.Meta.DefaultArgs)], "\x00") == strings.Join(cmd.Meta.DefaultArgs, "\x00") {
+		args = args[len(cmd.Meta.DefaultArgs):]
+	}
+	return strings.TrimSpace(cmd.Name + " " + strings.Join(args, " "))
+}
+
+// synopsis returns the arguments of the command line of cmd, f. e.
+// "<cluster> [<region>] [<args>...]". Arguments without a name are numbered.
+func synopsis(cmd *jsonCmd) string {
+	m := &cmd.Meta
+	var words []string
+	n := 0
+	for _, a := range m.Args {
+		if a.Env != "" {
+			continue
+		}
+		if n < m.MinNumArgs {
+			words = append(words, "<"+a.Name+">")
+		} else {
+			words = append(words, "[<"+a.Name+">]")
+		}
+		n++
+	}
+	for ; n < m.MinNumArgs; n++ {
+		words = append(words, fmt.Sprintf("<arg%d>", n+1))
+	}
+	for ; n < m.MaxNumArgs; n++ {
+		words = append(words, fmt.Sprintf("[<arg%d>]", n+1))
+	}
+	if m.MaxNumArgs == -1 {
+		words = append(words, "[<args>...]")
+	}
+	return strings.Join(words, " ")
+}
+
+// argDoc describes an argument of the spec in one line.
+func argDoc(a *argSpec) string {
+	var parts []string
+	switch {
+	case len(a.Choices) > 0:
+		parts = append(parts, fmt.Sprintf(tr("one of %s"), strings.Join(a.Choices, ", ")))
+	case a.Type != "" && a.Type != "string":
+		parts = append(parts, a.Type)
+	}
+	if a.Env != "" {
+		parts = append(parts, fmt.Sprintf(tr("passed as $%s"), a.Env))
+	}
+	doc := strings.Join(parts, ", ")
+	if a.Description != "" {
+		if doc != "" {
+			doc = "(" + doc + ") "
+		}
+		doc += a.Description
+	}
+	return doc
+}
+
+// splitExample splits an example into the arguments and the explanation.
+func splitExample(example string) (args, text string) {
+	if i := strings.Index(example, " # "); i >= 0 {
+		return strings.TrimSpace(example[:i]), strings.TrimSpace(example[i+3:])
+	}
+	return strings.TrimSpace(example), ""
+}
+
+// docOptions lists the options of cmd worth knowing before running it.
+func docOptions(cmd *jsonCmd) []string {
+	m := &cmd.Meta
+	var opts []string
+	add := func(set bool, format string, a ...interface{}) {
+		if set {
+			opts = append(opts, fmt.Sprintf(tr(format), a...))
+		}
+	}
+	add(m.Workdir != "", "Runs in %s.", m.Workdir)
+	add(len(m.DefaultArgs) > 0, "Passes %s in front of the arguments.", strings.Join(m.DefaultArgs, " "))
+	add(m.Stdin != "" || m.StdinFile != "", "Reads a default input.")
+	add(m.Cooldown != "", "Refuses to run again within %s after a success.", m.Cooldown)
+	add(m.ExpectEvery != "", "Should succeed every %s.", m.ExpectEvery)
+	add(m.CleanEnv, "Starts with a clean environment.")
+	add(len(m.PathPrepend) > 0, "Puts %s in front of PATH.", strings.Join(m.PathPrepend, ", "))
+	add(m.Clip, "Copies its output to the clipboard.")
+	add(m.Filter != "", "Pipes its output through %s.", m.Filter)
+	add(m.Progress, "Shows the progress it reports as a bar.")
+	add(m.Validate != "", "Checks the arguments with %s first.", m.Validate)
+	add(len(m.Tags) > 0, "Tags: %s.", strings.Join(m.Tags, ", "))
+	return opts
+}
+
+// docEnv lists the variables set for the script, without their values, which
+// may be secret.
+func docEnv(cmd *jsonCmd) []string {
+	var env []string
+	for _, kv := range cmd.Meta.Env {
+		env = append(env, strings.SplitN(kv, "=", 2)[0])
+	}
+	sort.Strings(env)
+	return env
+}
+
+func renderMarkdown(cmd *jsonCmd, variants []jsonCmd) []byte {
+	var b bytes.Buffer
+	m := &cmd.Meta
+	fmt.Fprintf(&b, "# %s\n\n", cmd.Name)
+	if m.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", m.Description)
+	}
+	fmt.Fprintf(&b, "## %s\n\n```\nrun %s\n```\n", tr("Synopsis"), strings.TrimSpace(cmd.Name+" "+synopsis(cmd)))
+	if len(m.Args) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", tr("Arguments"))
+		for i := range m.Args {
+			fmt.Fprintf(&b, "- %s\n", strings.TrimSpace("`"+m.Args[i].Name+"` "+argDoc(&m.Args[i])))
+		}
+	}
+	if env := docEnv(cmd); len(env) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n\n", tr("Environment"), tr("The script is run with these variables set:"))
+		for _, key := range env {
+			fmt.Fprintf(&b, "- `%s`\n", key)
+		}
+	}
+	if len(m.RequiresBin) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", tr("Requirements"))
+		for _, bin := range m.RequiresBin {
+			if hint := m.InstallHints[bin]; hint != "" {
+				fmt.Fprintf(&b, "- `%s`: `%s`\n", bin, hint)
+			} else {
+				fmt.Fprintf(&b, "- `%s`\n", bin)
+			}
+		}
+	}
+	if opts := docOptions(cmd); len(opts) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", tr("Behavior"))
+		for _, opt := range opts {
+			fmt.Fprintf(&b, "- %s\n", opt)
+		}
+	}
+	if len(m.Notes) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", tr("Notes"))
+		for _, note := range m.Notes {
+			fmt.Fprintf(&b, "- %s\n", note)
+		}
+	}
+	if len(m.Examples) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", tr("Examples"))
+		for _, example := range m.Examples {
+			args, text := splitExample(example)
+			if text != "" {
+				fmt.Fprintf(&b, "%s:\n\n", text)
+			}
+			fmt.Fprintf(&b, "```\nrun %s\n```\n\n", strings.TrimSpace(cmd.Name+" "+args))
+		}
+		b.Truncate(b.Len() - 1)
+	}
+	if len(variants) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", tr("Variants"))
+		for _, v := range variants {
+			fmt.Fprintf(&b, "- `%s` = `run %s`\n", v.Name, variantLine(cmd, &v))
+		}
+	}
+	return b.Bytes()
+}
+
+func renderMan(cmd *jsonCmd, variants []jsonCmd) []byte {
+	var b bytes.Buffer
+	m := &cmd.Meta
+	fmt.Fprintf(&b, ".TH %s 1 \"\" run \"run commands\"\n", roffEscape(strings.ToUpper(cmd.Name)))
+	fmt.Fprintf(&b, ".SH NAME\n%s", roffEscape(cmd.Name))
+	if m.Description != "" {
+		fmt.Fprintf(&b, " \\- %s", roffEscape(firstLine(m.Description)))
+	}
+	fmt.Fprintf(&b, "\n.SH SYNOPSIS\n.B run %s\n%s\n", roffEscape(cmd.Name), roffEscape(synopsis(cmd)))
+	if strings.Contains(m.Description, "\n") {
+		fmt.Fprintf(&b, ".SH DESCRIPTION\n%s\n", roffEscape(m.Description))
+	}
+	if len(m.Args) > 0 {
+		b.WriteString(".SH ARGUMENTS\n")
+		for i := range m.Args {
+			fmt.Fprintf(&b, ".TP\n.B %s\n", roffEscape(m.Args[i].Name))
+			if doc := argDoc(&m.Args[i]); doc != "" {
+				fmt.Fprintf(&b, "%s\n", roffEscape(doc))
+			}
+		}
+	}
+	if env := docEnv(cmd); len(env) > 0 {
+		fmt.Fprintf(&b, ".SH ENVIRONMENT\n%s\n", roffEscape(tr("The script is run with these variables set:")))
+		for _, key := range env {
+			fmt.Fprintf(&b, ".TP\n.B %s\n", roffEscape(key))
+		}
+	}
+	if len(m.RequiresBin) > 0 {
+		b.WriteString(".SH REQUIREMENTS\n")
+		for _, bin := range m.RequiresBin {
+			fmt.Fprintf(&b, ".TP\n.B %s\n", roffEscape(bin))
+			if hint := m.InstallHints[bin]; hint != "" {
+				fmt.Fprintf(&b, "%s\n", roffEscape(hint))
+			}
+		}
+	}
+	if opts := docOptions(cmd); len(opts) > 0 {
+		b.WriteString(".SH BEHAVIOR\n")
+		for _, opt := range opts {
+			fmt.Fprintf(&b, ".IP \\(bu 2\n%s\n", roffEscape(opt))
+		}
+	}
+	if len(m.Notes) > 0 {
+		b.WriteString(".SH NOTES\n")
+		for _, note := range m.Notes {
+			fmt.Fprintf(&b, ".IP \\(bu 2\n%s\n", roffEscape(note))
+		}
+	}
+	if len(m.Examples) > 0 {
+		b.WriteString(".SH EXAMPLES\n")
+		for _, example := range m.Examples {
+			args, text := splitExample(example)
+			if text != "" {
+				fmt.Fprintf(&b, ".PP\n%s\n", roffEscape(text))
+			}
+			fmt.Fprintf(&b, ".PP\n.RS\n.B run %s\n.RE\n", roffEscape(strings.TrimSpace(cmd.Name+" "+args)))
+		}
+	}
+	if len(variants) > 0 {
+		b.WriteString(".SH VARIANTS\n")
+		for _, v := range variants {
+			fmt.Fprintf(&b, ".TP\n.B %s\nrun %s\n", roffEscape(v.Name), roffEscape(variantLine(cmd, &v)))
+		}
+	}
+	return b.Bytes()
+}
+
+// roffEscape escapes text for roff: backslashes, and dots and quotes starting
+// a line, which would be requests.
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mdEscape escapes text for a cell of a Markdown table.
+func mdEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// firstLine returns the first line of s.
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// finding is a problem detected by -doctor.
+type finding struct {
+	Severity string `json:"severity"`          // "error" or "warning"
+	Command  string `json:"command,omitempty"` // empty for problems of the registry itself
+	Message  string `json:"message"`
+}
+
+const USAGE_DOCTOR = "Usage:\n\trun -doctor [--json] [--strict]\n\nExits with 1 if errors are found, with --strict also if warnings are found.\n"
+
+// DoctorCmd checks the health of the registry: the index must be readable,
+// every script must exist, and commands with an expected cadence must have
+// succeeded within it.
+func DoctorCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-doctor")
+	asJson := fs.Bool("json", false, "")
+	strict := fs.Bool("strict", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_DOCTOR))
+	}
+	findings, err := diagnose(scriptDp, indexFp)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *asJson:
+		if findings == nil {
+			findings = []finding{}
+		}
+		raw, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(raw))
+	case len(findings) == 0:
+		fmt.Println(tr("No problems found."))
+	}
+	failed := false
+	for _, f := range findings {
+		failed = failed || f.Severity == "error" || *strict
+		if *asJson {
+			continue
+		}
+		if f.Command == "" {
+			fmt.Printf("%-8s %s\n", f.Severity, f.Message)
+		} else {
+			fmt.Printf("%-8s %s: %s\n", f.Severity, f.Command, f.Message)
+		}
+	}
+	if failed {
+		return &SilentExit{Code: 1}
+	}
+	return nil
+}
+
+func diagnose(scriptDp, indexFp string) ([]finding, error) {
+	var findings []finding
+
+	last, err := lastSuccesses(scriptDp)
+	if err != nil {
+		findings = append(findings, finding{"warning", "", fmt.Sprintf("Cannot read history: %s", err)})
+	}
+	now := time.Now()
+
+	var check findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		if unavailable(cmd) != "" {
+			// f. e. a synced Linux-only command on a Mac, which has no script
+			return
+		}
+		if isBrokenLink(cmd.Script) {
+			findings = append(findings, finding{"error", cmd.Name, fmt.Sprintf("script %s is a broken symlink to %s", cmd.Script, linkTarget(cmd.Script))})
+		} else if _, err := os.Stat(cmd.Script); err != nil {
+			findings = append(findings, finding{"error", cmd.Name, fmt.Sprintf("script %s: %s", cmd.Script, err)})
+		}
+		for goos, script := range cmd.Meta.ScriptOverrides {
+			if goos != runtime.GOOS {
+				continue
+			}
+			if isBrokenLink(script) {
+				findings = append(findings, finding{"error", cmd.Name, fmt.Sprintf("%s script %s is a broken symlink to %s", goos, script, linkTarget(script))})
+			} else if _, err := os.Stat(script); err != nil {
+				findings = append(findings, finding{"error", cmd.Name, fmt.Sprintf("%s script %s: %s", goos, script, err)})
+			}
+		}
+		if missing := missingBins(scriptDp, cmd); len(missing) > 0 {
+			findings = append(findings, finding{"warning", cmd.Name, fmt.Sprintf("requires %s, not found in PATH", strings.Join(missing, ", "))})
+		}
+		if stale := staleness(cmd, last, now, untranslated); stale != "" {
+			findings = append(findings, finding{"warning", cmd.Name, "stale, " + stale})
+		}
+		return
+	}
+	if err := findOperation(indexFp, check); err != nil {
+		findings = append(findings, finding{"error", "", fmt.Sprintf("Index %s is broken: %s", indexFp, err)})
+	} else if raw, err := readIndex(indexFp); err == nil {
+		for _, w := range unknownFields(raw) {
+			findings = append(findings, finding{"warning", "", w})
+		}
+	}
+	return findings, nil
+}
+
+// untranslated keeps a message in English.
+func untranslated(s string) string {
+	return s
+}
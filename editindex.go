@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const USAGE_EDIT_INDEX = "Usage:\n\trun -edit-index\n\nOpens a copy of the index in $VISUAL or $EDITOR. The index is only replaced if\nthe copy is valid.\n"
+
+// EditIndexCmd lets the user edit a copy of the index. After the editor exits,
+// the copy is validated; on errors the user may edit it again. A valid copy
+// atomically replaces the index.
+func EditIndexCmd(indexFp string, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf(tr(USAGE_EDIT_INDEX))
+	}
+	orig, err := readIndex(indexFp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "cmd_mappings-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(orig)
+	closeFile(tmp, &err)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := openEditor(tmp.Name()); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, orig) {
+			fmt.Println(tr("No changes."))
+			return nil
+		}
+		cmds, err := validateIndex(tmp.Name(), edited)
+		if err == nil {
+			return writeIndex(indexFp, cmds)
+		}
+		fmt.Println(err)
+		if !confirm(tr("Edit again?")) {
+			return fmt.Errorf(tr("The index was not changed.\n"))
+		}
+	}
+}
+
+// openEditor opens fp in $VISUAL, else $EDITOR, else vi or notepad. The
+// variables may contain arguments, f. e. "code --wait".
+func openEditor(fp string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	fields := strings.Fields(editor)
+	exe := exec.Command(fields[0], append(fields[1:], fp)...)
+	exe.Stdin, exe.Stdout, exe.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return exe.Run()
+}
+
+// validateIndex parses raw, the content of fp, as index and checks every
+// command. The error lists all problems found.
+func validateIndex(fp string, raw []byte) ([]jsonCmd, error) {
+	var cmds []jsonCmd
+	dec := newIndexDecoder(bytes.NewReader(raw), fp)
+	dec.raw = raw
+	if err := dec.Open(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		var cmd jsonCmd
+		if err := dec.Next(&cmd); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	if err := dec.Close(); err != nil {
+		return nil, err
+	}
+	for _, w := range unknownFields(raw) {
+		fmt.Println(tr("Warning:"), w)
+	}
+	for i := range cmds {
+		cmds[i].absPaths()
+	}
+
+	var problems []string
+	report := func(name, format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%q: ", name)+fmt.Sprintf(tr(format), a...))
+	}
+	names := make(map[string]bool, len(cmds))
+	for i := range cmds {
+		cmd := &cmds[i]
+		switch {
+		case cmd.Name == "":
+			report(cmd.Name, "commandName must not be empty")
+		case names[cmd.Name]:
+			report(cmd.Name, "commandName is used twice")
+		case strings.HasPrefix(cmd.Name, "-"):
+			report(cmd.Name, "commandName must not start with -")
+		}
+		names[cmd.Name] = true
+		if cmd.Script == "" {
+			report(cmd.Name, "scriptName must not be empty")
+		}
+		m := &cmd.Meta
+		if m.MinNumArgs < 0 || m.MaxNumArgs < -1 || m.MaxNumArgs != -1 && m.MaxNumArgs < m.MinNumArgs {
+			report(cmd.Name, "minNumArgs %d and maxNumArgs %d do not fit", m.MinNumArgs, m.MaxNumArgs)
+		}
+		if _, err := codePage(m.Encoding); err != nil {
+			report(cmd.Name, "%s", strings.TrimSpace(err.Error()))
+		}
+		for _, d := range []string{m.ExpectEvery, m.Cooldown} {
+			if _, err := parseDuration(d); d != "" && err != nil {
+				report(cmd.Name, "%s", strings.TrimSpace(err.Error()))
+			}
+		}
+		if _, err := parseNice(fmt.Sprint(m.Nice)); err != nil {
+			report(cmd.Name, "%s", strings.TrimSpace(err.Error()))
+		}
+		if _, err := parseUmask(m.Umask); m.Umask != "" && err != nil {
+			report(cmd.Name, "%s", strings.TrimSpace(err.Error()))
+		}
+		for _, a := range m.Args {
+			if a.Type != "" && !contains(argTypes, a.Type) {
+				report(cmd.Name, "argument %s: type must be one of %s", a.Name, strings.Join(argTypes, ", "))
+			}
+		}
+		if _, err := parseSize(m.MaxOutput); m.MaxOutput != "" && err != nil {
+			report(cmd.Name, "%s", strings.TrimSpace(err.Error()))
+		}
+		if m.LogLevel != "" && !contains(logLevels, m.LogLevel) {
+			report(cmd.Name, "logLevel must be one of %s", strings.Join(logLevels, ", "))
+		}
+		if m.Stdin != "" && m.StdinFile != "" {
+			report(cmd.Name, "stdin and stdinFile must not both be set")
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return cmds, nil
+}
+
+/******************************************************************************/
+
+const USAGE_EDIT_META = "Usage:\n\trun -edit-meta <cmd>\n\nOpens the options of a command as JSON in $VISUAL or $EDITOR. They are only\nwritten back if they are valid; the rest of the index is left alone.\n"
+
+// EditMetaCmd lets the user edit the options of a single command, which is
+// safer than editing the whole index and friendlier than -mod.
+func EditMetaCmd(indexFp string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(tr(USAGE_EDIT_META))
+	}
+	name := args[0]
+	var cmd jsonCmd
+	if err := Find(indexFp, name, &cmd); err != nil {
+		return err
+	}
+	orig, err := json.MarshalIndent(&cmd.Meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	orig = append(orig, '\n')
+	tmp, err := os.CreateTemp("", name+"-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(orig)
+	closeFile(tmp, &err)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := openEditor(tmp.Name()); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, orig) {
+			fmt.Println(tr("No changes."))
+			return nil
+		}
+		m, err := validateMeta(&cmd, tmp.Name(), edited)
+		if err == nil {
+			var replace modFn = func(c *jsonCmd) (inc, esc bool, err error) {
+				if c.Name == name {
+					c.Meta = *m
+				}
+				return true, false, nil
+			}
+			return modOperation(indexFp, replace)
+		}
+		fmt.Println(err)
+		if !confirm(tr("Edit again?")) {
+			return fmt.Errorf(tr("The options of %s were not changed.\n"), name)
+		}
+	}
+}
+
+// validateMeta parses raw, the content of fp, as options of cmd and checks
+// them like the index. Unknown options are refused, they are likely typos.
+func validateMeta(cmd *jsonCmd, fp string, raw []byte) (*meta, error) {
+	m := meta{MaxNumArgs: -1}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %s", fp, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf(tr("%s: only one JSON object is expected.\n"), fp)
+	}
+	index, err := json.Marshal([]jsonCmd{{Name: cmd.Name, Script: cmd.Script, Meta: m}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := validateIndex(fp, index); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
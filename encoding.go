@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// codePages maps the upper half (0x80-0xFF) of single byte encodings to
+// unicode. The lower half is ASCII for all of them.
+var codePages = map[string]*[128]rune{
+	"cp437":  upperHalf("ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■\u00a0"),
+	"cp850":  upperHalf("ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜø£Ø×ƒáíóúñÑªº¿®¬½¼¡«»░▒▓│┤ÁÂÀ©╣║╗╝¢¥┐└┴┬├─┼ãÃ╚╔╩╦╠═╬¤ðÐÊËÈıÍÎÏ┘┌█▄¦Ì▀ÓßÔÒõÕµþÞÚÛÙýÝ¯´\u00ad±‗¾¶§÷¸°¨·¹³²■\u00a0"),
+	"cp1252": upperHalf("€�‚ƒ„…†‡ˆ‰Š‹Œ�Ž��‘’“”•–—˜™š›œ�žŸ" + string([]rune(latin1)[32:])),
+	"latin1": upperHalf(latin1),
+}
+
+// encodingAliases are alternative names of codePages.
+var encodingAliases = map[string]string{
+	"437":          "cp437",
+	"850":          "cp850",
+	"1252":         "cp1252",
+	"windows-1252": "cp1252",
+	"iso-8859-1":   "latin1",
+}
+
+var latin1 = func() string {
+	var sb strings.Builder
+	for r := rune(0x80); r <= 0xFF; r++ {
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}()
+
+func upperHalf(s string) *[128]rune {
+	var table [128]rune
+	i := 0
+	for _, r := range s {
+		table[i] = r
+		i++
+	}
+	if i != len(table) {
+		panic("code page table must have 128 entries") // programming error
+	}
+	return &table
+}
+
+// codePage returns the table of encoding. It returns a nil table for UTF-8,
+// which needs no conversion, and an error for unknown encodings.
+func codePage(encoding string) (*[128]rune, error) {
+	encoding = strings.ToLower(encoding)
+	if alias, ok := encodingAliases[encoding]; ok {
+		encoding = alias
+	}
+	switch encoding {
+	case "", "utf-8", "utf8":
+		return nil, nil
+	}
+	table, ok := codePages[encoding]
+	if !ok {
+		names := make([]string, 0, len(codePages))
+		for name := range codePages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unsupported encoding %q, use one of: utf-8, %s\n", encoding, strings.Join(names, ", "))
+	}
+	return table, nil
+}
+
+// decodeOutput makes the output of exe UTF-8, if the script writes in a legacy
+// encoding. An empty encoding or "utf-8" leaves the output untouched.
+func decodeOutput(exe *exec.Cmd, encoding string) error {
+	table, err := codePage(encoding)
+	if err != nil || table == nil {
+		return err
+	}
+	exe.Stdout = decodeWriter{os.Stdout, table}
+	exe.Stderr = decodeWriter{os.Stderr, table}
+	return nil
+}
+
+// decodeWriter converts a single byte encoding to UTF-8. Every byte is a
+// complete character, so writes can be converted independently.
+type decodeWriter struct {
+	w     io.Writer
+	table *[128]rune
+}
+
+func (d decodeWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)*2)
+	var enc [utf8.UTFMax]byte
+	for _, b := range p {
+		if b < 0x80 {
+			buf = append(buf, b)
+			continue
+		}
+		n := utf8.EncodeRune(enc[:], d.table[b-0x80])
+		buf = append(buf, enc[:n]...)
+	}
+	if _, err := d.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
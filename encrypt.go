@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// AGE_HEADER starts every file encrypted by age, https://age-encryption.org.
+const AGE_HEADER = "age-encryption.org/v1"
+
+// encryption holds the settings to encrypt the index with age. Encrypted
+// indexes and scripts are decrypted in any case, if age can.
+var encryption struct {
+	index    bool   // encrypt the index when it is written
+	identity string // age identity file, else a passphrase is asked
+}
+
+// setEncryption loads the encryption settings of -config.
+func setEncryption(scriptDp string) error {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	encryption.index = conf.EncryptIndex
+	encryption.identity = conf.AgeIdentity
+	if activeProfile != nil && activeProfile.AgeIdentity != "" {
+		encryption.identity = activeProfile.AgeIdentity
+	}
+	return nil
+}
+
+// isEncrypted reports whether the file starts with the age header.
+func isEncrypted(fp string) (bool, error) {
+	file, err := os.Open(fp)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	head := make([]byte, len(AGE_HEADER))
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return string(head[:n]) == AGE_HEADER, nil
+}
+
+// ageCmd runs age with args on input and returns its output. age asks for
+// passphrases on the terminal itself.
+func ageCmd(input io.Reader, args ...string) ([]byte, error) {
+	if encryption.identity != "" {
+		args = append(args, "-i", encryption.identity)
+	} else if args[0] == "--encrypt" {
+		args = append(args, "--passphrase")
+	}
+	if _, err := exec.LookPath("age"); err != nil {
+		return nil, fmt.Errorf(tr("Encryption needs age, see https://age-encryption.org.\n"))
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("age", args...)
+	cmd.Stdin = input
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf(tr("age failed: %s %s\n"), err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Bytes(), nil
+}
+
+// decryptedIndexes holds the plain text of the encrypted indexes read or
+// written by this process, by the hash of their cipher text. An index is read
+// several times by one call of run, f. e. by -mod, and each decryption may ask
+// for the passphrase.
+var decryptedIndexes = map[[sha256.Size]byte][]byte{}
+
+// readIndex returns the content of the index, decrypted in memory.
+func readIndex(indexFp string) ([]byte, error) {
+	raw, err := os.ReadFile(indexFp)
+	if err != nil || !bytes.HasPrefix(raw, []byte(AGE_HEADER)) {
+		return raw, err
+	}
+	key := sha256.Sum256(raw)
+	if plain, ok := decryptedIndexes[key]; ok {
+		return plain, nil
+	}
+	plain, err := ageCmd(bytes.NewReader(raw), "--decrypt")
+	if err != nil {
+		return nil, err
+	}
+	decryptedIndexes[key] = plain
+	return plain, nil
+}
+
+// openIndex opens the index for reading. An encrypted index is decrypted in
+// memory, the plain text never touches the disk.
+func openIndex(indexFp string) (io.ReadCloser, error) {
+	encrypted, err := isEncrypted(indexFp)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return os.Open(indexFp)
+	}
+	raw, err := readIndex(indexFp)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(raw)), nil
+}
+
+// decryptScript returns the path of the plain script. An encrypted script is
+// decrypted into a private temporary folder, which cleanup removes. Scripts are
+// executed from a file, thus cannot stay in memory. Run traps the signals
+// ending it, so that cleanup runs when the script was interrupted as well.
+func decryptScript(script string) (fp string, cleanup func(), err error) {
+	cleanup = func() {}
+	encrypted, err := isEncrypted(script)
+	if err != nil || !encrypted {
+		return script, cleanup, err
+	}
+	file, err := os.Open(script)
+	if err != nil {
+		return "", cleanup, err
+	}
+	defer file.Close()
+	plain, err := ageCmd(file, "--decrypt")
+	if err != nil {
+		return "", cleanup, err
+	}
+
+	dir, err := os.MkdirTemp("", "run-")
+	if err != nil {
+		return "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	// backup.sh.age => backup.sh, the extension selects the interpreter
+	fp = filepath.Join(dir, strings.TrimSuffix(filepath.Base(script), ".age"))
+	if err := os.WriteFile(fp, plain, 0700); err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return fp, cleanup, nil
+}
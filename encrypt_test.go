@@ -0,0 +1,80 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeAge puts an age into PATH which "encrypts" by prepending the header and
+// counts its decryptions in the returned file.
+func fakeAge(t *testing.T) (countFp string) {
+	dir := t.TempDir()
+	countFp = filepath.Join(dir, "decryptions")
+	script := `#!/bin/sh
+if [ "$1" = --decrypt ]; then
+	echo >> "` + countFp + `"
+	tail -n +2
+else
+	echo ` + AGE_HEADER + `
+	cat
+fi
+`
+	if err := os.WriteFile(filepath.Join(dir, "age"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+	return countFp
+}
+
+func TestEncryptedIndexDecryptedOnce(t *testing.T) {
+	countFp := fakeAge(t)
+	decryptions := func() int {
+		raw, _ := os.ReadFile(countFp)
+		return strings.Count(string(raw), "\n")
+	}
+	defer func(index bool) { encryption.index = index }(encryption.index)
+	encryption.index = true
+	decryptedIndexes = map[[32]byte][]byte{}
+
+	indexFp := filepath.Join(t.TempDir(), INDEX_FILE)
+	if err := writeIndex(indexFp, []jsonCmd{{Name: "b", Script: "/b.sh"}, {Name: "a", Script: "/a.sh"}}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := isEncrypted(indexFp); !ok {
+		t.Fatal("index is not encrypted")
+	}
+	// written by this process, thus known
+	var cmd jsonCmd
+	if err := Find(indexFp, "b", &cmd); err != nil || cmd.Script != "/b.sh" {
+		t.Fatalf("Find(b) = %v, %+v", err, cmd)
+	}
+	if n := decryptions(); n != 0 {
+		t.Errorf("the index written was decrypted %d times", n)
+	}
+
+	decryptedIndexes = map[[32]byte][]byte{}
+	for _, name := range []string{"a", "b", "a"} {
+		if err := Find(indexFp, name, &cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := modifyOne(indexFp, "a", func(cmd *jsonCmd) error {
+		cmd.Meta.Encoding = "cp850"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Find(indexFp, "a", &cmd); err != nil || cmd.Meta.Encoding != "cp850" {
+		t.Fatalf("Find(a) = %v, %+v", err, cmd)
+	}
+	if n := decryptions(); n != 1 {
+		t.Errorf("the index was decrypted %d times, want once", n)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const USAGE_ENV = "Usage:\n\trun -env <cmd> [--params <file>] [-i] [--clean-env] [--plain-output] [--verbose|--quiet] [<args>...]\n\nPrints the environment the script of <cmd> would receive with these options,\none variable per line with where it comes from: inherited from the shell, the\ncontext of run, the options of the command, the profile or the arguments. The\nscript is not run. Values of variables whose names suggest secrets, f. e.\nTOKEN or PASSWORD, are masked.\n"
+
+// secretName matches the names of variables which likely hold secrets.
+var secretName = regexp.MustCompile(`(?i)SECRET|TOKEN|PASSWORD|PASSWD|PASSPHRASE|CREDENTIAL|PRIVATE|API_?KEY|ACCESS_?KEY|AUTH|COOKIE|SESSION|AGE_IDENTITY`)
+
+// EnvCmd shows the environment of a script to debug failures caused by it,
+// without editing the script to print it.
+func EnvCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf(tr(USAGE_ENV))
+	}
+	name, err := contextName(scriptDp, indexFp, args[0])
+	if err != nil {
+		return err
+	}
+	flags, scriptArgs, err := parseRunFlags(args[1:])
+	if err != nil {
+		return err
+	}
+	scriptArgs, argEnv, err := specArgs(scriptDp, indexFp, name, &flags, scriptArgs)
+	if err != nil {
+		return err
+	}
+	entry, cmd, err := getCommand(scriptDp, append([]string{name}, scriptArgs...), indexFp)
+	if err != nil {
+		return err
+	}
+	stack, err := callStack(scriptDp, name)
+	if err != nil {
+		return err
+	}
+	ctxEnv, err := contextEnv(scriptDp, name, cmd[0], stack, logLevel(entry, &flags))
+	if err != nil {
+		return err
+	}
+	// pinned programs are not downloaded just to show the environment
+	tools, err := provideTools(scriptDp, entry, false)
+	if err != nil {
+		return err
+	}
+	ctxEnv = append(ctxEnv, toolPathEnv(tools)...)
+
+	type variable struct {
+		key, value, source string
+		overrides          []string
+	}
+	vars := make(map[string]*variable)
+	for _, layer := range scriptEnv(entry, &flags, ctxEnv, argEnv) {
+		for _, kv := range layer.env {
+			kv := strings.SplitN(kv, "=", 2)
+			if len(kv) < 2 {
+				continue
+			}
+			id := kv[0]
+			if runtime.GOOS == "windows" {
+				id = strings.ToUpper(id) // Windows ignores the case of names
+			}
+			v := &variable{key: kv[0], value: kv[1], source: tr(layer.source)}
+			if prev, ok := vars[id]; ok {
+				v.overrides = append(prev.overrides, prev.source)
+			}
+			vars[id] = v
+		}
+	}
+	ids := make([]string, 0, len(vars))
+	for id := range vars {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		v := vars[id]
+		value := strings.ReplaceAll(v.value, "\n", `\n`)
+		if value != "" && secretName.MatchString(v.key) {
+			value = fmt.Sprintf(tr("<masked, %d characters>"), len(v.value))
+		}
+		fmt.Printf("%-10s %s=%s", v.source, v.key, value)
+		if len(v.overrides) > 0 {
+			fmt.Printf(tr(" (overrides %s)"), strings.Join(v.overrides, ", "))
+		}
+		fmt.Println()
+	}
+	return nil
+}
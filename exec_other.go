@@ -0,0 +1,119 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cleanEnvKeys are the variables kept by cleanEnv. Plan 9 names them in
+// lower case.
+var cleanEnvKeys = []string{"PATH", "HOME", "LANG", "path", "home"}
+
+// prepareExec is a no-op on unix. execve passes every argument byte-for-byte,
+// no shell is involved.
+func prepareExec(exe *exec.Cmd) error {
+	return nil
+}
+
+// setConsoleUTF8 is a no-op on unix, terminals are configured through the
+// locale.
+func setConsoleUTF8() (restore func()) {
+	return func() {}
+}
+
+// isPtyPipe is false on unix, terminals are character devices.
+func isPtyPipe(f *os.File) bool {
+	return false
+}
+
+// shellCmd returns a command running line in the shell, f. e. a filter like
+// "jq .". Plan 9 has rc instead of sh.
+func shellCmd(line string) *exec.Cmd {
+	if runtime.GOOS == "plan9" {
+		return exec.Command("rc", "-c", line)
+	}
+	return exec.Command("sh", "-c", line)
+}
+
+// lineBuffered runs the script through stdbuf, where it exists (GNU), so that
+// programs using stdio flush every line although their output is no terminal.
+func lineBuffered(exe *exec.Cmd) {
+	if path, err := exec.LookPath("stdbuf"); err == nil {
+		exe.Args = append([]string{path, "-oL", "-eL", exe.Path}, exe.Args[1:]...)
+		exe.Path = path
+	}
+}
+
+// interpreterCmd returns the command line to execute script with. Termux on
+// Android has no /bin or /usr/bin, the interpreters live under $PREFIX. If the
+// interpreter of the shebang does not exist, but does below $PREFIX, it is
+// invoked directly with the script, f. e.
+// #!/bin/bash => /data/data/com.termux/files/usr/bin/bash script args...
+// Otherwise the script is executed as is.
+func interpreterCmd(script string, args []string) []string {
+	cmd := append([]string{script}, args...)
+	prefix := os.Getenv("PREFIX")
+	if prefix == "" {
+		return cmd
+	}
+
+	file, err := os.Open(script)
+	if err != nil {
+		return cmd
+	}
+	defer file.Close()
+	line, _ := bufio.NewReader(file).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return cmd
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return cmd
+	}
+	interp := fields[0]
+	if _, err := os.Stat(interp); err == nil {
+		return cmd
+	}
+
+	rel := strings.TrimPrefix(interp, "/usr")
+	if !strings.HasPrefix(rel, "/bin/") {
+		return cmd
+	}
+	local := filepath.Join(prefix, rel)
+	if _, err := os.Stat(local); err != nil {
+		return cmd
+	}
+	return append(append([]string{local}, fields[1:]...), cmd...)
+}
+
+// applyPriority runs the script through nice, and for low priority also
+// through ionice with the idle class where it exists (Linux). Both are
+// inherited by all children of the script.
+func applyPriority(exe *exec.Cmd, nice int, low bool) error {
+	if low && nice == 0 {
+		nice = 10
+	}
+	if low {
+		if ionice, err := exec.LookPath("ionice"); err == nil {
+			exe.Args = append([]string{ionice, "-c", "3", exe.Path}, exe.Args[1:]...)
+			exe.Path = ionice
+		}
+	}
+	if nice != 0 {
+		path, err := exec.LookPath("nice")
+		if err != nil {
+			return err
+		}
+		exe.Args = append([]string{path, "-n", strconv.Itoa(nice), exe.Path}, exe.Args[1:]...)
+		exe.Path = path
+	}
+	return nil
+}
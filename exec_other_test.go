@@ -0,0 +1,39 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArgumentsUnchanged(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "args")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nfor a; do printf '%s\\0' \"$a\"; done\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var args []string
+	for _, tt := range quoteArgTests {
+		args = append(args, tt.arg)
+	}
+	args = append(args, "*", "$HOME", "line\nbreak", "-")
+
+	line := interpreterCmd(script, args)
+	exe := exec.Command(line[0], line[1:]...)
+	if err := prepareExec(exe); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exe.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if !reflect.DeepEqual(got, args) {
+		t.Errorf("script received %q, want %q", got, args)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// cleanEnvKeys are the variables kept by cleanEnv. Without the system ones,
+// many programs fail to start on Windows.
+var cleanEnvKeys = []string{
+	"PATH", "PATHEXT", "USERPROFILE", "HOMEDRIVE", "HOMEPATH", "LANG",
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "TEMP", "TMP",
+}
+
+// prepareExec makes sure the arguments reach the script unchanged. Go quotes
+// arguments for the CommandLineToArgvW rules, which is right for .exe files,
+// but batch files are interpreted by cmd.exe and would expand %, ^, & and
+// friends. Thus, we build the cmd.exe command line ourselves.
+func prepareExec(exe *exec.Cmd) error {
+	switch strings.ToLower(filepath.Ext(exe.Path)) {
+	case ".bat", ".cmd":
+	default:
+		return nil
+	}
+
+	line := make([]string, 0, len(exe.Args))
+	line = append(line, cmdMetaChars.Replace(exe.Path))
+	for _, arg := range exe.Args[1:] {
+		// cmd.exe ends the command at a line break, there is no way to
+		// escape it.
+		if strings.ContainsAny(arg, "\r\n") {
+			return fmt.Errorf("Batch scripts cannot receive arguments containing line breaks: %q", arg)
+		}
+		// batch files parse the line twice, thus escape twice.
+		line = append(line, cmdMetaChars.Replace(cmdMetaChars.Replace(quoteArg(arg))))
+	}
+
+	comspec := os.Getenv("ComSpec")
+	if comspec == "" {
+		comspec = "cmd.exe"
+	}
+	path, err := exec.LookPath(comspec)
+	if err != nil {
+		return err
+	}
+	exe.Path = path
+	exe.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: fmt.Sprintf(`/d /s /c "%s"`, strings.Join(line, " ")),
+	}
+	return nil
+}
+
+// shellCmd returns a command running line in cmd.exe, f. e. a filter like
+// "sort". The line is passed as is, it is meant for cmd.exe.
+func shellCmd(line string) *exec.Cmd {
+	comspec := os.Getenv("ComSpec")
+	if comspec == "" {
+		comspec = "cmd.exe"
+	}
+	exe := exec.Command(comspec)
+	exe.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: fmt.Sprintf(`/d /s /c "%s"`, line),
+	}
+	return exe
+}
+
+// lineBuffered is a no-op on Windows, there is no stdbuf.
+func lineBuffered(exe *exec.Cmd) {}
+
+// interpreterCmd returns the command line to execute script with, see
+// windowsCmd. Thus the command behaves the same whether run was started from
+// cmd.exe, PowerShell or Git Bash.
+func interpreterCmd(script string, args []string) []string {
+	return windowsCmd(script, args, windowsLookups{
+		hasShebang: hasShebang,
+		powerShell: powerShell,
+		gitBash:    gitBash,
+	})
+}
+
+// powerShell returns pwsh, else the powershell.exe of Windows.
+func powerShell() string {
+	if ps, err := exec.LookPath("pwsh"); err == nil {
+		return ps
+	}
+	return "powershell.exe"
+}
+
+// gitBash returns the bash of Git for Windows, "" if there is none.
+func gitBash() string {
+	git, _ := exec.LookPath("git")
+	bash, _ := exec.LookPath("bash")
+	for _, fp := range gitBashCandidates(git, bash, os.Getenv) {
+		if fi, err := os.Stat(fp); err == nil && !fi.IsDir() {
+			return filepath.Clean(fp)
+		}
+	}
+	return ""
+}
+
+// Process priority classes of CreateProcess.
+const (
+	idlePriorityClass        = 0x00000040
+	belowNormalPriorityClass = 0x00004000
+	aboveNormalPriorityClass = 0x00008000
+	highPriorityClass        = 0x00000080
+)
+
+// applyPriority maps the unix nice value onto the priority classes of
+// Windows. Low priority is the idle class.
+func applyPriority(exe *exec.Cmd, nice int, low bool) error {
+	var class uint32
+	switch {
+	case low || nice >= 15:
+		class = idlePriorityClass
+	case nice > 0:
+		class = belowNormalPriorityClass
+	case nice <= -15:
+		class = highPriorityClass
+	case nice < 0:
+		class = aboveNormalPriorityClass
+	default:
+		return nil
+	}
+	if exe.SysProcAttr == nil {
+		exe.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	exe.SysProcAttr.CreationFlags |= class
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// outputFilter pipes the output of a script through a command line of the
+// shell, f. e. "jq ." or "column -t", before it reaches the terminal.
+type outputFilter struct {
+	line string
+	cmd  *exec.Cmd
+	w    *os.File // the output of the script
+}
+
+// startFilter starts the filter line and redirects the output of exe into it.
+// The filter writes where exe wrote before. The script writes into the pipe
+// directly, so it gets SIGPIPE if the filter exits early, like in a shell.
+func startFilter(exe *exec.Cmd, line string) (*outputFilter, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd := shellCmd(line)
+	cmd.Stdin = r
+	cmd.Stdout = exe.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	r.Close() // the filter has its own copy
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf(tr("Cannot start the filter %q: %s\n"), line, err)
+	}
+	exe.Stdout = w
+	return &outputFilter{line, cmd, w}, nil
+}
+
+// Wait closes the output of the script and waits for the filter to finish.
+// It is called after the script exited.
+func (f *outputFilter) Wait() error {
+	f.w.Close() // the filter reads to its end
+	if err := f.cmd.Wait(); err != nil {
+		return fmt.Errorf(tr("The filter %q failed: %s\n"), f.line, err)
+	}
+	return nil
+}
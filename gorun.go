@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	CACHE_DIR string = "cache"
+	BIN_DIR   string = "bin"
+)
+
+// scriptExecutable returns the file to execute for script. Go files are
+// compiled once into ~/.run/cache/bin, keyed by the hash of their content and
+// module files, so that only the first run after a change pays for the
+// compilation. All other scripts are executed directly. srcDir is the folder
+// of the registered script, which differs from the one of script if it was
+// decrypted.
+func scriptExecutable(scriptDp, script, srcDir string) (string, error) {
+	if !isGoScript(script) {
+		return script, nil
+	}
+
+	binFp, err := compiledPath(scriptDp, script, srcDir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(binFp); err == nil {
+		return binFp, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(binFp), 0750); err != nil {
+		return "", err
+	}
+	if mod := goModule(srcDir); mod != "" && filepath.Dir(script) != srcDir {
+		// the decrypted script is built with the module of the encrypted one
+		for _, fp := range []string{mod, goSum(mod)} {
+			if err := copyModuleFile(fp, filepath.Dir(script)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// build next to the final binary and rename, so that an interrupted
+	// build is never mistaken for a cached one.
+	tmpFp := binFp + ".tmp"
+	build := exec.Command("go", "build", "-o", tmpFp, filepath.Base(script))
+	build.Dir = filepath.Dir(script) // honor a go.mod next to the script
+	build.Stdout = os.Stderr
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		os.Remove(tmpFp)
+		return "", fmt.Errorf("Failed to compile %s: %w", script, err)
+	}
+	if err := os.Rename(tmpFp, binFp); err != nil {
+		return "", err
+	}
+	return binFp, nil
+}
+
+// isGoScript reports whether script is compiled by scriptExecutable.
+func isGoScript(script string) bool {
+	return strings.ToLower(filepath.Ext(script)) == ".go"
+}
+
+// compiledPath returns the file the Go script is compiled into on this
+// machine, whether it exists or not.
+func compiledPath(scriptDp, script, srcDir string) (string, error) {
+	src, err := os.ReadFile(script)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(src)
+	fmt.Fprintf(h, "\x00%s/%s", runtime.GOOS, runtime.GOARCH)
+	// a changed dependency changes the binary as well
+	if mod := goModule(srcDir); mod != "" {
+		for _, fp := range []string{mod, goSum(mod)} {
+			content, err := os.ReadFile(fp)
+			if err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+			h.Write([]byte{0})
+			h.Write(content)
+		}
+	}
+	name := hex.EncodeToString(h.Sum(nil))[:24]
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(baseDir(scriptDp), CACHE_DIR, BIN_DIR, name), nil
+}
+
+// goModule returns the go.mod of the module the Go files in dir belong to, ""
+// if there is none. Like go, it is searched in dir and its parents.
+func goModule(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		fp := filepath.Join(dir, "go.mod")
+		if fi, err := os.Stat(fp); err == nil && !fi.IsDir() {
+			return fp
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// goSum returns the go.sum belonging to the go.mod mod.
+func goSum(mod string) string {
+	return strings.TrimSuffix(mod, ".mod") + ".sum"
+}
+
+// copyModuleFile copies the module file fp into dir, if it exists.
+func copyModuleFile(fp, dir string) error {
+	content, err := os.ReadFile(fp)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, filepath.Base(fp)), content, 0600)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompiledPathModule(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sub", "hello.go")
+	if err := os.MkdirAll(filepath.Dir(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scriptDp := filepath.Join(dir, "cmd")
+	paths := map[string]string{}
+	for _, step := range []struct{ name, file, content string }{
+		{"without module", "", ""},
+		{"go.mod", "go.mod", "module example.com/hello\n\ngo 1.16\n"},
+		{"changed go.mod", "go.mod", "module example.com/hello\n\ngo 1.17\n"},
+		{"go.sum", "go.sum", "example.com/dep v1.0.0 h1:abc=\n"},
+	} {
+		if step.file != "" {
+			if err := os.WriteFile(filepath.Join(dir, step.file), []byte(step.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fp, err := compiledPath(scriptDp, script, filepath.Dir(script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev, ok := paths[fp]; ok {
+			t.Errorf("%s has the same binary as %s", step.name, prev)
+		}
+		paths[fp] = step.name
+	}
+}
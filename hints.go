@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const HINTS_FILE string = "hints.json"
+
+// Levels of the hints setting. The default "" is HINTS_ALWAYS.
+const (
+	HINTS_ALWAYS = "always"
+	HINTS_ONCE   = "once"
+	HINTS_OFF    = "off"
+)
+
+// Hints guide newcomers, f. e. when a script is run which is not registered.
+// Every hint has an id to remember that it was shown with the level "once".
+const (
+	HINT_UNREGISTERED = "unregistered"
+	HINT_FOLDERS      = "folders"
+)
+
+func hintsFp(scriptDp string) string {
+	return filepath.Join(baseDir(scriptDp), HINTS_FILE)
+}
+
+// hint prints the translated message as hint id, unless the config turns hints
+// off or, with "once", the hint was already shown.
+func hint(scriptDp, id, format string, a ...interface{}) {
+	conf, err := loadConfig(scriptDp)
+	if err != nil || conf.Hints == HINTS_OFF {
+		return
+	}
+	if conf.Hints == HINTS_ONCE {
+		shown := make(map[string]bool)
+		if raw, err := os.ReadFile(hintsFp(scriptDp)); err == nil {
+			_ = json.Unmarshal(raw, &shown)
+		}
+		if shown[id] {
+			return
+		}
+		shown[id] = true
+		if raw, err := json.Marshal(shown); err == nil {
+			_ = os.WriteFile(hintsFp(scriptDp), append(raw, '\n'), 0640)
+		}
+	}
+	fmt.Printf(tr(format), a...)
+}
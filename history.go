@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const HISTORY_FILE string = "history.jsonl"
+
+// historyEntry is a single execution of a command. The history file holds one
+// JSON object per line, so that appending is cheap and a crash can at most
+// break the last line.
+type historyEntry struct {
+	Name   string   `json:"name"`
+	Script string   `json:"script"`
+	Args   []string `json:"args,omitempty"`
+	// RunArgs are the arguments given to run after the name, including run's
+	// flags, but without stored default arguments. They repeat the execution.
+	RunArgs    []string  `json:"runArgs"`
+	Start      time.Time `json:"start"` // local time, including the zone offset
+	DurationMs int64     `json:"durationMs"`
+	ExitCode   int       `json:"exitCode"`
+	// InvocationID is the $RUN_INVOCATION_ID of the execution.
+	InvocationID string `json:"invocationId,omitempty"`
+}
+
+func (e *historyEntry) Succeeded() bool {
+	return e.ExitCode == 0
+}
+
+// historyFp returns ~/.run/history.jsonl. The history is shared by all
+// platforms, i. e. when the home is shared between WSL and Windows.
+func historyFp(scriptDp string) string {
+	return filepath.Join(baseDir(scriptDp), HISTORY_FILE)
+}
+
+// lockHistory serializes the writers of the history across run processes, so
+// that no entry is appended to a file which a prune is about to replace. The
+// history is not locked where locks are not supported.
+func lockHistory(scriptDp string) (release func(), err error) {
+	if !lockSupported {
+		return func() {}, nil
+	}
+	dir := filepath.Join(baseDir(scriptDp), LOCK_DIR)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	fp := filepath.Join(dir, "history")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		release, ok, err := tryLock(fp)
+		if err != nil || ok {
+			return release, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf(tr("The history is locked by another run process, remove %s if there is none.\n"), fp)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func appendHistory(scriptDp string, entry *historyEntry) (err error) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	release, err := lockHistory(scriptDp)
+	if err != nil {
+		return err
+	}
+	defer release()
+	file, err := os.OpenFile(historyFp(scriptDp), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer closeFile(file, &err)
+	_, err = file.Write(append(raw, '\n'))
+	return err
+}
+
+// readHistory calls fn for every entry of the history, oldest first. Lines
+// which cannot be parsed, f. e. a line cut short by a crash, are skipped.
+func readHistory(scriptDp string, fn func(entry *historyEntry) (esc bool)) error {
+	file, err := os.Open(historyFp(scriptDp))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // args can be long
+	for sc.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			continue
+		}
+		if fn(&entry) {
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+// lastSuccesses returns the time of the latest successful execution of every
+// command in the history.
+func lastSuccesses(scriptDp string) (map[string]time.Time, error) {
+	last := make(map[string]time.Time)
+	err := readHistory(scriptDp, func(entry *historyEntry) bool {
+		if entry.Succeeded() && entry.Start.After(last[entry.Name]) {
+			last[entry.Name] = entry.Start
+		}
+		return false
+	})
+	return last, err
+}
+
+// lastRuns returns the time of the latest execution of every command in the
+// history, successful or not.
+func lastRuns(scriptDp string) (map[string]time.Time, error) {
+	last := make(map[string]time.Time)
+	err := readHistory(scriptDp, func(entry *historyEntry) bool {
+		if entry.Start.After(last[entry.Name]) {
+			last[entry.Name] = entry.Start
+		}
+		return false
+	})
+	return last, err
+}
+
+/******************************************************************************/
+
+// checkCooldown returns an error if cmd succeeded within its cooldown.
+func checkCooldown(scriptDp string, cmd *jsonCmd) error {
+	if cmd.Meta.Cooldown == "" {
+		return nil
+	}
+	cooldown, err := parseDuration(cmd.Meta.Cooldown)
+	if err != nil {
+		return err
+	}
+	last, err := lastSuccesses(scriptDp)
+	if err != nil {
+		return err
+	}
+	if t, ok := last[cmd.Name]; ok && time.Since(t) < cooldown {
+		return fmt.Errorf(tr("%s succeeded %s ago, its cooldown is %s. To run it anyway:\n\trun %s --force ...\n"), cmd.Name, formatDuration(time.Since(t)), cmd.Meta.Cooldown, cmd.Name)
+	}
+	return nil
+}
+
+// staleness returns a description of why cmd is stale, or "" if it is not. A
+// command is stale if it declares an expected cadence and did not succeed
+// within it. The description is translated with t, -doctor keeps its
+// messages in English.
+func staleness(cmd *jsonCmd, last map[string]time.Time, now time.Time, t func(string) string) string {
+	if cmd.Meta.ExpectEvery == "" {
+		return ""
+	}
+	every, err := parseDuration(cmd.Meta.ExpectEvery)
+	if err != nil {
+		return fmt.Sprintf(t("invalid expectEvery %q"), cmd.Meta.ExpectEvery)
+	}
+	at, ok := last[cmd.Name]
+	if !ok {
+		return fmt.Sprintf(t("expected every %s, never succeeded"), cmd.Meta.ExpectEvery)
+	}
+	if now.Sub(at) <= every {
+		return ""
+	}
+	return fmt.Sprintf(t("expected every %s, last success %s (%s ago)"),
+		cmd.Meta.ExpectEvery, at.Local().Format("2006-01-02 15:04 MST"), formatDuration(now.Sub(at)))
+}
+
+// parseDuration extends time.ParseDuration with the units d (days) and w
+// (weeks), which are the common ones for scheduled scripts.
+func parseDuration(s string) (time.Duration, error) {
+	for unit, d := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, unit) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(s, unit), 64)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n * float64(d)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, err
+}
+
+// formatDuration rounds d to a unit suitable for humans.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
+
+/******************************************************************************/
+
+const HISTORY_PRUNED_FILE string = "history.pruned"
+
+// pruneHistory drops all but the latest maxEntries entries and entries older
+// than maxAge. Zero values disable the respective limit. It returns the number
+// of entries removed.
+func pruneHistory(scriptDp string, maxEntries int, maxAge time.Duration) (int, error) {
+	release, err := lockHistory(scriptDp)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	var keep []*historyEntry
+	total := 0
+	now := time.Now()
+	err = readHistory(scriptDp, func(entry *historyEntry) bool {
+		total++
+		if maxAge == 0 || now.Sub(entry.Start) <= maxAge {
+			keep = append(keep, entry)
+		}
+		return false
+	})
+	if err != nil {
+		return 0, err
+	}
+	if maxEntries > 0 && len(keep) > maxEntries {
+		keep = keep[len(keep)-maxEntries:]
+	}
+	if len(keep) == total {
+		return 0, nil
+	}
+
+	fp := historyFp(scriptDp)
+	tmpFp := fp + ".tmp"
+	file, err := os.OpenFile(tmpFp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return 0, err
+	}
+	wr := bufio.NewWriter(file)
+	enc := json.NewEncoder(wr) // Encode terminates every entry with '\n'
+	for _, entry := range keep {
+		if err = enc.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = wr.Flush()
+	}
+	closeFile(file, &err)
+	if err != nil {
+		os.Remove(tmpFp)
+		return 0, err
+	}
+	return total - len(keep), os.Rename(tmpFp, fp)
+}
+
+// autoPruneHistory applies the retention policy of the config at most once a
+// day, so that the history does not grow forever without every execution
+// paying for reading it.
+func autoPruneHistory(scriptDp string) error {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	if conf.HistoryMaxEntries == 0 && conf.HistoryMaxAge == "" {
+		return nil
+	}
+	marker := filepath.Join(baseDir(scriptDp), HISTORY_PRUNED_FILE)
+	if fi, err := os.Stat(marker); err == nil && time.Since(fi.ModTime()) < 24*time.Hour {
+		return nil
+	}
+	if _, err := pruneWithConfig(scriptDp, conf, 0, ""); err != nil {
+		return err
+	}
+	return os.WriteFile(marker, nil, 0640)
+}
+
+// pruneWithConfig prunes the history with the given limits, falling back to
+// the limits of the config for unset ones. It returns the number of entries
+// removed.
+func pruneWithConfig(scriptDp string, conf *config, maxEntries int, maxAge string) (int, error) {
+	if maxEntries == 0 {
+		maxEntries = conf.HistoryMaxEntries
+	}
+	if maxAge == "" {
+		maxAge = conf.HistoryMaxAge
+	}
+	var age time.Duration
+	if maxAge != "" {
+		var err error
+		if age, err = parseDuration(maxAge); err != nil {
+			return 0, err
+		}
+	}
+	if maxEntries == 0 && age == 0 {
+		return 0, fmt.Errorf("No retention policy. Pass --max-entries or --max-age, or set one with:\n\trun -config historyMaxEntries 10000\n")
+	}
+	return pruneHistory(scriptDp, maxEntries, age)
+}
+
+/******************************************************************************/
+
+const USAGE_HISTORY = "Usage:\n\trun -history [-n <count>] [--failed] [--since <duration>] [<cmd>]\n\trun -history prune [--max-entries <count>] [--max-age <duration>]\n\n--failed shows only executions which failed, --since only those within the\nduration, f. e. 7d.\n"
+
+// HistoryCmd lists the latest executions or prunes the history.
+func HistoryCmd(scriptDp string, args []string) error {
+	if len(args) > 0 && args[0] == "prune" {
+		fs := newFlagSet("-history prune")
+		maxEntries := fs.Int("max-entries", 0, "")
+		maxAge := fs.String("max-age", "", "")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 || *maxEntries < 0 {
+			return fmt.Errorf(tr(USAGE_HISTORY))
+		}
+		conf, err := loadConfig(scriptDp)
+		if err != nil {
+			return err
+		}
+		removed, err := pruneWithConfig(scriptDp, conf, *maxEntries, *maxAge)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d history entries.\n", removed)
+		return nil
+	}
+
+	fs := newFlagSet("-history")
+	n := fs.Int("n", 20, "")
+	failed := fs.Bool("failed", false, "")
+	since := fs.String("since", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return fmt.Errorf(tr(USAGE_HISTORY))
+	}
+	var after time.Time
+	if *since != "" {
+		d, err := parseDuration(*since)
+		if err != nil {
+			return fmt.Errorf(tr("--since: %s\n"), err)
+		}
+		after = time.Now().Add(-d)
+	}
+
+	var latest []*historyEntry
+	err := readHistory(scriptDp, func(entry *historyEntry) bool {
+		if *failed && entry.Succeeded() || entry.Start.Before(after) ||
+			fs.NArg() == 1 && entry.Name != fs.Arg(0) {
+			return false
+		}
+		latest = append(latest, entry)
+		if len(latest) > *n {
+			latest = latest[1:]
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-22s %-15s %4s %10s\n", "Start", "Name", "Exit", "Duration")
+	for _, e := range latest {
+		fmt.Printf("%-22s %-15s %4d %10s\n", e.Start.Local().Format("2006-01-02 15:04:05"), e.Name, e.ExitCode,
+			formatDuration(time.Duration(e.DurationMs)*time.Millisecond))
+	}
+	return nil
+}
+
+/******************************************************************************/
+
+const USAGE_EXEC_LAST_FAILED = "Usage:\n\trun -exec-last-failed [<cmd>]\n\nRuns the latest failed execution again, with the same arguments. With <cmd>,\nthe latest failed execution of <cmd>.\n"
+
+// ExecLastFailedCmd repeats the latest failed execution, the usual step when
+// debugging a script.
+func ExecLastFailedCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) > 1 || len(args) == 1 && strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf(tr(USAGE_EXEC_LAST_FAILED))
+	}
+	var last *historyEntry
+	err := readHistory(scriptDp, func(entry *historyEntry) bool {
+		if !entry.Succeeded() && (len(args) == 0 || entry.Name == args[0]) {
+			last = entry
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		return fmt.Errorf(tr("No failed execution in the history.\n"))
+	}
+	runArgs := last.RunArgs
+	if runArgs == nil {
+		runArgs = last.Args // recorded before runArgs existed
+	}
+	fmt.Fprintf(os.Stderr, tr("Running %s, which failed with %d at %s\n"), strings.Join(append([]string{last.Name}, runArgs...), " "),
+		last.ExitCode, last.Start.Local().Format("2006-01-02 15:04:05"))
+	return Run(append([]string{last.Name}, runArgs...), scriptDp, indexFp)
+}
+
+/******************************************************************************/
+
+const USAGE_STATS = "Usage:\n\trun -stats [--export csv|json]\n"
+
+// cmdStats aggregates the history of a single command.
+type cmdStats struct {
+	Name          string    `json:"name"`
+	Runs          int       `json:"runs"`
+	Failures      int       `json:"failures"`
+	AvgDurationMs int64     `json:"avgDurationMs"`
+	LastRun       time.Time `json:"lastRun"`
+	LastExitCode  int       `json:"lastExitCode"`
+}
+
+// StatsCmd prints how often and how successfully every command ran, or
+// exports these numbers as CSV or JSON for further analysis.
+func StatsCmd(scriptDp string, args []string) error {
+	fs := newFlagSet("-stats")
+	export := fs.String("export", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_STATS))
+	}
+
+	byName := make(map[string]*cmdStats)
+	var totalMs = make(map[string]int64)
+	err := readHistory(scriptDp, func(e *historyEntry) bool {
+		s, ok := byName[e.Name]
+		if !ok {
+			s = &cmdStats{Name: e.Name}
+			byName[e.Name] = s
+		}
+		s.Runs++
+		if !e.Succeeded() {
+			s.Failures++
+		}
+		totalMs[e.Name] += e.DurationMs
+		if !e.Start.Before(s.LastRun) {
+			s.LastRun = e.Start
+			s.LastExitCode = e.ExitCode
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	stats := make([]*cmdStats, 0, len(byName))
+	for name, s := range byName {
+		s.AvgDurationMs = totalMs[name] / int64(s.Runs)
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	switch *export {
+	case "":
+		fmt.Printf("%-15s %6s %8s %10s  %s\n", "Name", "Runs", "Failures", "Avg", "Last run")
+		for _, s := range stats {
+			fmt.Printf("%-15s %6d %8d %10s  %s (exit %d)\n", s.Name, s.Runs, s.Failures,
+				formatDuration(time.Duration(s.AvgDurationMs)*time.Millisecond),
+				s.LastRun.Local().Format("2006-01-02 15:04"), s.LastExitCode)
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"name", "runs", "failures", "avgDurationMs", "lastRun", "lastExitCode"})
+		for _, s := range stats {
+			w.Write([]string{s.Name, strconv.Itoa(s.Runs), strconv.Itoa(s.Failures),
+				strconv.FormatInt(s.AvgDurationMs, 10), s.LastRun.Format(time.RFC3339), strconv.Itoa(s.LastExitCode)})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf(tr("Cannot export as %q.\n%s"), *export, tr(USAGE_STATS))
+	}
+	return nil
+}
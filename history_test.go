@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryConcurrentPrune(t *testing.T) {
+	scriptDp := filepath.Join(t.TempDir(), "cmd", "unix")
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 50; i++ {
+		if err := appendHistory(scriptDp, &historyEntry{Name: "old", Start: old}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const runs = 20
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := appendHistory(scriptDp, &historyEntry{Name: fmt.Sprint("new-", i), Start: time.Now()}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := pruneHistory(scriptDp, 0, 24*time.Hour); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	names := map[string]bool{}
+	err := readHistory(scriptDp, func(entry *historyEntry) bool {
+		names[entry.Name] = true
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < runs; i++ {
+		if !names[fmt.Sprint("new-", i)] {
+			t.Errorf("entry new-%d was lost", i)
+		}
+	}
+	if names["old"] {
+		t.Errorf("old entries were not pruned")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	HOOKS_DIR     string = "hooks"
+	PRE_RUN_HOOK  string = "pre-run"
+	POST_RUN_HOOK string = "post-run"
+)
+
+// findHook returns the path of the hook in ~/.run/hooks, ignoring its file
+// extension, so that pre-run.sh and pre-run.bat both work. Only extensions of
+// scripts count, a pre-run.sample or pre-run.bak is never run. It returns an
+// empty path if the hook does not exist.
+func findHook(scriptDp, hook string) (string, error) {
+	dir := filepath.Join(baseDir(scriptDp), HOOKS_DIR)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fName := entry.Name()
+		ext := filepath.Ext(fName)
+		if fName[:len(fName)-len(ext)] == hook && isHookExt(ext) {
+			return filepath.Join(dir, fName), nil
+		}
+	}
+	return "", nil
+}
+
+// isHookExt reports whether a hook with the file extension ext is executable:
+// none, one of a script or, on Windows, one of an executable.
+func isHookExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case "", ".sh", ".bash", ".py", ".js", ".rb", ".pl", ".ps1", ".rc":
+		return true
+	case ".bat", ".cmd", ".exe", ".com":
+		return runtime.GOOS == "windows"
+	}
+	return false
+}
+
+// runHook runs the global hook for every execution of a command. The hook is
+// invoked with the command name followed by the arguments passed to the script.
+// They are also exposed through the environment:
+//
+//	RUN_CMD_NAME       name of the command
+//	RUN_CMD_SCRIPT     path of the script
+//	RUN_CMD_ARGS       number of arguments passed to the script
+//	RUN_CMD_EXIT_CODE  exit code of the script (post-run only)
+//
+// ctxEnv, the variables of contextEnv, are passed as well.
+//
+// A pre-run hook exiting non-zero prevents the command from running.
+func runHook(scriptDp, hook, name string, cmd []string, code int, ctxEnv []string) error {
+	fp, err := findHook(scriptDp, hook)
+	if err != nil || fp == "" {
+		return err
+	}
+
+	cmdLine := interpreterCmd(fp, append([]string{name}, cmd[1:]...))
+	exe := exec.Command(cmdLine[0], cmdLine[1:]...)
+	exe.Stdout = os.Stderr // do not mix hook output into the script's
+	exe.Stderr = os.Stderr
+	exe.Env = append(append(os.Environ(), ctxEnv...),
+		"RUN_CMD_NAME="+name,
+		"RUN_CMD_SCRIPT="+cmd[0],
+		"RUN_CMD_ARGS="+strconv.Itoa(len(cmd)-1),
+	)
+	if hook == POST_RUN_HOOK {
+		exe.Env = append(exe.Env, "RUN_CMD_EXIT_CODE="+strconv.Itoa(code))
+	}
+	if err := prepareExec(exe); err != nil {
+		return err
+	}
+	if err := exe.Run(); err != nil {
+		return fmt.Errorf("%s hook %q failed: %w", hook, fp, err)
+	}
+	return nil
+}
+
+// validateArgs runs the validation script of a command with the arguments
+// for its script. Its output is shown on stderr; a non-zero exit prevents the
+// command from running.
+func validateArgs(entry *jsonCmd, cmd []string, ctxEnv []string) error {
+	if entry.Meta.Validate == "" {
+		return nil
+	}
+	cmdLine := interpreterCmd(entry.Meta.Validate, cmd[1:])
+	exe := exec.Command(cmdLine[0], cmdLine[1:]...)
+	exe.Stdout = os.Stderr
+	exe.Stderr = os.Stderr
+	exe.Env = append(append(os.Environ(), ctxEnv...), entry.Meta.Env...)
+	if err := prepareExec(exe); err != nil {
+		return err
+	}
+	if err := exe.Run(); err != nil {
+		return fmt.Errorf(tr("%s refused the arguments of %s: %s\n"), entry.Meta.Validate, entry.Name, err)
+	}
+	return nil
+}
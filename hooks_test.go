@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindHook(t *testing.T) {
+	scriptDp := filepath.Join(t.TempDir(), BASE_DIR, SCRIPT_DIR, "unix")
+	dir := filepath.Join(baseDir(scriptDp), HOOKS_DIR)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		file string
+		want string // "" for no hook
+	}{
+		{"pre-run.bak", ""},
+		{"pre-run.sample", ""},
+		{"pre-run.sh", "pre-run.sh"},
+		{"pre-run", "pre-run"}, // sorts first
+	} {
+		if err := os.WriteFile(filepath.Join(dir, tt.file), []byte("#!/bin/sh\n"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		fp, err := findHook(scriptDp, PRE_RUN_HOOK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filepath.Base(fp); fp == "" && tt.want != "" || fp != "" && got != tt.want {
+			t.Errorf("with %s, findHook() = %q, want %q", tt.file, fp, tt.want)
+		}
+	}
+}
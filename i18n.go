@@ -0,0 +1,78 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const LOCALE_DIR string = "locales"
+
+// Every locales/<lang>.json maps the English messages to their translation.
+// English is the language of the source and has no catalog.
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalog translates the messages into the language in use, nil is English.
+var catalog map[string]string
+
+// tr translates an English message or format string. Messages without
+// translation are returned as is.
+func tr(msg string) string {
+	if t, ok := catalog[msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// languages lists the supported languages.
+func languages() []string {
+	langs := []string{"en"}
+	entries, _ := localeFS.ReadDir(LOCALE_DIR)
+	for _, entry := range entries {
+		langs = append(langs, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return langs
+}
+
+// langCode reduces a locale like de_DE.UTF-8 to its language, de.
+func langCode(locale string) string {
+	if i := strings.IndexAny(locale, "_.@-"); i >= 0 {
+		locale = locale[:i]
+	}
+	return strings.ToLower(locale)
+}
+
+// setLanguage loads the catalog of lang, else of the language set with -config,
+// else of the locale in $LC_ALL, $LC_MESSAGES or $LANG. Unsupported languages
+// are English.
+func setLanguage(scriptDp, lang string) error {
+	if conf, err := loadConfig(scriptDp); err == nil && lang == "" {
+		lang = conf.Language
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang != "" {
+			break
+		}
+		lang = os.Getenv(env)
+	}
+	lang = langCode(lang)
+	if lang == "" || lang == "en" {
+		return nil
+	}
+
+	raw, err := localeFS.ReadFile(path.Join(LOCALE_DIR, lang+".json"))
+	if err != nil {
+		return nil // no catalog, stay with English
+	}
+	catalog = map[string]string{}
+	if err := json.Unmarshal(raw, &catalog); err != nil {
+		catalog = nil
+		return fmt.Errorf("%s catalog: %w", lang, err)
+	}
+	return nil
+}
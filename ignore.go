@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const IGNORE_FILE string = ".runignore"
+
+// ignoreRule is a single line of a .runignore file.
+type ignoreRule struct {
+	pattern string
+	negate  bool // line started with '!'
+	dirOnly bool // line ended with '/'
+}
+
+// ignoreList holds the rules of the .runignore file in the script directory.
+// The file uses the gitignore syntax. As the script directory is flat, every
+// pattern is matched against file names only. The files of run itself are
+// always ignored.
+type ignoreList []ignoreRule
+
+var builtinIgnores = ignoreList{
+	{pattern: INDEX_FILE},
+	{pattern: INDEX_FILE + ".tmp"},
+	{pattern: IGNORE_FILE},
+}
+
+func loadIgnore(scriptDp string) (ignoreList, error) {
+	rules := append(ignoreList(nil), builtinIgnores...)
+	file, err := os.Open(filepath.Join(scriptDp, IGNORE_FILE))
+	if os.IsNotExist(err) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var rule ignoreRule
+		switch {
+		case line[0] == '!':
+			rule.negate = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// anchoring has no effect in a flat directory
+		line = strings.TrimPrefix(line, "/")
+		line = strings.TrimPrefix(line, "**/")
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
+
+// Ignored reports whether the entry name of the script directory is ignored.
+// Like in git, the last matching rule decides.
+func (l ignoreList) Ignored(name string, isDir bool) bool {
+	ignored := false
+	for _, rule := range l {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern == "**" {
+			ignored = !rule.negate
+			continue
+		}
+		if ok, _ := path.Match(rule.pattern, name); ok {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
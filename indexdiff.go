@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const USAGE_DIFF_INDEX = "Usage:\n\trun -diff-index <fileA> [<fileB>]\n\nCompares two index files command by command and lists the commands added,\nremoved and changed from <fileA> to <fileB>, with every changed field. Without\n<fileB>, <fileA> is compared with your index. Exits with 1 if they differ.\n"
+
+// DiffIndexCmd compares indexes by their commands, not by their text, so that
+// the order of commands and the formatting do not matter.
+func DiffIndexCmd(indexFp string, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf(tr(USAGE_DIFF_INDEX))
+	}
+	aFp, bFp := args[0], indexFp
+	if len(args) == 2 {
+		bFp = args[1]
+	}
+	a, err := indexFields(aFp)
+	if err != nil {
+		return fmt.Errorf("%s: %w", aFp, err)
+	}
+	b, err := indexFields(bFp)
+	if err != nil {
+		return fmt.Errorf("%s: %w", bFp, err)
+	}
+
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	differ := false
+	for _, name := range names {
+		aFields, inA := a[name]
+		bFields, inB := b[name]
+		switch {
+		case !inA:
+			fmt.Printf("+ %s\n", name)
+		case !inB:
+			fmt.Printf("- %s\n", name)
+		default:
+			changes := fieldChanges(aFields, bFields)
+			if len(changes) == 0 {
+				continue
+			}
+			fmt.Printf("~ %s\n", name)
+			for _, c := range changes {
+				fmt.Println("    " + c)
+			}
+		}
+		differ = true
+	}
+	if !differ {
+		fmt.Println(tr("The indexes hold the same commands."))
+		return nil
+	}
+	return &SilentExit{Code: 1}
+}
+
+// indexFields reads the commands of the index fp, by name, as their fields
+// flattened by flattenJson.
+func indexFields(fp string) (map[string]map[string]string, error) {
+	cmds := make(map[string]map[string]string)
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		raw, err := json.Marshal(cmd)
+		if err != nil {
+			return
+		}
+		var v interface{}
+		if err = json.Unmarshal(raw, &v); err != nil {
+			return
+		}
+		fields := make(map[string]string)
+		flattenJson("", v, fields)
+		delete(fields, "commandName")
+		cmds[cmd.Name] = fields
+		return
+	}
+	return cmds, findOperation(fp, collect)
+}
+
+// flattenJson maps the paths of the values of objects in v, f. e.
+// options.description, to their JSON. Arrays are values, not paths.
+func flattenJson(path string, v interface{}, fields map[string]string) {
+	if obj, ok := v.(map[string]interface{}); ok {
+		for key, child := range obj {
+			if path != "" {
+				key = path + "." + key
+			}
+			flattenJson(key, child, fields)
+		}
+		return
+	}
+	raw, _ := json.Marshal(v)
+	fields[path] = string(raw)
+}
+
+// fieldChanges lists the fields which differ between a and b, sorted.
+func fieldChanges(a, b map[string]string) []string {
+	var changes []string
+	for path, av := range a {
+		if bv, ok := b[path]; !ok {
+			changes = append(changes, fmt.Sprintf(tr("%s: %s removed"), path, av))
+		} else if av != bv {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", path, av, bv))
+		}
+	}
+	for path, bv := range b {
+		if _, ok := a[path]; !ok {
+			changes = append(changes, fmt.Sprintf(tr("%s: %s added"), path, bv))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
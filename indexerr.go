@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// indexError is a malformed index. It is located by line and column, the
+// number of the command and its field, to debug hand-edited or
+// merge-conflicted indexes.
+type indexError struct {
+	fp        string
+	line, col int
+	entry     int // number of the command from 1, 0 outside of commands
+	field     string
+	msg       string
+}
+
+func (e *indexError) Error() string {
+	loc := fmt.Sprintf("%s:%d:%d", e.fp, e.line, e.col)
+	switch {
+	case e.field != "":
+		return fmt.Sprintf(tr("%s: command %d, field %s: %s\n"), loc, e.entry, e.field, e.msg)
+	case e.entry > 0:
+		return fmt.Sprintf(tr("%s: command %d: %s\n"), loc, e.entry, e.msg)
+	}
+	return fmt.Sprintf("%s: %s\n", loc, e.msg)
+}
+
+// indexDecoder decodes the commands of an index one by one and locates the
+// errors of doing so.
+type indexDecoder struct {
+	*json.Decoder
+	fp    string
+	raw   []byte // the content of fp, if it is read already
+	entry int
+	start int64 // offset before the command being decoded
+}
+
+func newIndexDecoder(r io.Reader, indexFp string) *indexDecoder {
+	return &indexDecoder{Decoder: json.NewDecoder(r), fp: indexFp}
+}
+
+// Open reads the opening bracket of the index.
+func (d *indexDecoder) Open() error {
+	t, err := d.Token()
+	if err != nil {
+		return d.locate(err)
+	}
+	if t != json.Delim('[') {
+		return d.locate(errors.New(tr("the index must be a JSON array, starting with [")))
+	}
+	return nil
+}
+
+// Next decodes the next command.
+func (d *indexDecoder) Next(cmd *jsonCmd) error {
+	d.entry++
+	d.start = d.InputOffset()
+	if err := d.Decode(cmd); err != nil {
+		return d.locate(err)
+	}
+	return nil
+}
+
+// Close reads the closing bracket of the index.
+func (d *indexDecoder) Close() error {
+	d.entry = 0
+	if _, err := d.Token(); err != nil {
+		return d.locate(err)
+	}
+	return nil
+}
+
+// locate turns err into an indexError. Only on errors the index is read again,
+// to find the line and column.
+func (d *indexDecoder) locate(err error) error {
+	raw := d.raw
+	if raw == nil {
+		var readErr error
+		if raw, readErr = readIndex(d.fp); readErr != nil {
+			return err
+		}
+	}
+	offset, field, msg := d.InputOffset(), "", err.Error()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		// the offset is relative to the start of the command
+		offset = d.start
+		for offset < int64(len(raw)) && strings.IndexByte(" \t\r\n,", raw[offset]) >= 0 {
+			offset++
+		}
+		offset += typeErr.Offset
+		field = typeErr.Field
+		msg = fmt.Sprintf(tr("expected %s, found %s"), typeErr.Type, typeErr.Value)
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		offset = int64(len(raw))
+		msg = tr("unexpected end, a bracket or brace is missing")
+	}
+	if bytes.Contains(raw, []byte("\n<<<<<<< ")) || bytes.HasPrefix(raw, []byte("<<<<<<< ")) {
+		msg += tr(", the index contains git conflict markers")
+	}
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+	line := bytes.Count(raw[:offset], []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(raw[:offset], '\n')
+	return &indexError{d.fp, line, col, d.entry, field, msg}
+}
+
+// unknownFields lists the fields of the commands in raw which run does not
+// know, f. e. misspelled ones. They are ignored, thus only warned about.
+func unknownFields(raw []byte) []string {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil
+	}
+	var warnings []string
+	for i, entry := range entries {
+		dec := json.NewDecoder(bytes.NewReader(entry))
+		dec.DisallowUnknownFields()
+		var cmd jsonCmd
+		err := dec.Decode(&cmd)
+		if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			warnings = append(warnings, fmt.Sprintf(tr("command %d (%s): unknown field %s is ignored"), i+1, cmd.Name, field))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tmpGrace is the age below which a temporary index may still be written by
+// another run, thus is left alone.
+const tmpGrace = 10 * time.Second
+
+// recoverIndex handles the temporary index a crashed change of the index left
+// behind, before the next change overwrites it. The temporary index is
+// complete, if the change was interrupted between writing and renaming it.
+// Then it replaces the index, if it is newer, else it is dropped. On a
+// terminal, the user decides. An incomplete one is always dropped.
+func recoverIndex(indexFp string) error {
+	tmpFp := indexFp + ".tmp"
+	tmpFi, err := os.Stat(tmpFp)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if time.Since(tmpFi.ModTime()) < tmpGrace {
+		trace("index recovery: %s is recent, another run may be writing it", tmpFp)
+		return nil
+	}
+
+	var tmpCmds []jsonCmd
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		tmpCmds = append(tmpCmds, *cmd)
+		return
+	}
+	if err := findOperation(tmpFp, collect); err != nil {
+		fmt.Fprintf(os.Stderr, tr("run: removing %s, the incomplete index of an interrupted change.\n"), tmpFp)
+		return os.Remove(tmpFp)
+	}
+	var cmds []jsonCmd
+	collect = func(cmd *jsonCmd) (esc bool, err error) {
+		cmds = append(cmds, *cmd)
+		return
+	}
+	indexFi, err := os.Stat(indexFp)
+	if err == nil {
+		err = findOperation(indexFp, collect)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		// the index itself is broken, keep the other for the user to compare
+		fmt.Fprintf(os.Stderr, tr("run: %s was left by an interrupted change, but the index is unreadable. Compare both and replace the index by hand.\n"), tmpFp)
+		return nil
+	}
+
+	changes := indexChanges(cmds, tmpCmds)
+	if len(changes) == 0 {
+		trace("index recovery: %s equals the index", tmpFp)
+		return os.Remove(tmpFp)
+	}
+	finish := indexFi == nil || tmpFi.ModTime().After(indexFi.ModTime())
+	if isTerminal() {
+		fmt.Fprintf(os.Stderr, tr("run: %s holds a change of the index which was interrupted before it was saved, written %s:\n"), tmpFp, tmpFi.ModTime().Format("2006-01-02 15:04:05"))
+		for _, c := range changes {
+			fmt.Fprintln(os.Stderr, "  "+c)
+		}
+		question := tr("Apply the change?")
+		if !finish {
+			fmt.Fprintln(os.Stderr, tr("The index was changed later."))
+			question = tr("Apply the change anyway?")
+		}
+		finish = confirm(question)
+	}
+	if !finish {
+		fmt.Fprintf(os.Stderr, tr("run: removing %s, the change of an interrupted run is dropped.\n"), tmpFp)
+		return os.Remove(tmpFp)
+	}
+	fmt.Fprintf(os.Stderr, tr("run: completing the interrupted change of the index: %s\n"), strings.Join(changes, "; "))
+	return os.Rename(tmpFp, indexFp)
+}
+
+// indexChanges lists the commands added, removed and changed from old to new.
+func indexChanges(old, new []jsonCmd) []string {
+	before := make(map[string][]byte, len(old))
+	for i := range old {
+		raw, _ := json.Marshal(&old[i])
+		before[old[i].Name] = raw
+	}
+	var added, removed, changed []string
+	for i := range new {
+		raw, _ := json.Marshal(&new[i])
+		prev, ok := before[new[i].Name]
+		switch {
+		case !ok:
+			added = append(added, new[i].Name)
+		case !bytes.Equal(prev, raw):
+			changed = append(changed, new[i].Name)
+		}
+		delete(before, new[i].Name)
+	}
+	for name := range before {
+		removed = append(removed, name)
+	}
+	var changes []string
+	for _, c := range []struct {
+		label string
+		names []string
+	}{{tr("added"), added}, {tr("removed"), removed}, {tr("changed"), changed}} {
+		if len(c.names) > 0 {
+			sort.Strings(c.names)
+			changes = append(changes, c.label+": "+strings.Join(c.names, ", "))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isTerminal reports whether stdin is a terminal, f. e. not in cron.
+func isTerminal() bool {
+	return isTerminalFile(os.Stdin)
+}
+
+// isTerminalFile reports whether f is a terminal.
+func isTerminalFile(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && (fi.Mode()&os.ModeCharDevice != 0 || isPtyPipe(f))
+}
+
+// prompter asks questions on the terminal and reads the answers line by line.
+type prompter struct {
+	r *bufio.Reader
+}
+
+// ask prints the question with its default and returns the answer, the default
+// for an empty one.
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, err := p.r.ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		return "", fmt.Errorf(tr("Aborted.\n"))
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// askPath asks for an existing file. As the terminal is not in raw mode, Tab
+// cannot complete; instead, an answer which is no file is completed like Tab
+// would: a single match becomes the default, several are listed.
+func (p *prompter) askPath(question string) (string, error) {
+	def := ""
+	for {
+		answer, err := p.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		if fi, err := os.Stat(answer); err == nil && !fi.IsDir() {
+			return filepath.Abs(answer)
+		}
+		matches, _ := filepath.Glob(answer + "*")
+		switch len(matches) {
+		case 0:
+			fmt.Printf(tr("There is no file %q.\n"), answer)
+			def = ""
+		case 1:
+			def = matches[0]
+			if fi, err := os.Stat(def); err == nil && fi.IsDir() {
+				def += string(filepath.Separator)
+			}
+		default:
+			for i, m := range matches {
+				if i == 20 {
+					fmt.Printf(tr("... and %d more\n"), len(matches)-i)
+					break
+				}
+				fmt.Println("  " + m)
+			}
+			def = commonPrefix(matches)
+		}
+	}
+}
+
+func commonPrefix(list []string) string {
+	prefix := list[0]
+	for _, s := range list[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// askInt asks for a whole number of at least min.
+func (p *prompter) askInt(question string, def, min int) (int, error) {
+	for {
+		answer, err := p.ask(question, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= min {
+			return n, nil
+		}
+		fmt.Printf(tr("Enter a number of at least %d.\n"), min)
+	}
+}
+
+// createInteractive asks for the values -new was not given, the name if args
+// is empty, and registers the command.
+func createInteractive(scriptDp, indexFp string, args []string) error {
+	p := &prompter{bufio.NewReader(os.Stdin)}
+	cmd := jsonCmd{Meta: meta{MaxNumArgs: -1}}
+
+	if len(args) == 1 {
+		cmd.Name = args[0]
+	}
+	for cmd.Name == "" {
+		name, err := p.ask(tr("Name"), "")
+		if err != nil {
+			return err
+		}
+		nameErr := checkName(name)
+		switch err := Find(indexFp, name, &jsonCmd{}); {
+		case name == "":
+		case nameErr != nil:
+			fmt.Print(nameErr)
+		case err == nil:
+			fmt.Printf(tr("%s is registered already.\n"), name)
+		case !errors.Is(err, CmdNotFoundErr):
+			return err
+		default:
+			warnInternalName(name)
+			cmd.Name = name
+		}
+	}
+
+	var err error
+	if cmd.Script, err = p.askPath(tr("Script")); err != nil {
+		return err
+	}
+	if cmd.Meta.Description, err = p.ask(tr("Description (optional)"), ""); err != nil {
+		return err
+	}
+	if cmd.Meta.MinNumArgs, err = p.askInt(tr("Minimum number of arguments"), 0, 0); err != nil {
+		return err
+	}
+	if cmd.Meta.MaxNumArgs, err = p.askInt(tr("Maximum number of arguments, -1 for any"), -1, -1); err != nil {
+		return err
+	}
+	for cmd.Meta.MaxNumArgs != -1 && cmd.Meta.MaxNumArgs < cmd.Meta.MinNumArgs {
+		fmt.Println(tr("The maximum must not be below the minimum."))
+		if cmd.Meta.MaxNumArgs, err = p.askInt(tr("Maximum number of arguments, -1 for any"), -1, -1); err != nil {
+			return err
+		}
+	}
+	for {
+		tags, err := p.ask(tr("Tags, separated by spaces (optional)"), "")
+		if err != nil {
+			return err
+		}
+		cmd.Meta.Tags = strings.Fields(tags)
+		if !strings.Contains(tags, ",") {
+			break
+		}
+		fmt.Println(tr("Tags must not contain commas."))
+	}
+
+	if err := insertIntoIndex(indexFp, &cmd); err != nil {
+		return err
+	}
+	fmt.Printf(tr("Registered %s.\n"), cmd.Name)
+	return nil
+}
+
+// askArgs asks for the arguments of the spec of name one after another and
+// shows the resulting command line before it runs. It returns the positional
+// arguments and the environment variables, like loadParams. An empty answer
+// leaves an argument out; as positional arguments cannot have gaps, the
+// following positional ones are not asked for then.
+func askArgs(scriptDp, indexFp, name string) (args []string, env []string, err error) {
+	cmd := jsonCmd{}
+	if err := findRegistered(scriptDp, indexFp, name, &cmd); err != nil {
+		return nil, nil, err
+	}
+	if len(cmd.Meta.Args) == 0 {
+		return nil, nil, fmt.Errorf(tr("%q has no argument spec to ask for. Add one with:\n\trun -args %s <argName> ...\n"), name, name)
+	}
+	if !isTerminal() {
+		return nil, nil, fmt.Errorf(tr("-i asks for the arguments on a terminal, there is none.\n"))
+	}
+
+	p := &prompter{bufio.NewReader(os.Stdin)}
+	gap := false
+	for i := range cmd.Meta.Args {
+		spec := &cmd.Meta.Args[i]
+		if gap && spec.Env == "" {
+			continue
+		}
+		val, err := p.askArg(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case val == "":
+			gap = gap || spec.Env == ""
+		case spec.Env != "":
+			env = append(env, spec.Env+"="+val)
+		default:
+			args = append(args, val)
+		}
+	}
+
+	line := append(append(append([]string(nil), env...), "run", name), args...)
+	fmt.Printf("\n%s\n", quoteCmdLine(line))
+	answer, err := p.ask(tr("Run it? (y/n)"), tr("y"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if answer = strings.ToLower(answer); answer != "y" && answer != "yes" && answer != tr("y") && answer != tr("yes") {
+		return nil, nil, fmt.Errorf(tr("Aborted.\n"))
+	}
+	return args, env, nil
+}
+
+// askArg asks for the value of an argument until it fits its spec. Choices
+// are listed and can be picked by number.
+func (p *prompter) askArg(spec *argSpec) (string, error) {
+	question := spec.Name
+	if spec.Type != "" && spec.Type != "string" {
+		question += " (" + spec.Type + ")"
+	}
+	if spec.Description != "" {
+		fmt.Println(spec.Description)
+	}
+	for i, choice := range spec.Choices {
+		fmt.Printf("  %d) %s\n", i+1, choice)
+	}
+	for {
+		answer, err := p.ask(question, "")
+		if err != nil || answer == "" {
+			return "", err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && !contains(spec.Choices, answer) && n >= 1 && n <= len(spec.Choices) {
+			answer = spec.Choices[n-1]
+		}
+		val, err := checkArg(spec, answer)
+		if err == nil {
+			return val, nil
+		}
+		fmt.Print(err)
+	}
+}
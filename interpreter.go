@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The selection of interpreterCmd on Windows. It lives apart from
+// exec_windows.go, so that its tests run on every system.
+
+// windowsLookups are the questions windowsCmd asks the system. They are only
+// asked when the answer matters.
+type windowsLookups struct {
+	hasShebang func(script string) bool
+	powerShell func() string // pwsh, else powershell.exe
+	gitBash    func() string // "" without Git for Windows
+}
+
+// windowsCmd returns the command line Windows executes script with. Windows
+// does not know shebangs: a script with one, or a .sh file, is run by the bash
+// of Git for Windows, which honours the shebang like Git Bash would, and a .ps1
+// file by PowerShell. Otherwise, or without Git for Windows, the script is
+// executed as is.
+func windowsCmd(script string, args []string, sys windowsLookups) []string {
+	cmd := append([]string{script}, args...)
+	switch strings.ToLower(filepath.Ext(script)) {
+	case ".ps1":
+		return append([]string{sys.powerShell(), "-NoProfile", "-ExecutionPolicy", "Bypass", "-File"}, cmd...)
+	case ".sh":
+	case ".bat", ".cmd", ".exe", ".com":
+		return cmd
+	default:
+		if !sys.hasShebang(script) {
+			return cmd
+		}
+	}
+	bash := sys.gitBash()
+	if bash == "" {
+		return cmd
+	}
+	// bash execs the script itself, so the shebang selects the interpreter
+	return append([]string{bash, "-c", `exec "$0" "$@"`}, cmd...)
+}
+
+// hasShebang reports whether the script starts with #!.
+func hasShebang(script string) bool {
+	file, err := os.Open(script)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, 2)
+	n, _ := file.Read(magic)
+	return n == 2 && string(magic) == "#!"
+}
+
+// gitBashCandidates returns where the bash of Git for Windows may be, in the
+// order to try. It is searched next to git, "" if it is not in PATH, because
+// the PATH of cmd.exe and PowerShell usually only has Git\cmd. pathBash, the
+// bash found in PATH, comes last and is skipped if it is the one of
+// C:\Windows\System32, which starts WSL instead.
+func gitBashCandidates(git, pathBash string, getenv func(string) string) []string {
+	var candidates []string
+	if git != "" {
+		dir := filepath.Dir(git) // Git\cmd, Git\bin or Git\mingw64\bin
+		candidates = append(candidates,
+			filepath.Join(dir, "bash.exe"),
+			filepath.Join(dir, "..", "bin", "bash.exe"),
+			filepath.Join(dir, "..", "..", "bin", "bash.exe"))
+	}
+	for _, env := range []string{"ProgramFiles", "ProgramW6432", "LocalAppData"} {
+		if dir := getenv(env); dir != "" {
+			candidates = append(candidates, filepath.Join(dir, "Git", "bin", "bash.exe"))
+		}
+	}
+	if pathBash != "" {
+		system := filepath.Join(getenv("SystemRoot"), "System32")
+		if !strings.EqualFold(filepath.Dir(pathBash), system) {
+			candidates = append(candidates, pathBash)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWindowsCmd(t *testing.T) {
+	const bash, ps = "G/bin/bash.exe", "pwsh.exe"
+	bashLine := func(script string) []string {
+		return []string{bash, "-c", `exec "$0" "$@"`, script, "a b"}
+	}
+	tests := []struct {
+		script  string
+		shebang bool
+		bash    string
+		want    []string
+	}{
+		{"x.ps1", false, bash, []string{ps, "-NoProfile", "-ExecutionPolicy", "Bypass", "-File", "x.ps1", "a b"}},
+		{"X.PS1", true, bash, []string{ps, "-NoProfile", "-ExecutionPolicy", "Bypass", "-File", "X.PS1", "a b"}},
+		{"x.sh", false, bash, bashLine("x.sh")},
+		{"x.sh", false, "", []string{"x.sh", "a b"}}, // no Git for Windows
+		{"x.py", true, bash, bashLine("x.py")},
+		{"x", true, bash, bashLine("x")},
+		{"x.py", false, bash, []string{"x.py", "a b"}},
+		// executables of Windows ignore a shebang
+		{"x.bat", true, bash, []string{"x.bat", "a b"}},
+		{"x.CMD", true, bash, []string{"x.CMD", "a b"}},
+		{"x.exe", true, bash, []string{"x.exe", "a b"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		sys := windowsLookups{
+			hasShebang: func(string) bool { return tt.shebang },
+			powerShell: func() string { return ps },
+			gitBash:    func() string { return tt.bash },
+		}
+		if got := windowsCmd(tt.script, []string{"a b"}, sys); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("windowsCmd(%q), shebang %v, bash %q = %q, want %q", tt.script, tt.shebang, tt.bash, got, tt.want)
+		}
+	}
+}
+
+func TestHasShebang(t *testing.T) {
+	dir := t.TempDir()
+	for text, want := range map[string]bool{
+		"#!/bin/sh\n": true,
+		"#!":          true,
+		"#":           false,
+		"echo #!\n":   false,
+		"":            false,
+	} {
+		fp := filepath.Join(dir, "script")
+		if err := os.WriteFile(fp, []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got := hasShebang(fp); got != want {
+			t.Errorf("hasShebang(%q) = %v, want %v", text, got, want)
+		}
+	}
+	if hasShebang(filepath.Join(dir, "missing")) {
+		t.Error("hasShebang of a missing file is true")
+	}
+}
+
+func TestGitBashCandidates(t *testing.T) {
+	env := map[string]string{
+		"ProgramFiles": "/c/Program Files",
+		"LocalAppData": "/c/Users/me/AppData/Local",
+		"SystemRoot":   "/c/Windows",
+	}
+	getenv := func(key string) string { return env[key] }
+	fromPF := []string{
+		filepath.Join("/c/Program Files", "Git", "bin", "bash.exe"),
+		filepath.Join("/c/Users/me/AppData/Local", "Git", "bin", "bash.exe"),
+	}
+	tests := []struct {
+		git, pathBash string
+		want          []string
+	}{
+		{"", "", fromPF},
+		{"/d/Git/cmd/git.exe", "", append([]string{
+			filepath.Join("/d/Git/cmd", "bash.exe"),
+			filepath.Join("/d/Git", "bin", "bash.exe"),
+			filepath.Join("/d", "bin", "bash.exe"),
+		}, fromPF...)},
+		{"", "/d/msys/bash.exe", append(append([]string{}, fromPF...), "/d/msys/bash.exe")},
+		// the bash of System32 starts WSL
+		{"", "/c/Windows/System32/bash.exe", fromPF},
+		{"", "/C/WINDOWS/system32/bash.exe", fromPF},
+	}
+	for _, tt := range tests {
+		if got := gitBashCandidates(tt.git, tt.pathBash, getenv); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("gitBashCandidates(%q, %q) = %q, want %q", tt.git, tt.pathBash, got, tt.want)
+		}
+	}
+}
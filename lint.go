@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const USAGE_LINT_INDEX = "Usage:\n\trun -lint-index [--json] [--fix]\n\nChecks the commands of the index: argument counts, names which cannot be run\nor hide internal commands or scripts, duplicates, and scripts shared by several\ncommands. Exits with 1 if errors are found. --fix removes identical duplicates\nand the leading dashes and spaces of names, if the fixed name is free.\n"
+
+// LintIndexCmd reports semantic problems of the index, which -fmt and the
+// JSON decoder accept.
+func LintIndexCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-lint-index")
+	asJson := fs.Bool("json", false, "")
+	fix := fs.Bool("fix", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_LINT_INDEX))
+	}
+	var cmds []jsonCmd
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		cmds = append(cmds, *cmd)
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	findings, fixed, nFixed, err := lintIndex(scriptDp, indexFp, cmds, *fix)
+	if err != nil {
+		return err
+	}
+
+	if nFixed > 0 {
+		if err := checkWritable(scriptDp); err != nil {
+			return err
+		}
+		if err := writeIndex(indexFp, fixed); err != nil {
+			return err
+		}
+		if err := audit(scriptDp, "-lint-index", args); err != nil {
+			return err
+		}
+	}
+	if *asJson {
+		if findings == nil {
+			findings = []finding{}
+		}
+		raw, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(raw))
+	}
+	failed := false
+	for _, f := range findings {
+		failed = failed || f.Severity == "error"
+		if !*asJson {
+			fmt.Printf("%-8s %s: %s\n", f.Severity, f.Command, f.Message)
+		}
+	}
+	switch {
+	case *asJson:
+	case nFixed > 0:
+		fmt.Printf(tr("Fixed %d problem(s).\n"), nFixed)
+	case len(findings) == 0:
+		fmt.Println(tr("No problems found."))
+	}
+	if failed {
+		return &SilentExit{Code: 1}
+	}
+	return nil
+}
+
+// lintIndex checks cmds, in the order of the index. With fix, it returns the
+// fixed commands and the number of fixes; fixed problems are not reported.
+func lintIndex(scriptDp, indexFp string, cmds []jsonCmd, fix bool) (findings []finding, fixed []jsonCmd, nFixed int, err error) {
+	report := func(severity, name, format string, a ...interface{}) {
+		findings = append(findings, finding{severity, name, fmt.Sprintf(format, a...)})
+	}
+	taken := make(map[string]bool, len(cmds))
+	for _, cmd := range cmds {
+		taken[cmd.Name] = true
+	}
+
+	first := make(map[string][]byte, len(cmds)) // name => first entry
+	for _, cmd := range cmds {
+		raw, err := json.Marshal(&cmd)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if prev, dup := first[cmd.Name]; dup {
+			switch {
+			case string(prev) != string(raw):
+				report("error", cmd.Name, "registered twice, only the first entry is used")
+			case fix:
+				nFixed++
+				continue
+			default:
+				report("error", cmd.Name, "registered twice with identical entries")
+			}
+			fixed = append(fixed, cmd)
+			continue
+		}
+		first[cmd.Name] = raw
+
+		clean := strings.TrimLeft(strings.TrimSpace(cmd.Name), "-")
+		switch {
+		case cmd.Name == "":
+			report("error", cmd.Name, "the name is empty, the command cannot be run")
+		case clean != cmd.Name && fix && clean != "" && !taken[clean]:
+			delete(taken, cmd.Name)
+			taken[clean] = true
+			cmd.Name = clean
+			nFixed++
+		case strings.HasPrefix(cmd.Name, "-"):
+			report("error", cmd.Name, "the name starts with -, the command cannot be run")
+		case clean != cmd.Name:
+			report("error", cmd.Name, "the name starts or ends with a space")
+		case strings.ContainsAny(cmd.Name, " \t/\\"):
+			report("warning", cmd.Name, "the name contains spaces or path separators")
+		}
+		for _, sub := range subcommands {
+			if sub.name == cmd.Name {
+				report("warning", cmd.Name, "hides the internal command, which stays available as -%s", sub.name)
+			}
+		}
+		m := &cmd.Meta
+		if m.MinNumArgs < 0 || m.MaxNumArgs < -1 || m.MaxNumArgs != -1 && m.MaxNumArgs < m.MinNumArgs {
+			report("error", cmd.Name, "minNumArgs %d and maxNumArgs %d do not fit", m.MinNumArgs, m.MaxNumArgs)
+		}
+		fixed = append(fixed, cmd)
+	}
+
+	// a script shared by commands is intended for variants only
+	byScript := make(map[string][]string)
+	grouped := make(map[string]bool, len(fixed))
+	for _, cmd := range fixed {
+		if cmd.Meta.VariantOf == "" && !grouped[cmd.Name] {
+			grouped[cmd.Name] = true
+			script := filepath.Clean(cmd.Script)
+			byScript[script] = append(byScript[script], cmd.Name)
+		}
+	}
+	for script, names := range byScript {
+		if len(names) > 1 {
+			sort.Strings(names)
+			report("warning", names[0], "shares the script %s with %s", script, strings.Join(names[1:], ", "))
+		}
+	}
+
+	// run <name> prefers the command over a script of that file name
+	scripts, _, err := unregisteredScripts(scriptDp, indexFp)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for _, fp := range scripts {
+		if name := scriptName(fp); taken[name] {
+			report("warning", name, "hides the script %s, which cannot be run by its name", fp)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Command < findings[j].Command })
+	return findings, fixed, nFixed, nil
+}
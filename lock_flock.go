@@ -0,0 +1,30 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockSupported reports whether tryLock works on this platform.
+const lockSupported = true
+
+// tryLock takes an exclusive lock on fp without waiting. ok is false if
+// another process, or another open file of this one, holds it. The kernel
+// releases the lock when run exits, even when it is killed.
+func tryLock(fp string) (release func(), ok bool, err error) {
+	file, err := os.OpenFile(fp, os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return func() { file.Close() }, true, nil
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// lockSupported reports whether tryLock works on this platform.
+const lockSupported = false
+
+// tryLock is not implemented on this platform.
+func tryLock(fp string) (release func(), ok bool, err error) {
+	return nil, false, fmt.Errorf(tr("maxConcurrentRuns is not supported on %s.\n"), runtime.GOOS)
+}
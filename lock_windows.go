@@ -0,0 +1,27 @@
+package main
+
+import "syscall"
+
+const errSharingViolation syscall.Errno = 32
+
+// lockSupported reports whether tryLock works on this platform.
+const lockSupported = true
+
+// tryLock opens fp without sharing it, which is an exclusive lock. ok is false
+// if another process, or another handle of this one, holds it. Windows closes
+// the handle when run exits, even when it is killed.
+func tryLock(fp string) (release func(), ok bool, err error) {
+	name, err := syscall.UTF16PtrFromString(fp)
+	if err != nil {
+		return nil, false, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errSharingViolation {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return func() { syscall.CloseHandle(h) }, true, nil
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -17,28 +23,80 @@ const (
 	INDEX_FILE string = "cmd_mappings.json"
 )
 
-var InternalCmds = []string{
-	"-init",
-	"-new",
-	"-mod",
-	"-del",
-	"-tidy",
-	"-list",
-}
-
 func main() {
-	home, err := userHomeDir() // custom implementation to account for "sudo" command.
+	start := time.Now()
+	globals, args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		GracefulExit(err)
+	}
+	if n := len(os.Args) - len(args); n > 1 {
+		globalArgs = os.Args[1:n]
+	}
+	if globals.trace {
+		traceStart = start
+	}
+	if globals.offline {
+		os.Setenv("RUN_OFFLINE", "1") // nested runs stay offline
+	}
+	offline = os.Getenv("RUN_OFFLINE") == "1"
+	var home string
+	if globals.portable || PORTABLE == "true" {
+		home, err = executableDir() // <exe dir>/.run/cmd/:platform
+		portableRoot = home
+	} else {
+		home, err = userHomeDir() // custom implementation to account for "sudo" command.
+	}
 	if err != nil {
 		GracefulExit(err)
 	}
+	trace("home resolved: %s", home)
+	runDp := filepath.Join(home, BASE_DIR) // ~/.run
+	if globals.system {
+		runDp, portableRoot = systemDir(), ""
+	}
 	platform, err := getPlatform()
 	if err != nil {
 		GracefulExit(err)
 	}
-	scriptDp := filepath.Join(home, BASE_DIR, SCRIPT_DIR, platform.String()) // ~/.run/cmd/:platform
-	indexFp := filepath.Join(scriptDp, INDEX_FILE)                           // ~/.run/cmd/:platform/cmd_mapping.json
+	platformName := platform.String()
+	if globals.platform != "" {
+		if platformName, err = checkPlatform(globals.platform); err != nil {
+			GracefulExit(err)
+		}
+	}
+	scriptDp := filepath.Join(runDp, SCRIPT_DIR, platformName) // ~/.run/cmd/:platform
+	indexFp := filepath.Join(scriptDp, INDEX_FILE)             // ~/.run/cmd/:platform/cmd_mapping.json
+	if err := setLanguage(scriptDp, globals.lang); err != nil {
+		GracefulExit(err)
+	}
+	if !globals.system {
+		if runDp, err = selectProfile(runDp, platformName, globals.profile); err != nil {
+			GracefulExit(err)
+		}
+		scriptDp = filepath.Join(runDp, SCRIPT_DIR, platformName)
+		indexFp = filepath.Join(scriptDp, INDEX_FILE)
+	}
+	if err := setEncryption(scriptDp); err != nil {
+		GracefulExit(err)
+	}
+	if err := loadDirContext(); err != nil {
+		GracefulExit(err)
+	}
+	trace("settings loaded")
+	if err := recoverIndex(indexFp); err != nil {
+		fmt.Fprintf(os.Stderr, tr("Failed to recover the index: %s\n"), err)
+	}
 
-	if err := Run(os.Args[1:], scriptDp, indexFp); err != nil {
+	if err := Run(args, scriptDp, indexFp); err != nil {
+		var exit *SilentExit
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
+		// the script failed and reported why itself, pass its exit code on
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitCode(err))
+		}
 		GracefulExit(err)
 	}
 }
@@ -50,48 +108,638 @@ func Run(runArgs []string, scriptDp, indexFp string) (err error) {
 		GracefulExit(USAGE_MSG)
 	}
 
-	// check for internal commands
-	switch runArgs[0] {
-	case "-init":
-		return SetUp(scriptDp, indexFp)
-	case "-new":
-		return CreateCmd(indexFp, runArgs[1:])
-	case "-mod":
-		return ModifyCmd(indexFp, runArgs[1:])
-	case "-del":
-		return DeleteCmd(indexFp, runArgs[1:])
-	case "-tidy":
-		return TidyCmd(scriptDp, indexFp)
-	case "-list":
-		return ListCmd(scriptDp, indexFp)
+	sub, err := lookupSubcommand(runArgs[0], indexFp)
+	if err != nil {
+		return err
+	}
+	if sub != nil {
+		if wantsHelp(runArgs[1:]) {
+			printUsage(sub.usage)
+			return nil
+		}
+		if sub.mutating {
+			if err := checkWritable(scriptDp); err != nil {
+				return err
+			}
+			defer func() {
+				if err == nil {
+					err = audit(scriptDp, "-"+sub.name, runArgs[1:])
+				}
+			}()
+		}
+		return sub.run(scriptDp, indexFp, runArgs[1:])
 	}
 
 	// check for external commands
 	// cmd should either be in cmd_mapping.json or if no result is found, it
 	// should be a name of a script in the platform folder (without ending).
 	// If none of this applies, tell the user that.
-	cmd, err := getCommand(scriptDp, runArgs, indexFp)
+	name, err := contextName(scriptDp, indexFp, runArgs[0])
 	if err != nil {
-		GracefulExit(err)
+		return err
+	}
+	flags, scriptArgs, err := parseRunFlags(runArgs[1:])
+	if err != nil {
+		return err
+	}
+	scriptArgs, argEnv, err := specArgs(scriptDp, indexFp, name, &flags, scriptArgs)
+	if err != nil {
+		return err
 	}
 
-	exe := exec.Command(cmd[0], cmd[1:]...)
+	entry, cmd, err := getCommand(scriptDp, append([]string{name}, scriptArgs...), indexFp)
+	if err != nil {
+		return err
+	}
+
+	if !flags.force {
+		if err := checkCooldown(scriptDp, entry); err != nil {
+			return err
+		}
+	}
+
+	stack, err := callStack(scriptDp, name)
+	if err != nil {
+		return err
+	}
+	ctxEnv, err := contextEnv(scriptDp, name, cmd[0], stack, logLevel(entry, &flags))
+	if err != nil {
+		return err
+	}
+	if err := validateArgs(entry, cmd, ctxEnv); err != nil {
+		return err
+	}
+	if err := checkRequiredBins(scriptDp, entry); err != nil {
+		return err
+	}
+	tools, err := provideTools(scriptDp, entry, true)
+	if err != nil {
+		return err
+	}
+	ctxEnv = append(ctxEnv, toolPathEnv(tools)...)
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	release, err := acquireSlot(scriptDp, conf.MaxConcurrentRuns, stack, flags.noWait)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := runHook(scriptDp, PRE_RUN_HOOK, name, cmd, 0, ctxEnv); err != nil {
+		return err
+	}
+	if conf.ShowNotes {
+		showNotes(entry, flags.plain)
+	}
+
+	// from here on, run has to clean up after the script
+	trap := trapSignals()
+	defer trap.stop()
+	plainPath, cleanup, err := decryptScript(cmd[0])
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	exePath, err := scriptExecutable(scriptDp, plainPath, filepath.Dir(cmd[0]))
+	if err != nil {
+		return err
+	}
+
+	cmdLine := interpreterCmd(exePath, cmd[1:])
+	if flags.interpreter != "" {
+		cmdLine = append(strings.Fields(flags.interpreter), append([]string{exePath}, cmd[1:]...)...)
+	}
+	exe := exec.Command(cmdLine[0], cmdLine[1:]...)
 	exe.Stderr = os.Stderr
 	exe.Stdout = os.Stdout
-	exe.Stdin = os.Stdin
+	stdin, err := scriptStdin(entry, &flags)
+	if err != nil {
+		return err
+	}
+	if f, ok := stdin.(*os.File); ok && f != os.Stdin {
+		defer f.Close()
+	}
+	exe.Stdin = stdin
+	for _, layer := range scriptEnv(entry, &flags, ctxEnv, argEnv) {
+		exe.Env = append(exe.Env, layer.env...)
+	}
+	exe.Dir = entry.Meta.Workdir
+	if flags.workdir != "" {
+		exe.Dir = flags.workdir
+	}
+	if err := prepareExec(exe); err != nil {
+		return err
+	}
+	if flags.plain {
+		lineBuffered(exe)
+	}
+	nice := entry.Meta.Nice
+	if flags.nice != 0 {
+		nice = flags.nice
+	}
+	if err := applyPriority(exe, nice, flags.low || entry.Meta.LowPriority); err != nil {
+		return err
+	}
+	encoding := entry.Meta.Encoding
+	if flags.encoding != "" {
+		encoding = flags.encoding
+	}
+	if err := decodeOutput(exe, encoding); err != nil {
+		return err
+	}
+	var plainOut, plainErr *plainWriter
+	if flags.plain {
+		plainOut, plainErr = newPlainWriters(exe.Stdout, exe.Stderr, maxOutput(entry, conf))
+		exe.Stdout, exe.Stderr = plainOut, plainErr
+	}
+	clip := newTailBuffer(maxOutput(entry, conf)) // the output is still printed
+	if flags.clip || entry.Meta.Clip {
+		exe.Stdout = io.MultiWriter(exe.Stdout, clip)
+	}
+	var progress *progressBar
+	if entry.Meta.Progress {
+		progress = startProgress(exe, !flags.plain && isTerminalFile(os.Stderr))
+	}
+	var filter *outputFilter
+	if entry.Meta.Filter != "" && !flags.raw {
+		if filter, err = startFilter(exe, entry.Meta.Filter); err != nil {
+			return err
+		}
+	}
+
+	status, err := startTerminalStatus(scriptDp, name, flags.plain)
+	if err != nil {
+		return err
+	}
+	trap.restoreOnSignal(status.restore)
+	if progress != nil {
+		trap.restoreOnSignal(progress.hide)
+	}
+	restoreConsole := setConsoleUTF8()
+	trace("exec start: %s", strings.Join(exe.Args, " "))
+	start := time.Now()
+	// only the script gets its umask, not the filter, hooks or files of run
+	restoreUmask, err := applyUmask(entry.Meta.Umask)
+	if err == nil {
+		err = trap.start(exe)
+		restoreUmask()
+	}
+	if err == nil {
+		err = runner.Wait(exe)
+	}
+	status.end(exitCode(err), time.Since(start))
+	var filterErr error
+	if filter != nil {
+		filterErr = filter.Wait()
+	}
+	if progress != nil {
+		progress.end()
+	}
+	if flags.plain {
+		plainOut.Flush()
+		plainErr.Flush()
+	}
+	restoreConsole()
+	trace("exec end: exit code %d after %s", exitCode(err), time.Since(start))
 
-	err = exe.Run()
+	record := historyEntry{
+		Name:         name,
+		Script:       cmd[0],
+		Args:         cmd[1:],
+		RunArgs:      append([]string{}, runArgs[1:]...),
+		Start:        start,
+		DurationMs:   time.Since(start).Milliseconds(),
+		ExitCode:     exitCode(err),
+		InvocationID: invocationID(ctxEnv),
+	}
+	if histErr := appendHistory(scriptDp, &record); histErr != nil {
+		fmt.Fprintf(os.Stderr, tr("Failed to record history: %s\n"), histErr)
+	} else if histErr := autoPruneHistory(scriptDp); histErr != nil {
+		fmt.Fprintf(os.Stderr, tr("Failed to prune history: %s\n"), histErr)
+	}
+	if receiptErr := writeReceipt(scriptDp, &record); receiptErr != nil {
+		fmt.Fprintf(os.Stderr, tr("Failed to write the receipt: %s\n"), receiptErr)
+	}
+	if metricsErr := reportMetrics(scriptDp, &record, ctxEnv); metricsErr != nil {
+		fmt.Fprintf(os.Stderr, tr("Failed to report metrics: %s\n"), metricsErr)
+	}
+	// a failed hook fails the run, but not before the steps below
+	hookErr := runHook(scriptDp, POST_RUN_HOOK, name, cmd, exitCode(err), ctxEnv)
+	if onExitErr := runOnExit(scriptDp, &record, ctxEnv); onExitErr != nil {
+		fmt.Fprintf(os.Stderr, tr("Failed to run onSuccess or onFailure: %s\n"), onExitErr)
+	}
+	if filterErr != nil {
+		if err == nil && hookErr == nil {
+			return filterErr
+		}
+		// the script likely died of SIGPIPE, the filter is the cause
+		fmt.Fprint(os.Stderr, filterErr)
+	}
+	if err == nil && filterErr == nil && (flags.clip || entry.Meta.Clip) {
+		if clip.Truncated() {
+			fmt.Fprintf(os.Stderr, tr("run: the output exceeded %s, only its end is copied to the clipboard. Raise it with run -mod %s --max-output <size>.\n"), formatSize(int64(clip.max)), name)
+		}
+		// like $(...), without the final line break
+		out := strings.TrimSuffix(strings.TrimSuffix(string(clip.Bytes()), "\n"), "\r")
+		if err := writeClipboard(out); err != nil {
+			return err
+		}
+	}
+	if err == nil && hookErr != nil {
+		return hookErr
+	}
 	if err != nil && strings.HasSuffix(err.Error(), "exec format error") {
-		return fmt.Errorf(MissingShebangErrorMsg)
+		if runtime.GOOS == "plan9" {
+			return fmt.Errorf(tr(MissingShebangErrorMsgPlan9))
+		}
+		return fmt.Errorf(tr(MissingShebangErrorMsg))
 	}
 	return err
 }
 
-// GracefulExit does not honor deferred functions.
+// specArgs adds the arguments of --params and -i to the ones given, which
+// follow them. The arguments of the spec passed as environment variables are
+// returned as KEY=VALUE.
+func specArgs(scriptDp, indexFp, name string, flags *runFlags, scriptArgs []string) (args []string, env []string, err error) {
+	if flags.params != "" {
+		var paramArgs []string
+		paramArgs, env, err = loadParams(scriptDp, indexFp, name, flags.params)
+		if err != nil {
+			return nil, nil, err
+		}
+		scriptArgs = append(paramArgs, scriptArgs...)
+	}
+	if flags.interactive {
+		askedArgs, askedEnv, err := askArgs(scriptDp, indexFp, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		scriptArgs = append(askedArgs, scriptArgs...)
+		env = append(env, askedEnv...)
+	}
+	return scriptArgs, env, nil
+}
+
+// envLayer is a source of variables of a script.
+type envLayer struct {
+	source string
+	env    []string // KEY=VALUE
+}
+
+// scriptEnv returns the sources of the environment of a script in order, later
+// values win: the inherited environment, the context of contextEnv, the stored
+// environment of the command, the context of the working directory, the
+// profile, the arguments passed as variables, PATH with the pathPrepend
+// folders and --with-env.
+func scriptEnv(entry *jsonCmd, flags *runFlags, ctxEnv, argEnv []string) []envLayer {
+	inherited := os.Environ()
+	if flags.cleanEnv || entry.Meta.CleanEnv {
+		inherited = cleanEnviron()
+	}
+	layers := []envLayer{
+		{"inherited", inherited},
+		{"context", ctxEnv},
+		{"command", entry.Meta.Env},
+		{"project", dirContextEnv()},
+		{"profile", profileEnv()},
+		{"arguments", argEnv},
+	}
+	if len(entry.Meta.PathPrepend) > 0 {
+		layers = append(layers, envLayer{"pathPrepend", pathPrependEnv(entry, flags, layers)})
+	}
+	if len(flags.withEnv) > 0 {
+		layers = append(layers, envLayer{"--with-env", flags.withEnv})
+	}
+	if flags.plain {
+		layers = append(layers, envLayer{"--plain-output", []string{"NO_COLOR=1"}})
+	}
+	return layers
+}
+
+// pathPrependEnv returns the PATH of layers with the pathPrepend folders of
+// entry in front. Relative folders are resolved against the working directory
+// of the script, so that ./node_modules/.bin is the one of the project.
+func pathPrependEnv(entry *jsonCmd, flags *runFlags, layers []envLayer) []string {
+	workdir := entry.Meta.Workdir
+	if flags.workdir != "" {
+		workdir = flags.workdir
+	}
+	if workdir == "" {
+		workdir, _ = os.Getwd()
+	}
+	var dirs []string
+	for _, dir := range entry.Meta.PathPrepend {
+		if expanded, err := expandHome(dir); err == nil {
+			dir = expanded
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workdir, dir)
+		}
+		dirs = append(dirs, dir)
+	}
+	// the PATH of the last layer setting it, f. e. with the tool cache
+	path := ""
+	for _, layer := range layers {
+		for _, kv := range layer.env {
+			if i := strings.IndexByte(kv, '='); i > 0 && isPathKey(kv[:i]) {
+				path = kv[i+1:]
+			}
+		}
+	}
+	if path != "" {
+		dirs = append(dirs, path)
+	}
+	return []string{"PATH=" + strings.Join(dirs, string(os.PathListSeparator))}
+}
+
+// isPathKey reports whether key is PATH, which is Path on Windows, where the
+// keys are case-insensitive.
+func isPathKey(key string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(key, "PATH")
+	}
+	return key == "PATH"
+}
+
+// runFlags are the options of run itself. They are given between the command
+// name and the arguments for the script, f. e.
+// $ run deploy --params prod.yaml -- --force
+type runFlags struct {
+	params    string
+	encoding  string
+	stdin     string
+	stdinSet  bool // --stdin "" is valid, an empty input
+	stdinFile string
+	nice      int
+	low       bool
+	force     bool // ignores the cooldown
+	cleanEnv  bool
+	clip      bool
+	noWait    bool // fails instead of waiting for a slot of maxConcurrentRuns
+	raw       bool // skips the filter of the command
+	plain     bool // strips escape sequences and writes whole lines only
+	// interactive asks for the arguments of the spec, f. e. run deploy -i
+	interactive bool
+	logLevel    string // set by --verbose and --quiet
+	// withEnv, workdir and interpreter override the stored options of the
+	// command for this run only, f. e. run deploy --with-env DRY_RUN=1
+	withEnv     []string
+	workdir     string
+	interpreter string
+}
+
+// parseRunFlags consumes the leading options of run from args and returns the
+// remaining arguments for the script. Parsing stops at the first argument that
+// is not an option of run. "--" ends the options explicitly, so that scripts
+// can receive arguments which look like options of run.
+func parseRunFlags(args []string) (flags runFlags, rest []string, err error) {
+	for len(args) > 0 {
+		opt, val, hasVal := args[0], "", false
+		if i := strings.IndexByte(opt, '='); strings.HasPrefix(opt, "--") && i >= 0 {
+			opt, val, hasVal = opt[:i], opt[i+1:], true
+		}
+		// value returns the value of the option, either given as --opt=val
+		// or as the next argument.
+		value := func() (string, error) {
+			if hasVal {
+				return val, nil
+			}
+			if len(args) < 2 {
+				return "", fmt.Errorf(tr("Option %s requires a value.\n"), opt)
+			}
+			args = args[1:]
+			return args[0], nil
+		}
+
+		switch opt {
+		case "--":
+			return flags, args[1:], nil
+		case "--params":
+			if flags.params, err = value(); err != nil {
+				return
+			}
+		case "--encoding":
+			if flags.encoding, err = value(); err != nil {
+				return
+			}
+		case "--stdin":
+			if flags.stdin, err = value(); err != nil {
+				return
+			}
+			flags.stdinSet = true
+		case "--stdin-file":
+			if flags.stdinFile, err = value(); err != nil {
+				return
+			}
+		case "--nice":
+			var n string
+			if n, err = value(); err != nil {
+				return
+			}
+			if flags.nice, err = parseNice(n); err != nil {
+				return
+			}
+		case "--low-priority":
+			flags.low = true
+		case "--force":
+			flags.force = true
+		case "--clean-env":
+			flags.cleanEnv = true
+		case "--clip":
+			flags.clip = true
+		case "--no-wait":
+			flags.noWait = true
+		case "--raw":
+			flags.raw = true
+		case "--plain-output":
+			flags.plain = true
+		case "--interactive":
+			flags.interactive = true
+		case "--with-env":
+			var kv string
+			if kv, err = value(); err != nil {
+				return
+			}
+			if strings.IndexByte(kv, '=') <= 0 {
+				return flags, nil, fmt.Errorf(tr("--with-env expects KEY=VALUE, got %q.\n"), kv)
+			}
+			flags.withEnv = append(flags.withEnv, kv)
+		case "--with-workdir":
+			if flags.workdir, err = value(); err != nil {
+				return
+			}
+			if flags.workdir, err = expandHome(flags.workdir); err != nil {
+				return
+			}
+		case "--with-interpreter":
+			if flags.interpreter, err = value(); err != nil {
+				return
+			}
+		case "--verbose":
+			flags.logLevel = "debug"
+		case "--quiet":
+			flags.logLevel = "error"
+		case "-i":
+			// only alone, scripts often take a -i of their own
+			if len(args) > 1 {
+				return flags, args, nil
+			}
+			flags.interactive = true
+		default:
+			return flags, args, nil
+		}
+		args = args[1:]
+	}
+	return flags, args, nil
+}
+
+// parseNice parses a nice value, which ranges from -20 (highest priority) to
+// 19 (lowest).
+func parseNice(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < -20 || n > 19 {
+		return 0, fmt.Errorf(tr("Nice value must be a number from -20 to 19, got %q.\n"), s)
+	}
+	return n, nil
+}
+
+// logLevels are the values of $RUN_LOG_LEVEL, from the most verbose.
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// logLevel returns the log level of the script: the one of --verbose or
+// --quiet, else the one of the command, else the inherited one of a script
+// calling run, else info.
+func logLevel(entry *jsonCmd, flags *runFlags) string {
+	switch inherited := os.Getenv("RUN_LOG_LEVEL"); {
+	case flags.logLevel != "":
+		return flags.logLevel
+	case entry.Meta.LogLevel != "":
+		return entry.Meta.LogLevel
+	case contains(logLevels, inherited):
+		return inherited
+	}
+	return "info"
+}
+
+// contextEnv returns the variables telling a script how it is run:
+//
+//	RUN_NAME           name of the command
+//	RUN_SCRIPT_PATH    path of the script
+//	RUN_HOME           the folder of run, ~/.run
+//	RUN_INVOCATION_ID  random id of this execution, also passed to the hooks
+//	RUN_CALLER_PWD     working directory run was called from
+//	RUN_CALL_STACK     the names of the nested commands, one per line
+//	RUN_PARENT_INVOCATION_ID
+//	                   id of the execution which called run, if any
+//	RUN_LOG_LEVEL      verbosity the script should log with: debug, info, warn
+//	                   or error
+func contextEnv(scriptDp, name, script string, stack []string, level string) ([]string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	env := []string{
+		"RUN_NAME=" + name,
+		"RUN_SCRIPT_PATH=" + script,
+		"RUN_HOME=" + baseDir(scriptDp),
+		"RUN_INVOCATION_ID=" + hex.EncodeToString(id),
+		"RUN_CALLER_PWD=" + pwd,
+		"RUN_CALL_STACK=" + strings.Join(stack, "\n"),
+		"RUN_LOG_LEVEL=" + level,
+	}
+	if parent := os.Getenv("RUN_INVOCATION_ID"); parent != "" {
+		env = append(env, "RUN_PARENT_INVOCATION_ID="+parent)
+	}
+	return env, nil
+}
+
+// cleanEnviron returns the variables of cleanEnvKeys of the environment.
+func cleanEnviron() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, "=", 2)[0]
+		for _, k := range cleanEnvKeys {
+			// Windows ignores the case of names
+			if key == k || runtime.GOOS == "windows" && strings.EqualFold(key, k) {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// parseUmask parses an octal umask like 022 or 0077.
+func parseUmask(s string) (int, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf(tr("Umask must be an octal mode from 000 to 777, got %q.\n"), s)
+	}
+	return int(n), nil
+}
+
+// scriptStdin returns the input of the script: the options --stdin or
+// --stdin-file, else the stored input of the command, else the stdin of run.
+// Like a here-string of bash, a literal input is terminated by a newline.
+func scriptStdin(entry *jsonCmd, flags *runFlags) (io.Reader, error) {
+	literal, literalSet, file := entry.Meta.Stdin, entry.Meta.Stdin != "", entry.Meta.StdinFile
+	if flags.stdinSet || flags.stdinFile != "" {
+		literal, literalSet, file = flags.stdin, flags.stdinSet, flags.stdinFile
+	}
+	switch {
+	case literalSet && file != "":
+		return nil, fmt.Errorf(tr("Use either --stdin or --stdin-file, not both.\n"))
+	case literalSet:
+		if !strings.HasSuffix(literal, "\n") {
+			literal += "\n"
+		}
+		return strings.NewReader(literal), nil
+	case file != "":
+		return os.Open(file)
+	}
+	return os.Stdin, nil
+}
+
+// exitCode returns the exit code of a process which returned err. It returns
+// -1 if the process could not be started or was killed.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code != -1 {
+			return code
+		}
+		return signalExitCode(exitErr.ProcessState)
+	}
+	return -1
+}
+
+// SilentExit makes run exit with Code without printing anything, f. e. when
+// -doctor already reported the problems it found.
+type SilentExit struct {
+	Code int
+}
+
+func (e *SilentExit) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// GracefulExit does not honor deferred functions. Errors exit with 1, so
+// that scripts calling run notice them.
 func GracefulExit(v interface{}) {
 	switch val := v.(type) {
 	case error:
-		fmt.Println(val.Error(), USAGE_MSG)
+		fmt.Println(tr(val.Error()), tr(USAGE_MSG))
+		os.Exit(1)
+	case string:
+		fmt.Println(tr(val))
 	default:
 		fmt.Println(val)
 	}
@@ -101,8 +749,14 @@ func GracefulExit(v interface{}) {
 var USAGE_MSG = `
 Usage: 
 	run <script_name> [args]
+	run help
 `
 
+// baseDir returns ~/.run for the script directory ~/.run/cmd/:platform.
+func baseDir(scriptDp string) string {
+	return filepath.Dir(filepath.Dir(scriptDp))
+}
+
 /******************************************************************************/
 
 type osType int
@@ -112,6 +766,7 @@ const (
 	UNSUPPORTED osType = iota
 	UNIX
 	WINDOWS
+	PLAN9
 )
 
 var osTypeToString = []string{
@@ -119,18 +774,33 @@ var osTypeToString = []string{
 	UNSUPPORTED: "",
 	UNIX:        "unix",
 	WINDOWS:     "windows",
+	PLAN9:       "plan9",
 }
 
 func (t osType) String() string {
 	return osTypeToString[t]
 }
 
+// checkPlatform validates the name of a platform given with --platform.
+func checkPlatform(name string) (string, error) {
+	for _, p := range osTypeToString[UNIX:] {
+		if name == p {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf(tr("Unknown platform %q, use one of: %s\n"), name, strings.Join(osTypeToString[UNIX:], ", "))
+}
+
 func getPlatform() (osType, error) {
 	switch runtime.GOOS {
-	case "linux", "darwin":
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly", "android":
 		return UNIX, nil
 	case "windows":
 		return WINDOWS, nil
+	case "plan9":
+		// rc scripts are not compatible with sh, thus plan9 gets its own
+		// scripts.
+		return PLAN9, nil
 	default:
 		return UNSUPPORTED, fmt.Errorf("run does not support %q as a platform. See github.com/liamvdv/do", runtime.GOOS)
 	}
@@ -139,8 +809,94 @@ func getPlatform() (osType, error) {
 /******************************************************************************/
 
 type meta struct {
-	MinNumArgs int `json:"minNumArgs"`
-	MaxNumArgs int `json:"maxNumArgs"`
+	MinNumArgs int       `json:"minNumArgs"`
+	MaxNumArgs int       `json:"maxNumArgs"`
+	Args       []argSpec `json:"args,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	// Description says what the command does, shown by -list.
+	Description string `json:"description,omitempty"`
+	// Notes are what to know about running the command, f. e. "refresh the
+	// token first", set with -note.
+	Notes []string `json:"notes,omitempty"`
+	// VariantOf names the command this one is a variant of: it shares its
+	// script, but passes DefaultArgs in front of the given arguments.
+	VariantOf   string   `json:"variantOf,omitempty"`
+	DefaultArgs []string `json:"defaultArgs,omitempty"`
+	Encoding    string   `json:"encoding,omitempty"`
+	Env         []string `json:"env,omitempty"`     // KEY=VALUE
+	Workdir     string   `json:"workdir,omitempty"` // "" is the current one
+	// ExpectEvery is the cadence the command should succeed in, f. e. 24h.
+	ExpectEvery string `json:"expectEvery,omitempty"`
+	// ScriptOverrides maps a GOOS to a script replacing Script there, f. e.
+	// because macOS ships the BSD and Linux the GNU tools.
+	ScriptOverrides map[string]string `json:"scriptOverrides,omitempty"`
+	// Candidates are scripts tried in order before the others, the first
+	// one existing on this machine is run, f. e. a machine-specific override
+	// of a synced script.
+	Candidates []string `json:"candidateScripts,omitempty"`
+	// Stdin or StdinFile is the default input of the script.
+	Stdin     string `json:"stdin,omitempty"`
+	StdinFile string `json:"stdinFile,omitempty"`
+	// Nice is the scheduling priority from -20 (highest) to 19 (lowest).
+	Nice int `json:"nice,omitempty"`
+	// LowPriority also lowers the IO priority, where possible.
+	LowPriority bool `json:"lowPriority,omitempty"`
+	// Pinned commands are favorites, listed first by -list --smart.
+	Pinned bool `json:"pinned,omitempty"`
+	// Umask is the octal file mode creation mask of the script on unix, f. e.
+	// 077. "" inherits the one of the invoking shell.
+	Umask string `json:"umask,omitempty"`
+	// Cooldown refuses to run the command again within this duration after
+	// it succeeded, f. e. 10m, unless --force is given.
+	Cooldown string `json:"cooldown,omitempty"`
+	// CleanEnv starts the script with only the variables of cleanEnvKeys and
+	// Env instead of the whole environment of run.
+	CleanEnv bool `json:"cleanEnv,omitempty"`
+	// Validate is a script run with the arguments before the command. If it
+	// exits non-zero, the command does not run.
+	Validate string `json:"validateCmd,omitempty"`
+	// Clip copies the output of the script to the clipboard after it
+	// succeeded, f. e. for scripts generating a token.
+	Clip bool `json:"clip,omitempty"`
+	// Filter is a command line of the shell the output is piped through, f. e.
+	// "jq .", unless --raw is given.
+	Filter string `json:"filterCmd,omitempty"`
+	// Progress renders the progress the script reports with lines like
+	// "::progress 42 building" on stderr as a bar, see PROGRESS_PREFIX.
+	Progress bool `json:"progress,omitempty"`
+	// RequiresBin are the programs the script calls. They must be in PATH,
+	// else the script does not run. InstallHints tells how to install one.
+	RequiresBin  []string          `json:"requiresBin,omitempty"`
+	InstallHints map[string]string `json:"installHints,omitempty"`
+	// Examples are invocations of the command shown by -doc, each with an
+	// explanation after " # ", f. e. "eu --dry-run # preview a deployment".
+	Examples []string `json:"examples,omitempty"`
+	// MaxOutput limits the output run holds of the script, f. e. 50MB, for
+	// --clip and --plain-output. The clipboard receives the end of longer
+	// output. "" is maxOutput of the config.
+	MaxOutput string `json:"maxOutput,omitempty"`
+	// LogLevel is the $RUN_LOG_LEVEL of the script, one of logLevels. ""
+	// is info, unless inherited.
+	LogLevel string `json:"logLevel,omitempty"`
+	// OS and Arch restrict the machines the command runs on to these GOOS
+	// and GOARCH values, f. e. linux and arm64. Empty allows any.
+	OS   []string `json:"os,omitempty"`
+	Arch []string `json:"arch,omitempty"`
+	// PathPrepend are folders put in front of PATH in this order, f. e.
+	// ~/bin or ./node_modules/.bin, relative to the working directory.
+	PathPrepend []string `json:"pathPrepend,omitempty"`
+}
+
+// argSpec names an argument of a script. If Env is set, the argument is passed
+// as environment variable instead of as positional argument.
+type argSpec struct {
+	Name string `json:"name"`
+	Env  string `json:"env,omitempty"`
+	// Description, Type and Choices guide run <cmd> -i. Type is one of
+	// argTypes, "" is any string; Choices are the only valid values.
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Choices     []string `json:"choices,omitempty"`
 }
 
 type jsonCmd struct {
@@ -149,62 +905,197 @@ type jsonCmd struct {
 	Meta   meta   `json:"options"`
 }
 
+// ScriptPath returns the script to execute on this machine: the first existing
+// candidate, else the script for this OS, else the script.
+func (c *jsonCmd) ScriptPath() string {
+	for _, script := range c.Meta.Candidates {
+		if _, err := os.Stat(script); err == nil {
+			return script
+		}
+	}
+	if script, ok := c.Meta.ScriptOverrides[runtime.GOOS]; ok {
+		return script
+	}
+	return c.Script
+}
+
 /******************************************************************************/
 
 const MissingShebangErrorMsg = `You need to add a shebang to your script.
 A shebang is the first line of your script, for example:
   #!/bin/sh
 or
-  #!/bin/bash`
+  #!/usr/bin/env bash`
+
+// bash is not installed to /bin on the BSDs, thus env is recommended above.
+// Plan 9 has neither.
+const MissingShebangErrorMsgPlan9 = `You need to add a shebang to your script.
+A shebang is the first line of your script, for example:
+  #!/bin/rc`
 
 var CmdNotFoundErr = fmt.Errorf("Command not found.")
 
 // args is expected to contain all arguments excluding the "run"
-func getCommand(dirpath string, args []string, indexFp string) ([]string, error) {
+// getCommand returns the matching index entry, or for scripts found in the
+// platform folder an entry with default options, and the command line.
+func getCommand(dirpath string, args []string, indexFp string) (*jsonCmd, []string, error) {
 	name := args[0]
 	argsToScriptN := len(args) - 1
 
 	cmd := jsonCmd{}
-	err := Find(indexFp, name, &cmd)
-	if err == nil {
+	err := findRegistered(dirpath, indexFp, name, &cmd)
+	if err != nil && !errors.Is(err, CmdNotFoundErr) {
+		return nil, nil, err
+	}
+	registered := err == nil
+	conf, err := loadConfig(dirpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fName string
+	var containsDir bool
+	if !conf.RequireRegistered {
+		if fName, containsDir, err = findScriptFile(dirpath, name); err != nil {
+			return nil, nil, err
+		}
+	}
+	shadowed := false // the file is run instead of the command
+	if registered && fName != "" && filepath.Join(dirpath, fName) != cmd.ScriptPath() {
+		if conf.ResolveOrder == "" {
+			fmt.Fprintf(os.Stderr, tr("run: %s is a command and the script %s, running the command. Set resolveOrder to index or file to choose.\n"), name, fName)
+		}
+		shadowed = conf.ResolveOrder == RESOLVE_FILE
+		registered = !shadowed
+	}
+
+	if registered {
+		trace("index lookup: found %s", name)
+		if reason := unavailable(&cmd); reason != "" {
+			return nil, nil, fmt.Errorf(tr("%s is not available on this machine, it is %s.\n"), name, reason)
+		}
 		checks := cmd.Meta
 		// -1 allows any number or args
 		if !(checks.MinNumArgs <= argsToScriptN) || (checks.MaxNumArgs != -1 && !(argsToScriptN <= checks.MaxNumArgs)) {
-			return nil, invalidArgsError(&cmd, argsToScriptN)
+			return nil, nil, invalidArgsError(&cmd, argsToScriptN)
+		}
+		args[0] = cmd.ScriptPath()
+		if len(cmd.Meta.DefaultArgs) > 0 {
+			args = append(append(args[:1:1], cmd.Meta.DefaultArgs...), args[1:]...)
+		}
+		return &cmd, args, nil
+	}
+	trace("index lookup: %s not registered", name)
+	if conf.RequireRegistered {
+		return nil, nil, CmdNotFoundErr
+	}
+	remind := !shadowed
+	defer func() {
+		if remind {
+			hint(dirpath, HINT_UNREGISTERED, "Have you forgot to add your new script to %q?\n", dirpath)
+		}
+	}()
+
+	if fName != "" {
+		if conf.ConfirmUnregistered && !confirm(fmt.Sprintf(tr("%q is not registered. Run %s?"), name, fName)) {
+			return nil, nil, CmdNotFoundErr
 		}
-		args[0] = cmd.Script
-		return args, nil
+		args[0] = filepath.Join(dirpath, fName)
+		cmd = jsonCmd{Name: name, Script: args[0], Meta: meta{MaxNumArgs: -1}}
+		// a script run by its full file name is adopted without extension,
+		// unless another command has that name
+		stem := scriptName(fName)
+		taken := stem != name && Find(indexFp, stem, &jsonCmd{}) == nil
+		if conf.AutoAdopt && !shadowed && !taken {
+			remind = false
+			if err := adopt(indexFp, stem, args[0]); err != nil {
+				return nil, nil, err
+			}
+			if err := audit(dirpath, "-adopt", []string{stem}); err != nil {
+				return nil, nil, err
+			}
+		}
+		return &cmd, args, nil
+	}
+	if containsDir {
+		hint(dirpath, HINT_FOLDERS, "You should not have folders in %q. It is only ment for script files.\n", dirpath)
 	}
 
-	if err != nil && !errors.Is(err, CmdNotFoundErr) {
-		return nil, err
+	// like command(1), so run works as prefix for any program
+	if conf.PathFallback && checkName(name) == nil {
+		if path, err := exec.LookPath(name); err == nil {
+			trace("PATH fallback: %s", path)
+			remind = false
+			args[0] = path
+			cmd = jsonCmd{Name: name, Script: path, Meta: meta{MaxNumArgs: -1}}
+			return &cmd, args, nil
+		}
+	}
+	if conf.WslInterop && os.Getenv(WSL_BRIDGE_ENV) == "" {
+		bridged, line, err := wslCommand(name, args[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		if bridged != nil {
+			remind = false
+			return bridged, line, nil
+		}
 	}
-	defer fmt.Printf("Have you forgot to add your new script to %q?\n", dirpath)
+	return nil, nil, CmdNotFoundErr
+}
+
+// Values of resolveOrder, which decides between a command and a script of the
+// script folder of the same name. The default "" is RESOLVE_INDEX with a
+// warning.
+const (
+	RESOLVE_INDEX = "index"
+	RESOLVE_FILE  = "file"
+)
 
-	// no matching command was found. Try helping user by assuming "run MyDing someArg123" == ./MyDing.sh someArg123
+// findScriptFile returns the file of the script folder named name, with or
+// without its extension; the full file name is preferred. containsDir reports
+// whether the folder has subfolders, which do not belong there.
+func findScriptFile(dirpath, name string) (fName string, containsDir bool, err error) {
 	entries, err := os.ReadDir(dirpath)
+	if os.IsNotExist(err) {
+		return "", false, nil // only the system registry is set up
+	} else if err != nil {
+		return "", false, err
+	}
+	ignore, err := loadIgnore(dirpath)
 	if err != nil {
-		return nil, err
+		return "", false, err
 	}
-
-	containsDir := false
+	trace("fallback scan of %s: %d entries", dirpath, len(entries))
 	for _, entry := range entries {
+		if ignore.Ignored(entry.Name(), entry.IsDir()) {
+			continue
+		}
 		if entry.IsDir() {
 			containsDir = true
 			continue
 		}
-		fName := entry.Name()
-		ext := filepath.Ext(fName)
-		if fName[:len(fName)-len(ext)] == name {
-			args[0] = filepath.Join(dirpath, fName)
-			return args, nil
+		switch {
+		case entry.Name() == name:
+			return entry.Name(), containsDir, nil
+		case scriptName(entry.Name()) == name && fName == "":
+			fName = entry.Name()
 		}
 	}
-	if containsDir {
-		fmt.Printf("You should not have folders in %q. It is only ment for script files.", dirpath)
-	}
+	return fName, containsDir, nil
+}
 
-	return nil, CmdNotFoundErr
+/******************************************************************************/
+
+// confirm asks the user a yes/no question on the terminal. Without a
+// terminal, f. e. in cron, the answer is no.
+func confirm(question string) bool {
+	if !isTerminal() {
+		return false
+	}
+	fmt.Printf("%s %s ", question, tr("[y/N]"))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes" || answer == tr("y") || answer == tr("yes")
 }
 
 /******************************************************************************/
@@ -212,7 +1103,7 @@ func getCommand(dirpath string, args []string, indexFp string) ([]string, error)
 // userHomeDir is essentially a copy of os.UserHomeDir, but it detects the user
 // who ran the script, not the one executing it. This is important, because
 // -tidy requires priviledges. Using sudo will result in $HOME equaling /root.
-// Thus, we need to check if sudo is used and act accordingly.
+// Thus, we need to check if sudo is used and act accordingly. See realUser.
 func userHomeDir() (string, error) {
 	env, enverr := "HOME", "$HOME"
 	switch runtime.GOOS {
@@ -221,17 +1112,14 @@ func userHomeDir() (string, error) {
 	case "plan9":
 		env, enverr = "home", "$home"
 	// inserted case
-	case "linux", "darwin":
-		// if running as root
-		if os.Geteuid() == 0 {
-			// check if run with sudo
-			if usrname := os.Getenv("SUDO_USER"); usrname != "" {
-				if usr, err := user.Lookup(usrname); err == nil {
-					return usr.HomeDir, nil
-				} else {
-					return "", err
-				}
-			}
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd", "dragonfly", "android":
+		// check if run with sudo, doas, run0 or similar
+		usr, _, err := realUser()
+		if err != nil {
+			return "", err
+		}
+		if usr != nil {
+			return usr.HomeDir, nil
 		}
 	}
 
@@ -241,9 +1129,67 @@ func userHomeDir() (string, error) {
 	// On some geese the home directory is not always defined.
 	switch runtime.GOOS {
 	case "android":
+		// Termux: $PREFIX is /data/data/com.termux/files/usr
+		if prefix := os.Getenv("PREFIX"); prefix != "" {
+			return filepath.Join(filepath.Dir(prefix), "home"), nil
+		}
 		return "/sdcard", nil
 	case "ios":
 		return "/", nil
 	}
 	return "", errors.New(enverr + " is not defined")
 }
+
+// expandHome replaces a leading ~/ of path with the home folder of the user.
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[2:]), nil
+}
+
+// userNameEnvs are the environment variables which name the real user, in
+// order of precedence. RUN_USER allows to override the detection, i. e. for
+// escalation tools run does not know about.
+// run0 sets SUDO_USER for compatibility.
+var userNameEnvs = []string{"RUN_USER", "SUDO_USER", "DOAS_USER"}
+
+// userIdEnvs are only consulted if none of userNameEnvs is set, f. e. if the
+// user does not have an entry in /etc/passwd.
+var userIdEnvs = []string{"SUDO_UID", "PKEXEC_UID"}
+
+// realUser returns the user who invoked run with elevated privileges and the
+// environment variable it was detected through. If run is not elevated and
+// RUN_USER is unset, realUser returns a nil user.
+func realUser() (*user.User, string, error) {
+	for _, env := range userNameEnvs {
+		name := os.Getenv(env)
+		if name == "" || (env != "RUN_USER" && os.Geteuid() != 0) {
+			continue
+		}
+		usr, err := user.Lookup(name)
+		if err != nil {
+			return nil, env, err
+		}
+		return usr, env, nil
+	}
+	if os.Geteuid() != 0 {
+		return nil, "", nil
+	}
+	for _, env := range userIdEnvs {
+		uid := os.Getenv(env)
+		if uid == "" {
+			continue
+		}
+		usr, err := user.LookupId(uid)
+		if err != nil {
+			return nil, env, err
+		}
+		return usr, env, nil
+	}
+	return nil, "", nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetCommand(t *testing.T) {
+	scriptDp, indexFp := newTestRegistry(t)
+	script := filepath.Join(scriptDp, "greet.sh")
+	loose := filepath.Join(scriptDp, "loose.sh")
+	for _, fp := range []string{script, loose} {
+		if err := os.WriteFile(fp, []byte("#!/bin/sh\n"), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, cmd := range []jsonCmd{
+		{Name: "greet", Script: script, Meta: meta{MinNumArgs: 1, MaxNumArgs: 2}},
+		{Name: "hi", Script: script, Meta: meta{MaxNumArgs: -1, DefaultArgs: []string{"--loud"}}},
+	} {
+		cmd := cmd
+		if err := insertIntoIndex(indexFp, &cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+		wantErr  bool
+	}{
+		{[]string{"greet", "you"}, "greet", []string{script, "you"}, false},
+		{[]string{"greet", "you", "all"}, "greet", []string{script, "you", "all"}, false},
+		{[]string{"greet"}, "", nil, true},
+		{[]string{"greet", "1", "2", "3"}, "", nil, true},
+		{[]string{"hi", "you"}, "hi", []string{script, "--loud", "you"}, false},
+		// unregistered scripts of the script folder run by their file name
+		{[]string{"loose.sh", "x"}, "loose.sh", []string{loose, "x"}, false},
+	}
+	for _, tt := range tests {
+		cmd, args, err := getCommand(scriptDp, append([]string{}, tt.args...), indexFp)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("getCommand(%q) succeeded", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getCommand(%q) = %v", tt.args, err)
+			continue
+		}
+		if cmd.Name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("getCommand(%q) = %s %q, want %s %q", tt.args, cmd.Name, args, tt.wantName, tt.wantArgs)
+		}
+	}
+
+	if _, _, err := getCommand(scriptDp, []string{"missing"}, indexFp); !errors.Is(err, CmdNotFoundErr) {
+		t.Errorf("getCommand(missing) = %v, want CmdNotFoundErr", err)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const USAGE_MERGE = "Usage:\n\trun -merge [--base <base.json>] [--ours | --theirs] <ours.json> <theirs.json>\n\nMerges the commands of theirs into ours and writes the result to ours. Commands\nare merged by name and option by option. With the common ancestor as base,\nchanges and deletions of either side are taken over. Conflicts are asked for\non a terminal, else resolved with --ours or --theirs, else ours is kept and\nrun exits with 1. The README shows how to use it as git merge driver.\n"
+
+// MergeCmd merges two indexes, f. e. of a registry synced with git, entry by
+// entry instead of line by line, so a merge never leaves broken JSON behind.
+func MergeCmd(args []string) error {
+	fs := newFlagSet("-merge")
+	baseFp := fs.String("base", "", "")
+	preferOurs := fs.Bool("ours", false, "")
+	preferTheirs := fs.Bool("theirs", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 || *preferOurs && *preferTheirs {
+		return fmt.Errorf(tr(USAGE_MERGE))
+	}
+	oursFp, theirsFp := fs.Arg(0), fs.Arg(1)
+
+	ours, err := loadMergeIndex(oursFp)
+	if err != nil {
+		return err
+	}
+	theirs, err := loadMergeIndex(theirsFp)
+	if err != nil {
+		return err
+	}
+	var base map[string]jsonCmd
+	if *baseFp != "" {
+		if base, err = loadMergeIndex(*baseFp); err != nil {
+			return err
+		}
+	}
+
+	m := merger{base: base}
+	switch {
+	case *preferOurs:
+		m.prefer = "ours"
+	case *preferTheirs:
+		m.prefer = "theirs"
+	case isTerminal():
+		m.p = &prompter{bufio.NewReader(os.Stdin)}
+	}
+	merged, err := m.merge(ours, theirs)
+	if err != nil {
+		return err
+	}
+	if err := writeIndex(oursFp, merged); err != nil {
+		return err
+	}
+	if len(m.conflicts) > 0 {
+		fmt.Printf(tr("%d conflict(s) are left, ours was kept:\n"), len(m.conflicts))
+		for _, c := range m.conflicts {
+			fmt.Println("  " + c)
+		}
+		return &SilentExit{Code: 1}
+	}
+	return nil
+}
+
+// loadMergeIndex reads the commands of an index by name. git passes an empty
+// file as base if the index was added on both sides.
+func loadMergeIndex(fp string) (map[string]jsonCmd, error) {
+	raw, err := readIndex(fp)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]jsonCmd)
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return byName, nil
+	}
+	cmds, err := validateIndex(fp, raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		byName[cmd.Name] = cmd
+	}
+	return byName, nil
+}
+
+// merger merges two indexes. Without base, a command missing on one side is
+// new on the other, never deleted.
+type merger struct {
+	base      map[string]jsonCmd
+	prefer    string    // "ours" or "theirs" resolves all conflicts
+	p         *prompter // asks for conflicts, if prefer is empty
+	conflicts []string  // left unresolved, ours was kept
+}
+
+func (m *merger) merge(ours, theirs map[string]jsonCmd) ([]jsonCmd, error) {
+	names := make(map[string]bool, len(ours))
+	for name := range ours {
+		names[name] = true
+	}
+	for name := range theirs {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var merged []jsonCmd
+	for _, name := range sorted {
+		o, inOurs := ours[name]
+		t, inTheirs := theirs[name]
+		b, inBase := m.base[name]
+		switch {
+		case inOurs && inTheirs:
+			cmd, err := m.mergeCmd(name, b, inBase, o, t)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, cmd)
+		case inOurs:
+			keep, err := m.mergeDeleted(name, b, inBase, o, "theirs")
+			if err != nil {
+				return nil, err
+			}
+			if keep {
+				merged = append(merged, o)
+			}
+		case inTheirs:
+			keep, err := m.mergeDeleted(name, b, inBase, t, "ours")
+			if err != nil {
+				return nil, err
+			}
+			if keep {
+				merged = append(merged, t)
+			}
+		}
+	}
+	return merged, nil
+}
+
+// mergeDeleted decides whether to keep cmd, which only one side has. It was
+// deleted by the other side if the base has it; unchanged, it stays deleted.
+func (m *merger) mergeDeleted(name string, b jsonCmd, inBase bool, cmd jsonCmd, deletedBy string) (bool, error) {
+	if !inBase {
+		return true, nil
+	}
+	bRaw, err := json.Marshal(&b)
+	if err != nil {
+		return false, err
+	}
+	cRaw, err := json.Marshal(&cmd)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(bRaw, cRaw) {
+		return false, nil
+	}
+	conflict := fmt.Sprintf(tr("%s: changed on one side, deleted by %s"), name, deletedBy)
+	keepChanged := deletedBy == "theirs" // the changed side is ours
+	ours, theirs := tr("changed"), tr("deleted")
+	if !keepChanged {
+		ours, theirs = theirs, ours
+	}
+	useOurs, err := m.resolve(conflict, ours, theirs)
+	if err != nil {
+		return false, err
+	}
+	return useOurs == keepChanged, nil
+}
+
+// mergeCmd merges the fields of a command both sides have. A field changed
+// on one side only takes that change.
+func (m *merger) mergeCmd(name string, b jsonCmd, inBase bool, o, t jsonCmd) (jsonCmd, error) {
+	of, err := cmdFields(&o)
+	if err != nil {
+		return o, err
+	}
+	tf, err := cmdFields(&t)
+	if err != nil {
+		return o, err
+	}
+	bf := map[string]json.RawMessage{}
+	if inBase {
+		if bf, err = cmdFields(&b); err != nil {
+			return o, err
+		}
+	}
+
+	keys := make([]string, 0, len(of)+len(tf))
+	for key := range of {
+		keys = append(keys, key)
+	}
+	for key := range tf {
+		if _, ok := of[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	merged := make(map[string]json.RawMessage, len(keys))
+	for _, key := range keys {
+		ov, tv := of[key], tf[key]
+		bv, inB := bf[key]
+		switch {
+		case bytes.Equal(ov, tv):
+			merged[key] = ov
+		case inBase && (inB && bytes.Equal(bv, ov) || !inB && ov == nil):
+			merged[key] = tv
+		case inBase && (inB && bytes.Equal(bv, tv) || !inB && tv == nil):
+			merged[key] = ov
+		default:
+			useOurs, err := m.resolve(fmt.Sprintf("%s: %s", name, key), showField(ov), showField(tv))
+			if err != nil {
+				return o, err
+			}
+			if useOurs {
+				merged[key] = ov
+			} else {
+				merged[key] = tv
+			}
+		}
+	}
+	return fieldsCmd(name, merged)
+}
+
+// resolve decides a conflict, true for ours.
+func (m *merger) resolve(conflict, ours, theirs string) (bool, error) {
+	switch {
+	case m.prefer != "":
+		return m.prefer == "ours", nil
+	case m.p == nil:
+		m.conflicts = append(m.conflicts, conflict)
+		return true, nil
+	}
+	fmt.Printf("%s\n  ours:   %s\n  theirs: %s\n", conflict, ours, theirs)
+	for {
+		answer, err := m.p.ask(tr("Keep (o)urs or (t)heirs?"), "o")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "o", "ours":
+			return true, nil
+		case "t", "theirs":
+			return false, nil
+		}
+	}
+}
+
+// showField prints a field value for the prompt, a missing one as such.
+func showField(v json.RawMessage) string {
+	if v == nil {
+		return tr("(not set)")
+	}
+	return string(v)
+}
+
+// cmdFields flattens cmd into its fields except the name: scriptName and
+// options.<name> for every option set.
+func cmdFields(cmd *jsonCmd) (map[string]json.RawMessage, error) {
+	script, err := json.Marshal(cmd.Script)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(&cmd.Meta)
+	if err != nil {
+		return nil, err
+	}
+	var options map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &options); err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{"scriptName": script}
+	for key, v := range options {
+		fields["options."+key] = v
+	}
+	return fields, nil
+}
+
+// fieldsCmd is the inverse of cmdFields.
+func fieldsCmd(name string, fields map[string]json.RawMessage) (jsonCmd, error) {
+	cmd := jsonCmd{Name: name}
+	options := make(map[string]json.RawMessage)
+	for key, v := range fields {
+		if key == "scriptName" {
+			if err := json.Unmarshal(v, &cmd.Script); err != nil {
+				return cmd, err
+			}
+		} else if v != nil {
+			options[strings.TrimPrefix(key, "options.")] = v
+		}
+	}
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return cmd, err
+	}
+	return cmd, json.Unmarshal(raw, &cmd.Meta)
+}
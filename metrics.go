@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportMetrics exports a datapoint per execution, f. e. so a platform team
+// sees which runbooks are executed how often. With metricsCmd, the script is
+// called with the command name, exit code and duration in milliseconds, also
+// exposed as RUN_METRIC_NAME, RUN_METRIC_EXIT_CODE and RUN_METRIC_DURATION_MS.
+// With statsdAddr, a counter and a timer are sent by UDP, tagged in the
+// DogStatsD format understood by most collectors:
+//
+//	run.executions:1|c|#command:backup,exit_code:0
+//	run.duration:1523|ms|#command:backup,exit_code:0
+func reportMetrics(scriptDp string, record *historyEntry, ctxEnv []string) error {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	if conf.StatsdAddr != "" {
+		if err := sendStatsd(conf.StatsdAddr, record); err != nil {
+			return err
+		}
+	}
+	if conf.MetricsCmd == "" {
+		return nil
+	}
+
+	code, duration := strconv.Itoa(record.ExitCode), strconv.FormatInt(record.DurationMs, 10)
+	cmdLine := interpreterCmd(conf.MetricsCmd, []string{record.Name, code, duration})
+	exe := exec.Command(cmdLine[0], cmdLine[1:]...)
+	exe.Stdout = os.Stderr // do not mix into the script's output
+	exe.Stderr = os.Stderr
+	exe.Env = append(append(os.Environ(), ctxEnv...),
+		"RUN_METRIC_NAME="+record.Name,
+		"RUN_METRIC_EXIT_CODE="+code,
+		"RUN_METRIC_DURATION_MS="+duration,
+	)
+	if err := prepareExec(exe); err != nil {
+		return err
+	}
+	if err := exe.Run(); err != nil {
+		return fmt.Errorf("metricsCmd %q failed: %w", conf.MetricsCmd, err)
+	}
+	return nil
+}
+
+// sendStatsd sends the datapoints of record to the StatsD server at addr.
+// UDP does not wait for the server, an unreachable one goes unnoticed.
+func sendStatsd(addr string, record *historyEntry) error {
+	conn, err := net.DialTimeout("udp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	tags := fmt.Sprintf("|#command:%s,exit_code:%d", statsdTag(record.Name), record.ExitCode)
+	packet := "run.executions:1|c" + tags + "\n" +
+		fmt.Sprintf("run.duration:%d|ms", record.DurationMs) + tags
+	_, err = conn.Write([]byte(packet))
+	return err
+}
+
+// statsdTag replaces the characters separating StatsD fields and tags.
+func statsdTag(s string) string {
+	return strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "\n", "_").Replace(s)
+}
@@ -0,0 +1,736 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formats of -export and -import.
+const (
+	FORMAT_JUSTFILE = "justfile"
+	FORMAT_TASKFILE = "taskfile"
+)
+
+const USAGE_EXPORT = "Usage:\n\trun -export --format justfile|taskfile [--out <file>] [<cmd>...]\n\nWrites the given commands, or all, as recipes of a justfile or tasks of\na Taskfile.yml to stdout or --out. The description, environment, working\ndirectory and default arguments are taken over; commands with options just and\ntask cannot express, f. e. filters or stdin, are skipped and listed.\n"
+
+// ExportCmd converts commands of the index into a justfile or Taskfile, so a
+// team can move to those tools without rewriting every command.
+func ExportCmd(indexFp string, args []string) error {
+	fs := newFlagSet("-export")
+	format := fs.String("format", "", "")
+	out := fs.String("out", "", "")
+	if err := fs.Parse(args); err != nil || *format != FORMAT_JUSTFILE && *format != FORMAT_TASKFILE {
+		return fmt.Errorf(tr(USAGE_EXPORT))
+	}
+	names := make(map[string]bool, fs.NArg())
+	for _, name := range fs.Args() {
+		names[name] = true
+	}
+
+	var cmds []jsonCmd
+	var skipped []string
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		if len(names) > 0 && !names[cmd.Name] {
+			return
+		}
+		delete(names, cmd.Name)
+		if reason := notExportable(cmd, *format); reason != "" {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", cmd.Name, reason))
+			return
+		}
+		cmds = append(cmds, *cmd)
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	for name := range names {
+		return fmt.Errorf(tr("There is no command %q.\n"), name)
+	}
+
+	var b bytes.Buffer
+	if *format == FORMAT_JUSTFILE {
+		writeJustfile(&b, indexFp, cmds)
+	} else {
+		writeTaskfile(&b, indexFp, cmds)
+	}
+	if *out == "" {
+		os.Stdout.Write(b.Bytes())
+	} else if err := os.WriteFile(*out, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintln(os.Stderr, tr("Skipped, their options cannot be expressed:"))
+		for _, s := range skipped {
+			fmt.Fprintln(os.Stderr, "  "+s)
+		}
+	}
+	return nil
+}
+
+// notExportable returns why cmd cannot be exported, "" if it can.
+func notExportable(cmd *jsonCmd, format string) string {
+	m := &cmd.Meta
+	var opts []string
+	add := func(set bool, name string) {
+		if set {
+			opts = append(opts, name)
+		}
+	}
+	add(m.Stdin != "" || m.StdinFile != "", "stdin")
+	add(m.Filter != "", "filterCmd")
+	add(m.Validate != "", "validateCmd")
+	add(len(m.ScriptOverrides) > 0, "scriptOverrides")
+	add(len(m.Candidates) > 0, "candidateScripts")
+	add(m.CleanEnv, "cleanEnv")
+	add(len(m.PathPrepend) > 0, "pathPrepend")
+	add(m.Clip, "clip")
+	add(m.Encoding != "", "encoding")
+	add(m.Umask != "", "umask")
+	add(m.Nice != 0 || m.LowPriority, "nice")
+	add(m.Cooldown != "", "cooldown")
+	add(len(m.RequiresBin) > 0, "requiresBin")
+	add(m.LogLevel != "", "logLevel")
+	add(len(m.OS) > 0 || len(m.Arch) > 0, "os/arch")
+	for _, a := range m.Args {
+		add(a.Env != "", "args passed as environment")
+	}
+	if format == FORMAT_JUSTFILE && !justName.MatchString(cmd.Name) {
+		opts = append(opts, tr("the name is no just recipe name"))
+	}
+	return strings.Join(opts, ", ")
+}
+
+// justName matches the names of just recipes.
+var justName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// exportLine returns the shell line running cmd, without its arguments.
+func exportLine(cmd *jsonCmd) string {
+	words := make([]string, 0, 1+len(cmd.Meta.Env)+len(cmd.Meta.DefaultArgs))
+	for _, kv := range cmd.Meta.Env {
+		kv := strings.SplitN(kv, "=", 2)
+		words = append(words, kv[0]+"="+shQuote(kv[1]))
+	}
+	words = append(words, shQuote(cmd.ScriptPath()))
+	for _, arg := range cmd.Meta.DefaultArgs {
+		words = append(words, shQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+func writeJustfile(b *bytes.Buffer, indexFp string, cmds []jsonCmd) {
+	fmt.Fprintf(b, "# Generated by run -export from %s.\n", indexFp)
+	b.WriteString("set positional-arguments\n")
+	for _, cmd := range cmds {
+		b.WriteString("\n")
+		if cmd.Meta.Description != "" {
+			fmt.Fprintf(b, "# %s\n", cmd.Meta.Description)
+		}
+		fmt.Fprintf(b, "%s *args:\n", cmd.Name)
+		line := exportLine(&cmd) + ` "$@"`
+		if cmd.Meta.Workdir != "" {
+			line = "cd " + shQuote(cmd.Meta.Workdir) + " && " + line
+		}
+		fmt.Fprintf(b, "    %s\n", line)
+	}
+}
+
+func writeTaskfile(b *bytes.Buffer, indexFp string, cmds []jsonCmd) {
+	fmt.Fprintf(b, "# Generated by run -export from %s.\n", indexFp)
+	b.WriteString("version: '3'\n\ntasks:\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(b, "  %s:\n", yamlQuote(cmd.Name))
+		if cmd.Meta.Description != "" {
+			fmt.Fprintf(b, "    desc: %s\n", yamlQuote(cmd.Meta.Description))
+		}
+		if cmd.Meta.Workdir != "" {
+			fmt.Fprintf(b, "    dir: %s\n", yamlQuote(cmd.Meta.Workdir))
+		}
+		// task expands the variables itself
+		var words []string
+		words = append(words, shQuote(cmd.ScriptPath()))
+		for _, arg := range cmd.Meta.DefaultArgs {
+			words = append(words, shQuote(arg))
+		}
+		if len(cmd.Meta.Env) > 0 {
+			b.WriteString("    env:\n")
+			for _, kv := range cmd.Meta.Env {
+				kv := strings.SplitN(kv, "=", 2)
+				fmt.Fprintf(b, "      %s: %s\n", kv[0], yamlQuote(kv[1]))
+			}
+		}
+		fmt.Fprintf(b, "    cmds:\n      - %s\n", yamlQuote(strings.Join(words, " ")+" {{.CLI_ARGS}}"))
+	}
+}
+
+// shQuote quotes s for sh.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// yamlQuote quotes s as single-quoted YAML scalar.
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+/******************************************************************************/
+
+const USAGE_IMPORT = "Usage:\n\trun -import --format justfile|taskfile <file>\n\nRegisters the recipes of a justfile or the tasks of a Taskfile.yml as commands.\nThe lines of each become a script in the script folder. Recipes with\nparameters other than a variadic one, dependencies or template expressions are\nskipped and listed, as are names already registered.\n"
+
+// importedCmd is a recipe or task converted into a script.
+type importedCmd struct {
+	name        string
+	description string
+	script      string // "" if skipped
+	skipped     string // why it was skipped
+}
+
+// ImportCmd registers the recipes of a justfile or the tasks of a Taskfile.
+func ImportCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-import")
+	format := fs.String("format", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 || *format != FORMAT_JUSTFILE && *format != FORMAT_TASKFILE {
+		return fmt.Errorf(tr(USAGE_IMPORT))
+	}
+	fp := fs.Arg(0)
+	raw, err := os.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	var imported []importedCmd
+	if *format == FORMAT_JUSTFILE {
+		imported = parseJustfile(string(raw))
+	} else if imported, err = parseTaskfile(fp, string(raw)); err != nil {
+		return err
+	}
+
+	var skipped []string
+	n := 0
+	for _, ic := range imported {
+		if ic.skipped == "" {
+			if err := checkName(ic.name); err != nil {
+				ic.skipped = strings.TrimSpace(err.Error())
+			} else if err := Find(indexFp, ic.name, &jsonCmd{}); err == nil {
+				ic.skipped = tr("registered already")
+			} else if !errors.Is(err, CmdNotFoundErr) {
+				return err
+			}
+		}
+		if ic.skipped != "" {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", ic.name, ic.skipped))
+			continue
+		}
+		script, err := createScript(scriptDp, ic.name, ic.script)
+		if err != nil {
+			return err
+		}
+		cmd := jsonCmd{Name: ic.name, Script: script, Meta: meta{MaxNumArgs: -1, Description: ic.description}}
+		if err := insertIntoIndex(indexFp, &cmd); err != nil {
+			os.Remove(script)
+			return err
+		}
+		n++
+	}
+	fmt.Printf(tr("Imported %d command(s).\n"), n)
+	if len(skipped) > 0 {
+		fmt.Println(tr("Skipped:"))
+		for _, s := range skipped {
+			fmt.Println("  " + s)
+		}
+	}
+	return nil
+}
+
+// importScript builds the script of the lines, which must not contain template
+// expressions after cliArgs was replaced by "$@".
+func importScript(lines []string, dir string, env []string, cliArgs *regexp.Regexp) (string, string) {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n")
+	if dir != "" {
+		fmt.Fprintf(&b, "cd %s\n", shQuote(dir))
+	}
+	for _, kv := range env {
+		fmt.Fprintf(&b, "export %s\n", kv)
+	}
+	for _, line := range lines {
+		if cliArgs != nil {
+			line = cliArgs.ReplaceAllString(line, `"$$@"`)
+		}
+		if strings.Contains(line, "{{") {
+			return "", tr("uses template expressions")
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String(), ""
+}
+
+var (
+	justRecipe = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)([^:]*):([^=].*)?$`)
+	justAssign = regexp.MustCompile(`^(export\s+)?[A-Za-z_][A-Za-z0-9_-]*\s*:=`)
+)
+
+// parseJustfile reads the recipes of a justfile. Only the common subset is
+// understood: recipes without dependencies whose only parameter is variadic.
+func parseJustfile(text string) []importedCmd {
+	var imported []importedCmd
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	comment := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			comment = ""
+			continue
+		case strings.HasPrefix(line, "#"):
+			comment = strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+			continue
+		case strings.HasPrefix(line, "["), strings.HasPrefix(line, "set "), strings.HasPrefix(line, "import "),
+			strings.HasPrefix(line, "mod "), strings.HasPrefix(line, "alias "), justAssign.MatchString(line):
+			continue
+		}
+		m := justRecipe.FindStringSubmatch(line)
+		if m == nil || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		ic := importedCmd{name: m[1], description: comment}
+		comment = ""
+
+		var body []string
+		for i+1 < len(lines) && (strings.HasPrefix(lines[i+1], " ") || strings.HasPrefix(lines[i+1], "\t") || strings.TrimSpace(lines[i+1]) == "") {
+			i++
+			body = append(body, lines[i])
+		}
+		for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+			body = body[:len(body)-1]
+		}
+		body = dedent(body)
+
+		var variadic *regexp.Regexp
+		for _, param := range strings.Fields(m[2]) {
+			if !strings.HasPrefix(param, "*") && !strings.HasPrefix(param, "+") || strings.Contains(param, "=") {
+				ic.skipped = tr("has parameters")
+				break
+			}
+			variadic = regexp.MustCompile(`"?\{\{\s*` + regexp.QuoteMeta(strings.TrimLeft(param, "*+$")) + `\s*\}\}"?`)
+		}
+		if strings.TrimSpace(m[3]) != "" && ic.skipped == "" {
+			ic.skipped = tr("has dependencies")
+		}
+		if ic.skipped == "" {
+			if len(body) > 0 && strings.HasPrefix(body[0], "#!") {
+				// a shebang recipe is a script of its own
+				ic.script = strings.Join(body, "\n") + "\n"
+				if strings.Contains(ic.script, "{{") {
+					ic.skipped = tr("uses template expressions")
+				}
+			} else {
+				for j := range body {
+					body[j] = strings.TrimLeft(body[j], "@-")
+				}
+				ic.script, ic.skipped = importScript(body, "", nil, variadic)
+			}
+		}
+		imported = append(imported, ic)
+	}
+	return imported
+}
+
+// dedent removes the indentation the lines share.
+func dedent(lines []string) []string {
+	prefix := ""
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if i == 0 || prefix == "" || !strings.HasPrefix(indent, prefix) {
+			if prefix == "" || strings.HasPrefix(prefix, indent) {
+				prefix = indent
+			}
+		}
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, prefix)
+	}
+	return out
+}
+
+// taskCliArgs matches the arguments of task, f. e. {{.CLI_ARGS}}.
+var taskCliArgs = regexp.MustCompile(`\{\{\s*\.CLI_ARGS\s*\}\}`)
+
+// parseTaskfile reads the tasks of a Taskfile. Tasks with dependencies,
+// variables or calls of other tasks are skipped.
+func parseTaskfile(fp, text string) ([]importedCmd, error) {
+	doc, err := parseYaml(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fp, err)
+	}
+	root, _ := doc.(map[string]interface{})
+	tasks, _ := root["tasks"].(map[string]interface{})
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var imported []importedCmd
+	for _, name := range names {
+		ic := importedCmd{name: name}
+		task, ok := tasks[name].(map[string]interface{})
+		if !ok {
+			// a task may be a single command or a list of commands
+			task = map[string]interface{}{"cmds": tasks[name]}
+		}
+		ic.description, _ = task["desc"].(string)
+		if ic.description == "" {
+			ic.description, _ = task["summary"].(string)
+		}
+		for _, key := range []string{"deps", "vars", "requires", "preconditions"} {
+			if _, ok := task[key]; ok && ic.skipped == "" {
+				ic.skipped = fmt.Sprintf(tr("has %s"), key)
+			}
+		}
+		var lines []string
+		cmds := task["cmds"]
+		if cmd, ok := task["cmd"]; ok {
+			cmds = []interface{}{cmd}
+		}
+		switch c := cmds.(type) {
+		case string:
+			lines = append(lines, c)
+		case []interface{}:
+			for _, item := range c {
+				switch item := item.(type) {
+				case string:
+					lines = append(lines, item)
+				case map[string]interface{}:
+					if cmd, ok := item["cmd"].(string); ok {
+						lines = append(lines, cmd)
+					} else if ic.skipped == "" {
+						ic.skipped = tr("calls other tasks")
+					}
+				}
+			}
+		}
+		if len(lines) == 0 && ic.skipped == "" {
+			ic.skipped = tr("has no commands")
+		}
+		dir, _ := task["dir"].(string)
+		if dir != "" && !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(absPath(fp)), dir)
+		}
+		var env []string
+		if envMap, ok := task["env"].(map[string]interface{}); ok {
+			keys := make([]string, 0, len(envMap))
+			for key := range envMap {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				val, ok := envMap[key].(string)
+				if !ok && ic.skipped == "" {
+					ic.skipped = tr("uses template expressions")
+				}
+				env = append(env, key+"="+shQuote(val))
+			}
+		}
+		if ic.skipped == "" {
+			ic.script, ic.skipped = importScript(lines, dir, env, taskCliArgs)
+		}
+		imported = append(imported, ic)
+	}
+	return imported, nil
+}
+
+// absPath returns fp as absolute path, else as is.
+func absPath(fp string) string {
+	if abs, err := filepath.Abs(fp); err == nil {
+		return abs
+	}
+	return fp
+}
+
+/******************************************************************************/
+
+// yamlLine is a line of a YAML document without comment.
+type yamlLine struct {
+	no     int
+	indent int
+	text   string
+}
+
+// parseYaml reads the subset of YAML Taskfiles use: block mappings, block
+// sequences, plain and quoted scalars, literal and folded block scalars, and
+// empty flow collections. Values are strings, []interface{} and
+// map[string]interface{}.
+func parseYaml(text string) (interface{}, error) {
+	var lines []yamlLine
+	sc := bufio.NewScanner(strings.NewReader(text))
+	no := 0
+	for sc.Scan() {
+		no++
+		raw := strings.TrimRight(sc.Text(), " \t\r")
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			lines = append(lines, yamlLine{no, -1, raw}) // kept for block scalars
+			continue
+		}
+		lines = append(lines, yamlLine{no, len(raw) - len(trimmed), raw})
+	}
+	p := &yamlParser{lines: lines}
+	p.skipBlank()
+	if p.i >= len(p.lines) {
+		return map[string]interface{}{}, nil
+	}
+	return p.block(p.lines[p.i].indent)
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.i < len(p.lines) && p.lines[p.i].indent < 0 {
+		p.i++
+	}
+}
+
+// block parses the mapping or sequence starting at the current line.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if strings.HasPrefix(p.lines[p.i].text[indent:], "- ") || p.lines[p.i].text[indent:] == "-" {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) errorf(format string, a ...interface{}) error {
+	no := 0
+	if p.i < len(p.lines) {
+		no = p.lines[p.i].no
+	}
+	return fmt.Errorf("line %d: %s", no, fmt.Sprintf(format, a...))
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	var seq []interface{}
+	for p.skipBlank(); p.i < len(p.lines) && p.lines[p.i].indent == indent; p.skipBlank() {
+		text := p.lines[p.i].text[indent:]
+		if !strings.HasPrefix(text, "-") {
+			break
+		}
+		item := strings.TrimLeft(strings.TrimPrefix(text, "-"), " ")
+		itemIndent := len(p.lines[p.i].text) - len(item)
+		if item == "" {
+			p.i++
+			p.skipBlank()
+			if p.i >= len(p.lines) || p.lines[p.i].indent <= indent {
+				seq = append(seq, "")
+				continue
+			}
+			v, err := p.block(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		if _, _, ok := splitYamlKey(item); ok {
+			// a mapping starting on the line of the dash
+			v, err := p.mapping(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		v, err := p.scalar(item, indent)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	first := true
+	for p.skipBlank(); p.i < len(p.lines); p.skipBlank() {
+		line := p.lines[p.i]
+		// the first key of a mapping in a sequence follows the dash
+		if !first && line.indent != indent || first && line.indent > indent {
+			if line.indent > indent {
+				return nil, p.errorf("unexpected indentation")
+			}
+			break
+		}
+		text := line.text[indent:]
+		if first && line.indent < indent {
+			text = line.text[len(line.text)-len(strings.TrimLeft(line.text[line.indent:], "- ")):]
+		}
+		first = false
+		key, val, ok := splitYamlKey(text)
+		if !ok {
+			return nil, p.errorf("expected key: value")
+		}
+		if val != "" {
+			v, err := p.scalar(val, indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		p.i++
+		p.skipBlank()
+		switch {
+		case p.i < len(p.lines) && p.lines[p.i].indent > indent:
+			v, err := p.block(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		case p.i < len(p.lines) && p.lines[p.i].indent == indent && strings.HasPrefix(p.lines[p.i].text[indent:], "-"):
+			v, err := p.sequence(indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		default:
+			m[key] = ""
+		}
+	}
+	return m, nil
+}
+
+// scalar parses the value val of the current line, which is consumed. Block
+// scalars also consume the lines indented deeper than indent.
+func (p *yamlParser) scalar(val string, indent int) (interface{}, error) {
+	if !strings.HasPrefix(val, "|") && !strings.HasPrefix(val, ">") {
+		v, err := p.inline(val)
+		p.i++
+		return v, err
+	}
+	var block []string
+	for p.i++; p.i < len(p.lines) && (p.lines[p.i].indent < 0 || p.lines[p.i].indent > indent); p.i++ {
+		block = append(block, p.lines[p.i].text)
+	}
+	for len(block) > 0 && strings.TrimSpace(block[len(block)-1]) == "" {
+		block = block[:len(block)-1]
+	}
+	block = dedent(block)
+	if val[0] == '>' {
+		return strings.Join(block, " "), nil
+	}
+	return strings.Join(block, "\n"), nil
+}
+
+// inline parses a value written on one line: a quoted or plain scalar or a
+// flow collection.
+func (p *yamlParser) inline(val string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(val, "[") && strings.HasSuffix(val, "]"):
+		seq := []interface{}{}
+		for _, item := range splitFlow(val[1 : len(val)-1]) {
+			v, err := p.inline(item)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	case strings.HasPrefix(val, "{") && strings.HasSuffix(val, "}"):
+		m := map[string]interface{}{}
+		for _, item := range splitFlow(val[1 : len(val)-1]) {
+			key, v, ok := splitYamlKey(item)
+			if !ok {
+				return nil, p.errorf("expected key: value")
+			}
+			var err error
+			if m[key], err = p.inline(v); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case strings.HasPrefix(val, "[") || strings.HasPrefix(val, "{"):
+		return nil, p.errorf("flow collections must end on their line")
+	case strings.HasPrefix(val, "'"):
+		if !strings.HasSuffix(val, "'") || len(val) < 2 {
+			return nil, p.errorf("unterminated string")
+		}
+		return strings.ReplaceAll(val[1:len(val)-1], "''", "'"), nil
+	case strings.HasPrefix(val, `"`):
+		s, err := strconv.Unquote(val)
+		if err != nil {
+			return nil, p.errorf("invalid string %s", val)
+		}
+		return s, nil
+	}
+	if i := strings.Index(val, " #"); i >= 0 {
+		val = strings.TrimSpace(val[:i])
+	}
+	return val, nil
+}
+
+// splitFlow splits the items of a flow collection at the commas outside of
+// quotes and nested collections.
+func splitFlow(s string) []string {
+	var items []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// splitYamlKey splits "key: value" outside of quotes.
+func splitYamlKey(text string) (key, val string, ok bool) {
+	if strings.HasPrefix(text, "'") || strings.HasPrefix(text, `"`) {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key, rest := text[1:end+1], text[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		return strings.ReplaceAll(key, "''", "'"), strings.TrimSpace(rest[1:]), true
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if strings.HasSuffix(text, ":") {
+			return text[:len(text)-1], "", true
+		}
+		return "", "", false
+	}
+	return text[:i], strings.TrimSpace(text[i+2:]), true
+}
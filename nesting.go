@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const DEFAULT_MAX_DEPTH = 10
+
+// callStack returns the names of the commands which led to this execution of
+// name, outermost first, and name itself. Scripts calling run again inherit
+// RUN_CALL_STACK from their run. A command calling itself, directly or through
+// others, or nesting deeper than maxDepth is refused, as it would fork
+// endlessly.
+func callStack(scriptDp, name string) ([]string, error) {
+	var stack []string
+	if s := os.Getenv("RUN_CALL_STACK"); s != "" {
+		stack = strings.Split(s, "\n")
+	}
+	stack = append(stack, name)
+	for _, caller := range stack[:len(stack)-1] {
+		if caller == name {
+			return nil, fmt.Errorf(tr("%s calls itself: %s\n"), name, strings.Join(stack, " → "))
+		}
+	}
+
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return nil, err
+	}
+	maxDepth := conf.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DEFAULT_MAX_DEPTH
+	}
+	if len(stack) > maxDepth {
+		return nil, fmt.Errorf(tr("Commands are nested deeper than %d: %s\nRaise the limit with:\n\trun -config maxDepth %d\n"), maxDepth, strings.Join(stack, " → "), 2*maxDepth)
+	}
+	return stack, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MAX_DOWNLOAD limits the downloads of download, which are scripts and lists
+// of them, no release tarballs.
+const MAX_DOWNLOAD = 16 << 20
+
+// DOWNLOAD_DIR in the cache keeps the last download of every url, for
+// --offline.
+const DOWNLOAD_DIR = "downloads"
+
+// offline is set by --offline or $RUN_OFFLINE=1. Nothing is downloaded then,
+// download returns the copy of the cache and anything else fails at once.
+var offline bool
+
+// httpClient uses the default transport, which honours HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY.
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// download fetches an HTTPS url and caches it, offline it returns the cached
+// copy. Plain HTTP is refused, what run downloads would be open to anyone on
+// the way.
+func download(scriptDp, rawUrl string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(rawUrl))
+	fp := filepath.Join(baseDir(scriptDp), CACHE_DIR, DOWNLOAD_DIR, hex.EncodeToString(sum[:])[:24])
+	if offline {
+		raw, err := os.ReadFile(fp)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf(tr("%s was never downloaded, it is not available offline.\n"), rawUrl)
+		}
+		return raw, err
+	}
+	raw, err := downloadMax(rawUrl, MAX_DOWNLOAD)
+	if err != nil {
+		if fi, statErr := os.Stat(fp); statErr == nil {
+			return nil, fmt.Errorf(tr("%sA download of it from %s is cached, run --offline uses it.\n"), err, fi.ModTime().Format("2006-01-02 15:04"))
+		}
+		return nil, err
+	}
+	// the cache is a convenience, failing to fill it fails nothing
+	if err := os.MkdirAll(filepath.Dir(fp), 0750); err == nil {
+		os.WriteFile(fp, raw, 0640)
+	}
+	return raw, nil
+}
+
+// downloadMax downloads at most max bytes of an HTTPS url, uncached.
+func downloadMax(rawUrl string, max int64) ([]byte, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf(tr("%s is no HTTPS URL.\n"), rawUrl)
+	}
+	if offline {
+		return nil, fmt.Errorf(tr("Cannot download %s, run is offline.\n"), rawUrl)
+	}
+	resp, err := httpClient.Get(u.String())
+	if err != nil {
+		return nil, networkError(u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(tr("Download of %s failed: %s\n"), rawUrl, resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, networkError(u, err)
+	}
+	if int64(len(raw)) > max {
+		return nil, fmt.Errorf(tr("%s is larger than %d MiB.\n"), rawUrl, max>>20)
+	}
+	return raw, nil
+}
+
+// networkError explains a failed connection to u, naming the proxy if one is
+// used.
+func networkError(u *url.URL, err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err // the URL is part of the message anyway
+	}
+	proxy, _ := http.ProxyFromEnvironment(&http.Request{URL: u})
+	if proxy != nil {
+		return fmt.Errorf(tr("Cannot download %s through the proxy %s: %s\nCheck HTTPS_PROXY and NO_PROXY, or run --offline.\n"), u, proxy.Redacted(), err)
+	}
+	return fmt.Errorf(tr("Cannot download %s: %s\nCheck the network connection, set HTTPS_PROXY if it needs a proxy, or run --offline.\n"), u, err)
+}
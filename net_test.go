@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadOffline(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "echo hi\n")
+	}))
+	defer srv.Close()
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+	scriptDp := filepath.Join(t.TempDir(), BASE_DIR, SCRIPT_DIR, "unix")
+
+	if raw, err := download(scriptDp, srv.URL+"/hi.sh"); err != nil || string(raw) != "echo hi\n" {
+		t.Fatalf("download() = %q, %v", raw, err)
+	}
+	offline = true
+	defer func() { offline = false }()
+	// offline, the last download comes from the cache
+	if raw, err := download(scriptDp, srv.URL+"/hi.sh"); err != nil || string(raw) != "echo hi\n" {
+		t.Errorf("offline download() = %q, %v", raw, err)
+	}
+	if _, err := download(scriptDp, srv.URL+"/other.sh"); err == nil {
+		t.Error("offline download() of an uncached url succeeded")
+	}
+	if _, err := downloadMax(srv.URL+"/hi.sh", MAX_DOWNLOAD); err == nil {
+		t.Error("offline downloadMax() succeeded")
+	}
+}
+
+func TestDownloadRefusesHTTP(t *testing.T) {
+	if _, err := downloadMax("http://example.com/hi.sh", MAX_DOWNLOAD); err == nil {
+		t.Error("downloadMax() of plain HTTP succeeded")
+	}
+}
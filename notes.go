@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const USAGE_NOTE = "Usage:\n\trun -note <cmd> [<text>]\n\trun -note <cmd> --remove <n>\n\trun -note <cmd> --clear\n\nAdds a note to <cmd>, f. e. what to do before running it. Without <text>, lists\nthe notes of <cmd>, numbered for --remove. -doc shows them, and with showNotes\nof the config, they are printed before the command runs.\n"
+
+// NoteCmd keeps the operational knowledge about a command with it. Listing
+// changes nothing, thus it audits itself like -lint-index.
+func NoteCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf(tr(USAGE_NOTE))
+	}
+	name := args[0]
+	fs := newFlagSet("-note")
+	remove := fs.Int("remove", 0, "")
+	clear := fs.Bool("clear", false, "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf(tr(USAGE_NOTE))
+	}
+	text := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	changes := 0
+	for _, change := range []bool{text != "", *remove != 0, *clear} {
+		if change {
+			changes++
+		}
+	}
+	if changes > 1 {
+		return fmt.Errorf(tr(USAGE_NOTE))
+	}
+
+	if changes == 0 {
+		var cmd jsonCmd
+		if err := Find(indexFp, name, &cmd); err != nil {
+			return err
+		}
+		if len(cmd.Meta.Notes) == 0 {
+			fmt.Printf(tr("%s has no notes.\n"), name)
+		}
+		for i, note := range cmd.Meta.Notes {
+			fmt.Printf("%2d  %s\n", i+1, note)
+		}
+		return nil
+	}
+	if err := checkWritable(scriptDp); err != nil {
+		return err
+	}
+	err := modifyOne(indexFp, name, func(cmd *jsonCmd) error {
+		notes := cmd.Meta.Notes
+		switch {
+		case *clear:
+			notes = nil
+		case *remove != 0:
+			if *remove < 1 || *remove > len(notes) {
+				return fmt.Errorf(tr("%s has no note %d.\n"), name, *remove)
+			}
+			notes = append(notes[:*remove-1:*remove-1], notes[*remove:]...)
+		default:
+			notes = append(notes, text)
+		}
+		if len(notes) == 0 {
+			notes = nil
+		}
+		cmd.Meta.Notes = notes
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return audit(scriptDp, "-note", args)
+}
+
+// showNotes prints the notes of cmd before it runs, dimmed on a terminal, so
+// that they stand apart from the output of the script. Nested calls of run
+// print nothing, the notes are for the one who started it.
+func showNotes(cmd *jsonCmd, plain bool) {
+	if os.Getenv("RUN_INVOCATION_ID") != "" {
+		return
+	}
+	dim := !plain && isTerminalFile(os.Stderr)
+	for _, note := range cmd.Meta.Notes {
+		line := fmt.Sprintf(tr("note: %s"), note)
+		if dim {
+			line = "\x1b[2m" + line + "\x1b[0m"
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
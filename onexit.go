@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ON_EXIT_BELL as onSuccess or onFailure rings the bell of the terminal
+// instead of running a command.
+const ON_EXIT_BELL = "bell"
+
+// runOnExit runs onSuccess or onFailure of the config after the execution of
+// record, unless it was shorter than onExitAfter. Like the terminal
+// notifications, nested calls of run are skipped, the outermost one tells.
+// The command gets the variables of the post-run hook and
+// RUN_CMD_DURATION_MS.
+func runOnExit(scriptDp string, record *historyEntry, ctxEnv []string) error {
+	if os.Getenv("RUN_INVOCATION_ID") != "" {
+		return nil
+	}
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	line := conf.OnSuccess
+	if !record.Succeeded() {
+		line = conf.OnFailure
+	}
+	if line == "" {
+		return nil
+	}
+	if conf.OnExitAfter != "" {
+		after, err := parseDuration(conf.OnExitAfter)
+		if err != nil {
+			return err
+		}
+		if time.Duration(record.DurationMs)*time.Millisecond < after {
+			return nil
+		}
+	}
+	if line == ON_EXIT_BELL {
+		if isTerminalFile(os.Stderr) {
+			fmt.Fprint(os.Stderr, "\a")
+		}
+		return nil
+	}
+
+	exe := shellCmd(line)
+	exe.Stdout = os.Stderr // do not mix its output into the script's
+	exe.Stderr = os.Stderr
+	exe.Env = append(append(os.Environ(), ctxEnv...),
+		"RUN_CMD_NAME="+record.Name,
+		"RUN_CMD_SCRIPT="+record.Script,
+		"RUN_CMD_EXIT_CODE="+strconv.Itoa(record.ExitCode),
+		"RUN_CMD_DURATION_MS="+strconv.FormatInt(record.DurationMs, 10),
+	)
+	if err := exe.Run(); err != nil {
+		return fmt.Errorf("%q: %w", line, err)
+	}
+	return nil
+}
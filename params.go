@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const USAGE_ARGS = "Usage:\n\trun -args <cmd> [--desc <argName>=<text> ...] [<argName>[=<ENV_VAR>][:<type>] ...]\n\nArguments with an environment variable are passed through it instead of positionally.\n<type> is int, bool, path or the valid values separated by commas, f. e.\nregion:eu,us. Types and descriptions guide run <cmd> -i.\nWithout argument names, the spec of <cmd> is removed."
+
+// argTypes are the types of argSpec besides a list of choices.
+var argTypes = []string{"string", "int", "bool", "path"}
+
+// ArgsCmd replaces the argument spec of a command, i. e.
+// $ run -args deploy --desc region="where to deploy" cluster region:eu,us token=DEPLOY_TOKEN
+// The spec is used to map parameter files given with --params and to ask for
+// the arguments with -i.
+func ArgsCmd(indexFp string, args []string) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf(tr(USAGE_ARGS))
+	}
+	name := args[0]
+	fs := newFlagSet("-args")
+	var descs stringList
+	fs.Var(&descs, "desc", "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf(tr(USAGE_ARGS))
+	}
+
+	spec := make([]argSpec, 0, fs.NArg())
+	seen := make(map[string]int, fs.NArg())
+	for _, arg := range fs.Args() {
+		a := argSpec{Name: arg}
+		if i := strings.IndexByte(arg, ':'); i >= 0 {
+			a.Name = arg[:i]
+			switch typ := arg[i+1:]; {
+			case contains(argTypes, typ):
+				a.Type = typ
+			case typ == "":
+				return fmt.Errorf(tr("The type of %q is empty.\n%s"), a.Name, tr(USAGE_ARGS))
+			default:
+				a.Choices = strings.Split(typ, ",")
+			}
+		}
+		if i := strings.IndexByte(a.Name, '='); i >= 0 {
+			a.Name, a.Env = a.Name[:i], a.Name[i+1:]
+		}
+		if a.Name == "" || strings.HasPrefix(a.Name, "-") {
+			return fmt.Errorf(tr("Argument names must not be empty or start with -.\n%s"), tr(USAGE_ARGS))
+		}
+		if _, dup := seen[a.Name]; dup {
+			return fmt.Errorf("Argument %q is named twice.\n", a.Name)
+		}
+		seen[a.Name] = len(spec)
+		spec = append(spec, a)
+	}
+	for _, desc := range descs {
+		i := strings.IndexByte(desc, '=')
+		if i < 0 {
+			return fmt.Errorf(tr(USAGE_ARGS))
+		}
+		at, ok := seen[desc[:i]]
+		if !ok {
+			return fmt.Errorf(tr("--desc %s: there is no argument %q.\n"), desc, desc[:i])
+		}
+		spec[at].Description = desc[i+1:]
+	}
+
+	return modifyOne(indexFp, name, func(cmd *jsonCmd) error {
+		cmd.Meta.Args = spec
+		return nil
+	})
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArg returns an error if val does not fit the type or choices of spec.
+// A bool is normalized to true or false.
+func checkArg(spec *argSpec, val string) (string, error) {
+	if len(spec.Choices) > 0 && !contains(spec.Choices, val) {
+		return "", fmt.Errorf(tr("%s must be one of %s, not %q.\n"), spec.Name, strings.Join(spec.Choices, ", "), val)
+	}
+	switch spec.Type {
+	case "int":
+		if _, err := strconv.Atoi(val); err != nil {
+			return "", fmt.Errorf(tr("%s must be a whole number, not %q.\n"), spec.Name, val)
+		}
+	case "bool":
+		switch strings.ToLower(val) {
+		case "y", "yes":
+			val = "true"
+		case "n", "no":
+			val = "false"
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return "", fmt.Errorf(tr("%s must be true or false, not %q.\n"), spec.Name, val)
+		}
+		val = strconv.FormatBool(b)
+	case "path":
+		if _, err := os.Stat(val); err != nil {
+			return "", fmt.Errorf(tr("%s must be an existing path: %s\n"), spec.Name, err)
+		}
+	}
+	return val, nil
+}
+
+/******************************************************************************/
+
+// loadParams reads a JSON or YAML parameter file and maps its keys onto the
+// argument spec of the command name. It returns the positional arguments in
+// spec order and the environment variables as KEY=value pairs.
+func loadParams(scriptDp, indexFp, name, paramsFp string) (args []string, env []string, err error) {
+	cmd := jsonCmd{}
+	if err := findRegistered(scriptDp, indexFp, name, &cmd); err != nil {
+		return nil, nil, err
+	}
+	if len(cmd.Meta.Args) == 0 {
+		return nil, nil, fmt.Errorf("%q has no argument spec to map parameters to. Add one with:\n\trun -args %s <argName> ...\n", name, name)
+	}
+
+	params, err := readParamsFile(paramsFp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", paramsFp, err)
+	}
+
+	missing := ""
+	for i := range cmd.Meta.Args {
+		spec := &cmd.Meta.Args[i]
+		val, ok := params[spec.Name]
+		delete(params, spec.Name)
+		if ok {
+			if val, err = checkArg(spec, val); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", paramsFp, err)
+			}
+		}
+		switch {
+		case !ok && spec.Env == "" && missing == "":
+			missing = spec.Name
+		case !ok:
+		case spec.Env != "":
+			env = append(env, spec.Env+"="+val)
+		case missing != "":
+			// positional arguments cannot have gaps
+			return nil, nil, fmt.Errorf("%s: %q is set, but the preceding argument %q is missing.\n", paramsFp, spec.Name, missing)
+		default:
+			args = append(args, val)
+		}
+	}
+	for key := range params {
+		return nil, nil, fmt.Errorf("%s: %q is not an argument of %q.\n", paramsFp, key, name)
+	}
+	return args, env, nil
+}
+
+// readParamsFile parses a flat object of parameters. Files ending in .yaml or
+// .yml are parsed as YAML, everything else as JSON.
+func readParamsFile(fp string) (map[string]string, error) {
+	raw, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(fp)) {
+	case ".yaml", ".yml":
+		return parseFlatYaml(raw)
+	}
+
+	var obj map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber() // keep numbers as written
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	params := make(map[string]string, len(obj))
+	for key, val := range obj {
+		switch v := val.(type) {
+		case string:
+			params[key] = v
+		case json.Number, bool:
+			params[key] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("%q must be a string, number or boolean.\n", key)
+		}
+	}
+	return params, nil
+}
+
+// parseFlatYaml supports the subset of YAML needed for parameter files:
+// "key: value" lines, comments, and single or double quoted values.
+func parseFlatYaml(raw []byte) (map[string]string, error) {
+	params := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested values are not supported", n)
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		val := strings.TrimSpace(line[i+1:])
+		switch {
+		case len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"':
+			unq, err := jsonUnquote(val)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			val = unq
+		case len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'':
+			val = strings.ReplaceAll(val[1:len(val)-1], "''", "'")
+		default:
+			if j := strings.Index(val, " #"); j >= 0 {
+				val = strings.TrimSpace(val[:j])
+			}
+		}
+		if _, dup := params[key]; dup {
+			return nil, fmt.Errorf("line %d: %q is set twice", n, key)
+		}
+		params[key] = val
+	}
+	return params, sc.Err()
+}
+
+// jsonUnquote handles YAML double quoted strings, whose escapes are a superset
+// of JSON's. The common ones are identical.
+func jsonUnquote(s string) (string, error) {
+	var v string
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// ansiEscape matches the escape sequences of terminals: CSI sequences like
+// colors and cursor movement, OSC sequences like titles and links, and the
+// remaining two-character ones.
+var ansiEscape = regexp.MustCompile("\x1b(?:\\[[0-?]*[ -/]*[@-~]|\\][^\x07\x1b]*(?:\x07|\x1b\\\\)|[@-Z\\\\-_])")
+
+// plainWriter writes the output of a script for log shippers like journald or
+// CloudWatch: without escape sequences, and only whole lines, so that lines
+// of stdout and stderr never mix. A lone carriage return of a progress bar
+// ends a line, too. Lines longer than max are broken, so that output without
+// line breaks is not held in memory.
+type plainWriter struct {
+	mu  *sync.Mutex // shared by stdout and stderr
+	w   io.Writer
+	buf []byte
+	max int
+}
+
+func newPlainWriters(stdout, stderr io.Writer, max int64) (*plainWriter, *plainWriter) {
+	mu := &sync.Mutex{}
+	return &plainWriter{mu: mu, w: stdout, max: int(max)}, &plainWriter{mu: mu, w: stderr, max: int(max)}
+}
+
+func (p *plainWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		end := i + 1
+		if p.buf[i] == '\r' {
+			if end == len(p.buf) {
+				break // \r\n may be split across writes
+			}
+			if p.buf[end] == '\n' {
+				end++
+			}
+		}
+		if err := p.writeLine(p.buf[:i]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[end:]
+	}
+	if len(p.buf) > p.max {
+		if err := p.writeLine(p.buf); err != nil {
+			return 0, err
+		}
+		p.buf = nil
+	}
+	return len(b), nil
+}
+
+// Flush writes an unterminated last line.
+func (p *plainWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := bytes.TrimSuffix(p.buf, []byte("\r"))
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *plainWriter) writeLine(line []byte) error {
+	line = ansiEscape.ReplaceAll(line, nil)
+	_, err := p.w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PORTABLE makes a build portable, as --portable does:
+//
+//	go build -ldflags "-X main.PORTABLE=true" -o run .
+var PORTABLE string
+
+// portableRoot is the folder of the run executable in portable mode, else "".
+// The registry lives in it instead of the home folder, f. e. on a USB stick or
+// in the tools/ folder of a repository. Because its drive letter or mount
+// point may change, paths below it are stored relative to it in the index.
+var portableRoot string
+
+// executableDir returns the folder of the run executable.
+func executableDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	return filepath.Dir(exe), nil
+}
+
+// pathFields returns the fields of cmd holding paths.
+func (c *jsonCmd) pathFields() []*string {
+	return []*string{&c.Script, &c.Meta.Workdir, &c.Meta.StdinFile, &c.Meta.Validate}
+}
+
+// absPaths resolves the relative paths of a command read from the index.
+func (c *jsonCmd) absPaths() {
+	if portableRoot == "" {
+		return
+	}
+	abs := func(fp string) string {
+		if fp == "" || filepath.IsAbs(fp) {
+			return fp
+		}
+		return filepath.Join(portableRoot, filepath.FromSlash(fp))
+	}
+	for _, fp := range c.pathFields() {
+		*fp = abs(*fp)
+	}
+	for goos, script := range c.Meta.ScriptOverrides {
+		c.Meta.ScriptOverrides[goos] = abs(script)
+	}
+	for i, script := range c.Meta.Candidates {
+		c.Meta.Candidates[i] = abs(script)
+	}
+}
+
+// relPaths returns a copy of the command with the paths below portableRoot
+// relative to it, with forward slashes to work on every platform.
+func (c *jsonCmd) relPaths() *jsonCmd {
+	if portableRoot == "" {
+		return c
+	}
+	rel := func(fp string) string {
+		if !isInside(portableRoot, fp) {
+			return fp
+		}
+		r, err := filepath.Rel(portableRoot, fp)
+		if err != nil || strings.HasPrefix(r, "..") {
+			return fp
+		}
+		return filepath.ToSlash(r)
+	}
+	cp := *c
+	for _, fp := range cp.pathFields() {
+		*fp = rel(*fp)
+	}
+	if c.Meta.ScriptOverrides != nil {
+		cp.Meta.ScriptOverrides = make(map[string]string, len(c.Meta.ScriptOverrides))
+		for goos, script := range c.Meta.ScriptOverrides {
+			cp.Meta.ScriptOverrides[goos] = rel(script)
+		}
+	}
+	if c.Meta.Candidates != nil {
+		cp.Meta.Candidates = make([]string, len(c.Meta.Candidates))
+		for i, script := range c.Meta.Candidates {
+			cp.Meta.Candidates[i] = rel(script)
+		}
+	}
+	return &cp
+}
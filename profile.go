@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profile bundles the settings of an environment, f. e. work or home, so that
+// commands need not be duplicated per environment. It is selected with
+// --profile or $RUN_PROFILE.
+type profile struct {
+	// Env is set for every command, KEY=VALUE. It overrides the environment
+	// stored with -mod, but not parameters.
+	Env []string `json:"env,omitempty"`
+	// Registry is the folder of run to use instead of ~/.run, its layout is
+	// the one of ~/.run.
+	Registry string `json:"registry,omitempty"`
+	// AgeIdentity is the age identity decrypting scripts and the index, it
+	// overrides ageIdentity. Secrets encrypted for it are only readable in
+	// this profile.
+	AgeIdentity string `json:"ageIdentity,omitempty"`
+}
+
+// activeProfile is the selected profile, nil without.
+var activeProfile *profile
+
+// activeProfileName is the name of activeProfile. It is passed on to scripts
+// as $RUN_PROFILE, so that nested calls of run use the same profile.
+var activeProfileName string
+
+// selectProfile loads the profile name, $RUN_PROFILE if empty, of the config
+// of runDp and makes it the active one. It returns the folder of run to use.
+func selectProfile(runDp, platformName, name string) (string, error) {
+	if name == "" {
+		name = os.Getenv("RUN_PROFILE")
+	}
+	if name == "" {
+		return runDp, nil
+	}
+	conf, err := loadConfig(filepath.Join(runDp, SCRIPT_DIR, platformName))
+	if err != nil {
+		return "", err
+	}
+	p, ok := conf.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(conf.Profiles))
+		for n := range conf.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return "", fmt.Errorf(tr("There is no profile %q, no profiles are defined in %s.\n"), name, configFp(filepath.Join(runDp, SCRIPT_DIR, platformName)))
+		}
+		return "", fmt.Errorf(tr("There is no profile %q. Defined are: %s\n"), name, strings.Join(names, ", "))
+	}
+	if err := validateProfiles(map[string]profile{name: p}); err != nil {
+		return "", err
+	}
+	activeProfile, activeProfileName = &p, name
+	if p.Registry != "" {
+		return p.Registry, nil
+	}
+	return runDp, nil
+}
+
+// profileEnv returns the variables of the active profile, including
+// $RUN_PROFILE.
+func profileEnv() []string {
+	if activeProfile == nil {
+		return nil
+	}
+	return append([]string{"RUN_PROFILE=" + activeProfileName}, activeProfile.Env...)
+}
+
+// validateProfiles checks the profiles of the config.
+func validateProfiles(profiles map[string]profile) error {
+	for name, p := range profiles {
+		if name == "" {
+			return fmt.Errorf(tr("profiles: a profile has no name.\n"))
+		}
+		for _, kv := range p.Env {
+			if strings.IndexByte(kv, '=') <= 0 {
+				return fmt.Errorf(tr("profiles.%s.env: %q is no KEY=VALUE.\n"), name, kv)
+			}
+		}
+		if p.Registry != "" && !filepath.IsAbs(p.Registry) {
+			return fmt.Errorf(tr("profiles.%s.registry must be an absolute path.\n"), name)
+		}
+		if p.AgeIdentity != "" && !filepath.IsAbs(p.AgeIdentity) {
+			return fmt.Errorf(tr("profiles.%s.ageIdentity must be an absolute path.\n"), name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PROGRESS_PREFIX starts the lines a script writes to stderr to report its
+// progress, f. e. "::progress 42 building", if the command has progress set.
+// The percentage is from 0 to 100, the text is optional.
+const PROGRESS_PREFIX = "::progress "
+
+const PROGRESS_BAR_WIDTH = 20
+
+// progressBar renders the last progress a script reported as the last line of
+// the terminal. The output of the script is written above it: the bar is
+// cleared before and drawn again once the cursor is at the start of a line,
+// so that a prompt without line break is not overwritten.
+type progressBar struct {
+	mu      sync.Mutex // shared by stdout and stderr
+	show    bool       // stderr is a terminal
+	status  string
+	shown   bool
+	midLine bool
+	stderr  *progressErr
+}
+
+// startProgress passes the output of exe through a progressBar, which is only
+// drawn with show. Without, the progress lines are dropped. The bar must be
+// ended.
+func startProgress(exe *exec.Cmd, show bool) *progressBar {
+	bar := &progressBar{show: show}
+	exe.Stdout = &progressOut{bar: bar, w: exe.Stdout}
+	bar.stderr = &progressErr{progressOut: progressOut{bar: bar, w: exe.Stderr}}
+	exe.Stderr = bar.stderr
+	return bar
+}
+
+// end writes a last line held back without line break and clears the bar
+// after the script exited.
+func (p *progressBar) end() {
+	if e := p.stderr; len(e.line) > 0 {
+		p.write(e.w, e.line)
+		e.line = nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+// hide clears the bar for good, f. e. once the script got a signal.
+func (p *progressBar) hide() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	p.show = false
+}
+
+func (p *progressBar) clear() {
+	if p.shown {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+		p.shown = false
+	}
+}
+
+func (p *progressBar) draw() {
+	if p.show && p.status != "" && !p.midLine {
+		fmt.Fprint(os.Stderr, "\r\x1b[K"+p.status)
+		p.shown = true
+	}
+}
+
+// set reports a percentage with an optional text.
+func (p *progressBar) set(percent int, text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	filled := percent * PROGRESS_BAR_WIDTH / 100
+	p.status = fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat(".", PROGRESS_BAR_WIDTH-filled), percent)
+	if text != "" {
+		p.status += " " + text
+	}
+	p.clear()
+	p.draw()
+}
+
+// write writes output of the script to w above the bar.
+func (p *progressBar) write(w io.Writer, b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(b) == 0 {
+		return 0, nil
+	}
+	p.clear()
+	n, err := w.Write(b)
+	p.midLine = b[len(b)-1] != '\n'
+	p.draw()
+	return n, err
+}
+
+// progressOut is the stdout of the script.
+type progressOut struct {
+	bar *progressBar
+	w   io.Writer
+}
+
+func (o *progressOut) Write(b []byte) (int, error) {
+	return o.bar.write(o.w, b)
+}
+
+// progressErr is the stderr of the script, which holds back the start of a
+// line only while it may be a progress line.
+type progressErr struct {
+	progressOut
+	line    []byte // start of a line which may be a progress line
+	passing bool   // in a line which is none
+}
+
+func (e *progressErr) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if e.passing {
+			if i < 0 {
+				_, err := e.bar.write(e.w, b)
+				return n, err
+			}
+			if _, err := e.bar.write(e.w, b[:i+1]); err != nil {
+				return n, err
+			}
+			e.passing, b = false, b[i+1:]
+			continue
+		}
+
+		chunk := b
+		if i >= 0 {
+			chunk = b[:i]
+		}
+		e.line = append(e.line, chunk...)
+		b = b[len(chunk):]
+		if !strings.HasPrefix(string(e.line), PROGRESS_PREFIX) && !strings.HasPrefix(PROGRESS_PREFIX, string(e.line)) {
+			// no progress line, written as it is
+			b = append(e.line, b...)
+			e.line, e.passing = nil, true
+			continue
+		}
+		if i < 0 {
+			break // wait for the rest of the line
+		}
+		if percent, text, ok := parseProgress(string(e.line)); ok {
+			e.bar.set(percent, text)
+		} else if _, err := e.bar.write(e.w, append(e.line, '\n')); err != nil {
+			return n, err
+		}
+		e.line, b = nil, b[1:]
+	}
+	return n, nil
+}
+
+// parseProgress parses a line like "::progress 42 building".
+func parseProgress(line string) (percent int, text string, ok bool) {
+	fields := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(line, PROGRESS_PREFIX), "\r"), " ", 2)
+	percent, err := strconv.Atoi(fields[0])
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, "", false
+	}
+	if len(fields) == 2 {
+		text = strings.TrimSpace(fields[1])
+	}
+	return percent, text, true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const TRASH_DIR string = "trash"
+
+const DEFAULT_PRUNE_UNUSED_FOR = "90d"
+
+const USAGE_PRUNE = "Usage:\n\trun -prune [--unused-for <duration>] [--yes [--trash]]\n\nLists the commands not run within the duration, 90d or the pruneUnusedFor\nsetting by default. --yes deletes them, --trash also moves their scripts out of\nthe script folder into ~/.run/trash.\n"
+
+// unusedCmd is a command found by -prune.
+type unusedCmd struct {
+	cmd      jsonCmd
+	lastUsed time.Time // the last run, else the modification of the script
+}
+
+// PruneCmd lists, and with --yes deletes, the commands which were not run
+// within a window. Commands which never ran count as used when their script
+// was last modified.
+func PruneCmd(scriptDp, indexFp string, args []string) error {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	window := conf.PruneUnusedFor
+	if window == "" {
+		window = DEFAULT_PRUNE_UNUSED_FOR
+	}
+	fs := newFlagSet("-prune")
+	unusedFor := fs.String("unused-for", window, "")
+	yes := fs.Bool("yes", false, "")
+	trash := fs.Bool("trash", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *trash && !*yes {
+		return fmt.Errorf(tr(USAGE_PRUNE))
+	}
+	d, err := parseDuration(*unusedFor)
+	if err != nil {
+		return err
+	}
+
+	last, err := lastRuns(scriptDp)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-d)
+	var unused []unusedCmd
+	scriptUsers := make(map[string]int) // scripts shared by commands stay
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		scriptUsers[cmd.Script]++
+		lastUsed, ok := last[cmd.Name]
+		if !ok {
+			if fi, err := os.Stat(cmd.Script); err == nil {
+				lastUsed = fi.ModTime()
+			}
+		}
+		if lastUsed.Before(cutoff) {
+			unused = append(unused, unusedCmd{*cmd, lastUsed})
+		}
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	if len(unused) == 0 {
+		fmt.Printf(tr("No command is unused for %s.\n"), *unusedFor)
+		return nil
+	}
+
+	sort.Slice(unused, func(i, j int) bool { return unused[i].lastUsed.Before(unused[j].lastUsed) })
+	names := make([]string, 0, len(unused))
+	for _, u := range unused {
+		names = append(names, u.cmd.Name)
+		if _, ok := last[u.cmd.Name]; ok {
+			fmt.Printf(tr("%-20s last run %s ago\n"), u.cmd.Name, formatDuration(time.Since(u.lastUsed)))
+		} else {
+			fmt.Printf(tr("%-20s never run\n"), u.cmd.Name)
+		}
+	}
+	if !*yes {
+		fmt.Println(tr("Delete them with:\n\trun -prune --yes"))
+		return nil
+	}
+
+	if err := DeleteCmd(indexFp, names); err != nil {
+		return err
+	}
+	if *trash {
+		for _, u := range unused {
+			scriptUsers[u.cmd.Script]--
+			if scriptUsers[u.cmd.Script] > 0 || !isInside(scriptDp, u.cmd.Script) {
+				continue
+			}
+			if err := moveToTrash(scriptDp, u.cmd.Script); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf(tr("Deleted %d command(s).\n"), len(unused))
+	return nil
+}
+
+// moveToTrash moves the script fp into ~/.run/trash/:platform, prefixed with
+// the time to keep scripts of the same name apart.
+func moveToTrash(scriptDp, fp string) error {
+	dir := filepath.Join(baseDir(scriptDp), TRASH_DIR, filepath.Base(scriptDp))
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, time.Now().Format("20060102-150405-")+filepath.Base(fp))
+	return os.Rename(fp, dst)
+}
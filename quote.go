@@ -0,0 +1,37 @@
+package main
+
+import "strings"
+
+// The quoting of prepareExec for batch files on Windows. It lives apart from
+// exec_windows.go, so that its tests run on every system.
+
+// cmdMetaChars escapes every character cmd.exe treats specially with a caret.
+var cmdMetaChars = strings.NewReplacer(
+	"(", "^(", ")", "^)", "[", "^[", "]", "^]", "%", "^%", "!", "^!",
+	"^", "^^", `"`, `^"`, "`", "^`", "<", "^<", ">", "^>", "&", "^&",
+	"|", "^|", ";", "^;", ",", "^,", " ", "^ ", "*", "^*", "?", "^?",
+)
+
+// quoteArg quotes arg according to the CommandLineToArgvW rules: backslashes
+// are only special in front of a double quote.
+func quoteArg(arg string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\':
+			slashes++
+		case '"':
+			b.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		b.WriteByte(c)
+	}
+	b.WriteString(strings.Repeat(`\`, slashes))
+	b.WriteByte('"')
+	return b.String()
+}
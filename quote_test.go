@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// quoteArgTests are arguments which must reach a script unchanged.
+var quoteArgTests = []struct {
+	arg, quoted string
+}{
+	{"", `""`},
+	{"plain", `"plain"`},
+	{"with space", `"with space"`},
+	{"\ttab", "\"\ttab\""},
+	{`say "hi"`, `"say \"hi\""`},
+	{`"`, `"\""`},
+	{`C:\dir\`, `"C:\dir\\"`},
+	{`C:\dir\\`, `"C:\dir\\\\"`},
+	{`a\"b`, `"a\\\"b"`},
+	{`a\\"b`, `"a\\\\\"b"`},
+	{`a\b`, `"a\b"`},
+	{"100% & more | <x> ^y", `"100% & more | <x> ^y"`},
+	{"ümlaut €", `"ümlaut €"`},
+}
+
+func TestQuoteArg(t *testing.T) {
+	for _, tt := range quoteArgTests {
+		if got := quoteArg(tt.arg); got != tt.quoted {
+			t.Errorf("quoteArg(%q) = %q, want %q", tt.arg, got, tt.quoted)
+		}
+		if got := splitCommandLine(quoteArg(tt.arg)); !reflect.DeepEqual(got, []string{tt.arg}) {
+			t.Errorf("quoteArg(%q) is parsed as %q", tt.arg, got)
+		}
+	}
+}
+
+func TestQuoteArgLine(t *testing.T) {
+	var args, line []string
+	for _, tt := range quoteArgTests {
+		args = append(args, tt.arg)
+		line = append(line, quoteArg(tt.arg))
+	}
+	if got := splitCommandLine(strings.Join(line, " ")); !reflect.DeepEqual(got, args) {
+		t.Errorf("command line is parsed as %q, want %q", got, args)
+	}
+}
+
+func TestCmdMetaChars(t *testing.T) {
+	for _, tt := range quoteArgTests {
+		// batch files parse the line twice, each time removing a caret
+		escaped := cmdMetaChars.Replace(cmdMetaChars.Replace(quoteArg(tt.arg)))
+		if got := unescapeCarets(unescapeCarets(escaped)); got != quoteArg(tt.arg) {
+			t.Errorf("%q is unescaped to %q", escaped, got)
+		}
+	}
+	if got := cmdMetaChars.Replace("%PATH%!x!"); got != "^%PATH^%^!x^!" {
+		t.Errorf("variables are escaped as %q", got)
+	}
+}
+
+// splitCommandLine parses a command line like CommandLineToArgvW does for the
+// arguments after the program name.
+func splitCommandLine(line string) []string {
+	var args []string
+	var b strings.Builder
+	inArg, inQuotes := false, false
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+			i++
+		case c == '\\':
+			slashes := 0
+			for ; i < len(line) && line[i] == '\\'; i++ {
+				slashes++
+			}
+			if i < len(line) && line[i] == '"' {
+				b.WriteString(strings.Repeat(`\`, slashes/2))
+				if slashes%2 == 1 {
+					b.WriteByte('"')
+					i++
+				}
+			} else {
+				b.WriteString(strings.Repeat(`\`, slashes))
+			}
+			inArg = true
+		case c == '"':
+			inQuotes = !inQuotes
+			inArg = true
+			i++
+		default:
+			b.WriteByte(c)
+			inArg = true
+			i++
+		}
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args
+}
+
+// unescapeCarets removes the carets of one parse of cmd.exe.
+func unescapeCarets(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '^' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
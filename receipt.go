@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Levels of the summary setting. The default "" is SUMMARY_NEVER.
+const (
+	SUMMARY_NEVER      = "never"
+	SUMMARY_ON_FAILURE = "on-failure"
+	SUMMARY_ALWAYS     = "always"
+)
+
+// receipt summarizes an execution, one JSON object per line of the receipts
+// file.
+type receipt struct {
+	Name         string    `json:"name"`
+	InvocationID string    `json:"invocationId"`
+	Start        time.Time `json:"start"`
+	DurationMs   int64     `json:"durationMs"`
+	ExitCode     int       `json:"exitCode"`
+}
+
+// writeReceipt prints a one-line summary of the execution to stderr and
+// appends it to the receiptsFile, as the summary setting says. Running many
+// commands back-to-back, the results are easy to tell apart.
+func writeReceipt(scriptDp string, record *historyEntry) (err error) {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	switch {
+	case conf.Summary == SUMMARY_ALWAYS:
+	case conf.Summary == SUMMARY_ON_FAILURE && !record.Succeeded():
+	default:
+		return nil
+	}
+	r := receipt{record.Name, record.InvocationID, record.Start, record.DurationMs, record.ExitCode}
+	d := formatDuration(time.Duration(r.DurationMs) * time.Millisecond)
+	if r.ExitCode == 0 {
+		fmt.Fprintf(os.Stderr, tr("run: %s succeeded after %s, invocation %s\n"), r.Name, d, r.InvocationID)
+	} else {
+		fmt.Fprintf(os.Stderr, tr("run: %s failed with exit code %d after %s, invocation %s\n"), r.Name, r.ExitCode, d, r.InvocationID)
+	}
+	if conf.ReceiptsFile == "" {
+		return nil
+	}
+	raw, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(conf.ReceiptsFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer closeFile(file, &err)
+	_, err = file.Write(append(raw, '\n'))
+	return err
+}
+
+// invocationID returns the RUN_INVOCATION_ID of the context variables.
+func invocationID(ctxEnv []string) string {
+	for _, kv := range ctxEnv {
+		if strings.HasPrefix(kv, "RUN_INVOCATION_ID=") {
+			return strings.TrimPrefix(kv, "RUN_INVOCATION_ID=")
+		}
+	}
+	return ""
+}
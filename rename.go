@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const USAGE_RENAME_SCRIPT = "Usage:\n\trun -rename-script <script> <newFileName>\n\nRenames a script of the script folder and updates every command using it.\n<script> is its path or its file name in the script folder.\n"
+
+// RenameScriptCmd renames a script within its folder and points all commands
+// using it, also through --script-for and --validate, to the new name. The
+// script is renamed first and renamed back if the index cannot be updated.
+func RenameScriptCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf(tr(USAGE_RENAME_SCRIPT))
+	}
+	newName := args[1]
+	if newName != filepath.Base(newName) || newName == "." || newName == ".." {
+		return fmt.Errorf(tr("%q must be a file name, scripts are renamed within their folder.\n"), newName)
+	}
+	oldFp := args[0]
+	if !strings.ContainsAny(oldFp, `/\`) {
+		oldFp = filepath.Join(scriptDp, oldFp)
+	}
+	oldFp, err := filepath.Abs(oldFp)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(oldFp); err != nil {
+		return err
+	}
+	if !isInside(scriptDp, oldFp) {
+		return fmt.Errorf(tr("%s is not in the script folder %s. Move it there with:\n\trun -tidy\n"), oldFp, scriptDp)
+	}
+	newFp := filepath.Join(filepath.Dir(oldFp), newName)
+	if _, err := os.Lstat(newFp); err == nil {
+		return fmt.Errorf(tr("%s already exists.\n"), newFp)
+	}
+
+	if err := os.Rename(oldFp, newFp); err != nil {
+		return err
+	}
+	var users []string
+	var update modFn = func(cmd *jsonCmd) (inc, esc bool, err error) {
+		inc = true
+		used := false
+		if sameFile(cmd.Script, oldFp) {
+			cmd.Script, used = newFp, true
+		}
+		for goos, script := range cmd.Meta.ScriptOverrides {
+			if sameFile(script, oldFp) {
+				cmd.Meta.ScriptOverrides[goos], used = newFp, true
+			}
+		}
+		for i, script := range cmd.Meta.Candidates {
+			if sameFile(script, oldFp) {
+				cmd.Meta.Candidates[i], used = newFp, true
+			}
+		}
+		if sameFile(cmd.Meta.Validate, oldFp) {
+			cmd.Meta.Validate, used = newFp, true
+		}
+		if used {
+			users = append(users, cmd.Name)
+		}
+		return
+	}
+	if err := modOperation(indexFp, update); err != nil {
+		// the commands still use the old name
+		if renameErr := os.Rename(newFp, oldFp); renameErr != nil {
+			return fmt.Errorf("%w, renaming back failed too: %s", err, renameErr)
+		}
+		return err
+	}
+	if len(users) > 0 {
+		fmt.Printf(tr("Renamed %s to %s, updated %s.\n"), filepath.Base(oldFp), newName, strings.Join(users, ", "))
+	} else {
+		fmt.Printf(tr("Renamed %s to %s, no command uses it.\n"), filepath.Base(oldFp), newName)
+	}
+	return nil
+}
+
+// sameFile reports whether the paths a and b denote the same location, as
+// isInside compares them.
+func sameFile(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	a, b = resolveLocation(a), resolveLocation(b)
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// knownOS and knownArch are the GOOS and GOARCH values -mod --os and --arch
+// accept.
+var (
+	knownOS = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js",
+		"linux", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows"}
+	knownArch = []string{"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le",
+		"mipsle", "ppc64", "ppc64le", "riscv64", "s390x", "wasm"}
+)
+
+// unavailable returns why cmd cannot run on this machine because of its OS
+// and Arch, "" if it can.
+func unavailable(cmd *jsonCmd) string {
+	if len(cmd.Meta.OS) > 0 && !contains(cmd.Meta.OS, runtime.GOOS) {
+		return fmt.Sprintf(tr("only for %s"), strings.Join(cmd.Meta.OS, ", "))
+	}
+	if len(cmd.Meta.Arch) > 0 && !contains(cmd.Meta.Arch, runtime.GOARCH) {
+		return fmt.Sprintf(tr("only for %s"), strings.Join(cmd.Meta.Arch, ", "))
+	}
+	return ""
+}
+
+// requireBin adds the program of req, <bin>[=<install hint>], to the required
+// ones of m. An empty req removes all.
+func requireBin(m *meta, req string) {
+	if req == "" {
+		m.RequiresBin, m.InstallHints = nil, nil
+		return
+	}
+	bin, hint := req, ""
+	if i := strings.IndexByte(req, '='); i >= 0 {
+		bin, hint = req[:i], req[i+1:]
+	}
+	if !contains(m.RequiresBin, bin) {
+		m.RequiresBin = append(m.RequiresBin, bin)
+	}
+	if hint == "" {
+		delete(m.InstallHints, bin)
+		return
+	}
+	if m.InstallHints == nil {
+		m.InstallHints = make(map[string]string)
+	}
+	m.InstallHints[bin] = hint
+}
+
+// missingBins returns the required programs of cmd which are not in PATH.
+// A pinned program counts as present if it is cached or has a source in tools
+// of the config to download it from.
+func missingBins(scriptDp string, cmd *jsonCmd) []string {
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		conf = &config{} // reported by the caller or -doctor
+	}
+	var missing []string
+	for _, req := range cmd.Meta.RequiresBin {
+		bin, version := splitPin(req)
+		if _, ok := conf.Tools[bin]; version != "" && (ok || cachedTool(scriptDp, req) != "") {
+			continue
+		}
+		if _, err := exec.LookPath(bin); err != nil {
+			missing = append(missing, req)
+		}
+	}
+	return missing
+}
+
+// checkRequiredBins returns a single error listing all required programs of
+// cmd which are missing, so the script does not fail halfway through.
+func checkRequiredBins(scriptDp string, cmd *jsonCmd) error {
+	missing := missingBins(scriptDp, cmd)
+	if len(missing) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, tr("%s needs programs which are not in PATH:\n"), cmd.Name)
+	for _, bin := range missing {
+		if hint := cmd.Meta.InstallHints[bin]; hint != "" {
+			fmt.Fprintf(&b, "\t%-15s %s\n", bin, hint)
+		} else {
+			fmt.Fprintf(&b, "\t%s\n", bin)
+		}
+	}
+	return fmt.Errorf("%s", b.String())
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const RUNFILE_VERSION = 1
+
+// runfile bundles a command with its scripts into a single file to share it.
+// Script paths are replaced by the names of the bundled files.
+type runfile struct {
+	Version int           `json:"runfileVersion"`
+	Cmd     jsonCmd       `json:"command"`
+	Files   []runfileFile `json:"files"`
+}
+
+type runfileFile struct {
+	Name    string `json:"name"`
+	Sha256  string `json:"sha256"`
+	Content []byte `json:"content"` // base64
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+/******************************************************************************/
+
+const USAGE_PACK = "Usage:\n\trun -pack <cmd> [--out <file>]\n\nWithout --out, the command is written to <cmd>.runfile.\n"
+
+// PackCmd writes a command and its scripts, including the ones of other
+// platforms set with --script-for, into a runfile.
+func PackCmd(indexFp string, args []string) error {
+	fs := newFlagSet("-pack")
+	out := fs.String("out", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 {
+		return fmt.Errorf(tr(USAGE_PACK))
+	}
+	name := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_PACK))
+	}
+	if *out == "" {
+		*out = name + ".runfile"
+	}
+
+	var cmd jsonCmd
+	if err := Find(indexFp, name, &cmd); err != nil {
+		return err
+	}
+	rf := runfile{Version: RUNFILE_VERSION, Cmd: cmd}
+	rf.Cmd.Meta.Candidates = nil // they belong to this machine
+	bundle := func(script string) (string, error) {
+		content, err := os.ReadFile(script)
+		if err != nil {
+			return "", err
+		}
+		base := filepath.Base(script)
+		for _, f := range rf.Files {
+			if f.Name != base {
+				continue
+			}
+			if f.Sha256 != checksum(content) {
+				return "", fmt.Errorf(tr("%s cannot be packed, two of its scripts are named %s.\n"), name, base)
+			}
+			return base, nil
+		}
+		rf.Files = append(rf.Files, runfileFile{Name: base, Sha256: checksum(content), Content: content})
+		return base, nil
+	}
+
+	var err error
+	if rf.Cmd.Script, err = bundle(cmd.Script); err != nil {
+		return err
+	}
+	if len(cmd.Meta.ScriptOverrides) > 0 {
+		rf.Cmd.Meta.ScriptOverrides = make(map[string]string, len(cmd.Meta.ScriptOverrides))
+		goosList := make([]string, 0, len(cmd.Meta.ScriptOverrides))
+		for goos := range cmd.Meta.ScriptOverrides {
+			goosList = append(goosList, goos)
+		}
+		sort.Strings(goosList)
+		for _, goos := range goosList {
+			if rf.Cmd.Meta.ScriptOverrides[goos], err = bundle(cmd.Meta.ScriptOverrides[goos]); err != nil {
+				return err
+			}
+		}
+	}
+
+	raw, err := json.MarshalIndent(&rf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, append(raw, '\n'), 0640); err != nil {
+		return err
+	}
+	fmt.Printf(tr("Packed %s into %s\n"), name, *out)
+	return nil
+}
+
+/******************************************************************************/
+
+const USAGE_UNPACK = "Usage:\n\trun -unpack <file> [<name>]\n\nRegisters the command of a runfile, optionally under another name. Its scripts\nare written to the script folder.\n"
+
+// UnpackCmd verifies the checksums of a runfile, writes its scripts into the
+// script folder and registers the command. Nothing is overwritten.
+func UnpackCmd(scriptDp, indexFp string, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf(tr(USAGE_UNPACK))
+	}
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var rf runfile
+	if err := json.Unmarshal(raw, &rf); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	if rf.Version != RUNFILE_VERSION {
+		return fmt.Errorf(tr("%s is no runfile or of an unsupported version.\n"), args[0])
+	}
+	cmd := rf.Cmd
+	if len(args) == 2 {
+		cmd.Name = args[1]
+	}
+	if err := checkName(cmd.Name); err != nil {
+		return err
+	}
+
+	switch err := Find(indexFp, cmd.Name, &jsonCmd{}); {
+	case err == nil:
+		return fmt.Errorf(tr("There already is a command named %q. Pass another name:\n\trun -unpack %s <name>\n"), cmd.Name, args[0])
+	case !errors.Is(err, CmdNotFoundErr):
+		return err
+	}
+
+	paths := make(map[string]string, len(rf.Files))
+	for _, f := range rf.Files {
+		if f.Sha256 != checksum(f.Content) {
+			return fmt.Errorf(tr("Checksum of %s does not match, %s is damaged.\n"), f.Name, args[0])
+		}
+		if f.Name != filepath.Base(f.Name) || f.Name == "." || f.Name == ".." {
+			return fmt.Errorf(tr("Invalid file name %q in %s.\n"), f.Name, args[0])
+		}
+		fp := filepath.Join(scriptDp, f.Name)
+		if _, err := os.Stat(fp); err == nil {
+			return fmt.Errorf(tr("%s already exists.\n"), fp)
+		}
+		paths[f.Name] = fp
+	}
+	resolve := func(name string) (string, error) {
+		fp, ok := paths[name]
+		if !ok {
+			return "", fmt.Errorf(tr("%s is not bundled in %s.\n"), name, args[0])
+		}
+		return fp, nil
+	}
+	if cmd.Script, err = resolve(cmd.Script); err != nil {
+		return err
+	}
+	for goos, script := range cmd.Meta.ScriptOverrides {
+		if cmd.Meta.ScriptOverrides[goos], err = resolve(script); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range rf.Files {
+		if err := os.WriteFile(paths[f.Name], f.Content, 0750); err != nil {
+			return err
+		}
+	}
+	if err := insertIntoIndex(indexFp, &cmd); err != nil {
+		return err
+	}
+	fmt.Printf(tr("Registered %s with %s\n"), cmd.Name, cmd.Script)
+	return nil
+}
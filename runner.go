@@ -0,0 +1,21 @@
+package main
+
+import "os/exec"
+
+// commandRunner starts and awaits the script of a command. Run goes through
+// runner instead of calling os/exec itself, so that tests can replace it with
+// a fake that records the command line instead of executing it.
+type commandRunner interface {
+	Start(exe *exec.Cmd) error
+	Wait(exe *exec.Cmd) error
+}
+
+// execRunner runs commands with os/exec.
+type execRunner struct{}
+
+func (execRunner) Start(exe *exec.Cmd) error { return exe.Start() }
+
+func (execRunner) Wait(exe *exec.Cmd) error { return exe.Wait() }
+
+// runner is the commandRunner of Run.
+var runner commandRunner = execRunner{}
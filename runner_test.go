@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRunner records the commands instead of executing them.
+type fakeRunner struct {
+	started []*exec.Cmd
+	err     error // returned by Wait
+}
+
+func (r *fakeRunner) Start(exe *exec.Cmd) error {
+	r.started = append(r.started, exe)
+	return nil
+}
+
+func (r *fakeRunner) Wait(exe *exec.Cmd) error { return r.err }
+
+// setFakeRunner replaces runner for the test.
+func setFakeRunner(t *testing.T) *fakeRunner {
+	t.Helper()
+	fake := &fakeRunner{}
+	old := runner
+	runner = fake
+	t.Cleanup(func() { runner = old })
+	return fake
+}
+
+// envValue returns the value of key in env, the last one wins.
+func envValue(env []string, key string) string {
+	value := ""
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			value = kv[len(key)+1:]
+		}
+	}
+	return value
+}
+
+func TestRunPassesCommand(t *testing.T) {
+	fake := setFakeRunner(t)
+	scriptDp, indexFp := newTestRegistry(t)
+	script := filepath.Join(scriptDp, "greet.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	workdir := t.TempDir()
+	cmd := jsonCmd{Name: "greet", Script: script, Meta: meta{
+		MaxNumArgs:  -1,
+		DefaultArgs: []string{"--loud"},
+		Env:         []string{"GREETING=hello"},
+		Workdir:     workdir,
+	}}
+	if err := insertIntoIndex(indexFp, &cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"you & me", "$HOME", ""}
+	if err := Run(append([]string{"greet", "--with-env", "GREETING=hi"}, args...), scriptDp, indexFp); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.started) != 1 {
+		t.Fatalf("started %d commands, want 1", len(fake.started))
+	}
+	exe := fake.started[0]
+	// the interpreter may come first, the arguments are passed unchanged
+	if got, want := exe.Args[len(exe.Args)-4:], append([]string{"--loud"}, args...); !reflect.DeepEqual(got, want) {
+		t.Errorf("arguments %q, want %q", got, want)
+	}
+	if exe.Dir != workdir {
+		t.Errorf("workdir %q, want %q", exe.Dir, workdir)
+	}
+	if got := envValue(exe.Env, "GREETING"); got != "hi" {
+		t.Errorf("GREETING=%q, want the value of --with-env", got)
+	}
+	if got := envValue(exe.Env, "RUN_NAME"); got != "greet" {
+		t.Errorf("RUN_NAME=%q, want greet", got)
+	}
+}
+
+func TestRunRecordsFailure(t *testing.T) {
+	fake := setFakeRunner(t)
+	fake.err = errors.New("failed")
+	scriptDp, indexFp := newTestRegistry(t)
+	script := filepath.Join(scriptDp, "fail.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	register(t, indexFp, scriptDp, "fail")
+
+	if err := Run([]string{"fail"}, scriptDp, indexFp); err != fake.err {
+		t.Errorf("Run() = %v, want the error of the script", err)
+	}
+	var entries []historyEntry
+	if err := readHistory(scriptDp, func(entry *historyEntry) bool {
+		entries = append(entries, *entry)
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "fail" || entries[0].ExitCode == 0 {
+		t.Errorf("history %+v, want one failed run of fail", entries)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const USAGE_SELFTEST = "Usage:\n\trun -selftest [--dir <dir>] [--keep]\n\nRuns this build of run end to end: it creates a registry in a temporary folder\nand registers, lists, runs, changes, tidies and deletes a command in it. Your\nown registry is not touched. The folder is created in your home folder, to test\nits file system, f. e. NFS, or in --dir, and removed afterwards unless --keep is\ngiven. Attach the report to bug reports.\n"
+
+// selftestStep is an invocation of run and the check of its output, which
+// returns what is wrong, "" if nothing.
+type selftestStep struct {
+	name  string
+	args  []string
+	check func(out string, err error) string
+}
+
+// SelftestCmd runs the executable of run with a temporary home, so that it
+// works like on the command line of the user, including the detection of the
+// home folder.
+func SelftestCmd(scriptDp string, args []string) error {
+	fs := newFlagSet("-selftest")
+	dir := fs.String("dir", "", "")
+	keep := fs.Bool("keep", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_SELFTEST))
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = filepath.Dir(baseDir(scriptDp))
+	}
+	home, err := os.MkdirTemp(*dir, ".run-selftest-")
+	if err != nil {
+		if home, err = os.MkdirTemp("", "run-selftest-"); err != nil {
+			return err
+		}
+	}
+	if *keep {
+		defer fmt.Printf(tr("Kept %s.\n"), home)
+	} else {
+		defer os.RemoveAll(home)
+	}
+
+	platform, err := getPlatform()
+	if err != nil {
+		return err
+	}
+	testScriptDp := filepath.Join(home, BASE_DIR, SCRIPT_DIR, platform.String())
+	if PORTABLE == "true" {
+		// a portable build keeps its registry next to the executable
+		if exe, err = copyExecutable(exe, home); err != nil {
+			return err
+		}
+	}
+	srcDp := filepath.Join(home, "src")
+	if err := os.Mkdir(srcDp, 0750); err != nil {
+		return err
+	}
+	srcFp, text := filepath.Join(srcDp, "hello.sh"), "#!/bin/sh\necho \"hello $1\"\n"
+	switch platform {
+	case WINDOWS:
+		srcFp, text = filepath.Join(srcDp, "hello.bat"), "@echo hello %1\r\n"
+	case PLAN9:
+		srcFp, text = filepath.Join(srcDp, "hello.rc"), "#!/bin/rc\necho hello $1\n"
+	}
+	if err := os.WriteFile(srcFp, []byte(text), 0750); err != nil {
+		return err
+	}
+	tidiedFp := filepath.Join(testScriptDp, filepath.Base(srcFp))
+
+	steps := []selftestStep{
+		{"init", []string{"-init"}, allOf(succeeds, exists(filepath.Join(testScriptDp, INDEX_FILE)))},
+		{"new", []string{"-new", "hello", srcFp, "1", "1"}, succeeds},
+		{"list", []string{"-list"}, allOf(succeeds, prints("hello"))},
+		{"execute", []string{"hello", "world"}, allOf(succeeds, prints("hello world"))},
+		{"argument count", []string{"hello"}, fails},
+		{"mod", []string{"-mod", "hello", "--description", "greets people"}, succeeds},
+		{"list description", []string{"-list"}, allOf(succeeds, prints("greets people"))},
+		{"rename", []string{"-mod", "hello", "hi"}, succeeds},
+		{"execute renamed", []string{"hi", "again"}, allOf(succeeds, prints("hello again"))},
+		{"tidy", []string{"-tidy"}, allOf(succeeds, exists(tidiedFp))},
+		{"execute tidied", []string{"hi", "tidy"}, allOf(succeeds, prints("hello tidy"))},
+		{"lint", []string{"-lint-index"}, succeeds},
+		{"del", []string{"-del", "hi"}, succeeds},
+		{"list deleted", []string{"-list"}, allOf(succeeds, lacks("hi "))},
+	}
+
+	shell := os.Getenv("SHELL")
+	if runtime.GOOS == "windows" {
+		shell = os.Getenv("ComSpec")
+	}
+	fmt.Println(tr("run self-test"))
+	fmt.Printf("  %-10s %s/%s, %s\n", tr("platform"), runtime.GOOS, runtime.GOARCH, runtime.Version())
+	fmt.Printf("  %-10s %s\n", tr("shell"), shell)
+	fmt.Printf("  %-10s %s\n", tr("folder"), home)
+	passed := 0
+	for _, step := range steps {
+		start := time.Now()
+		out, err := selftestRun(exe, home, step.args)
+		d := time.Since(start).Round(time.Millisecond)
+		problem := step.check(out, err)
+		if problem == "" {
+			passed++
+			fmt.Printf("PASS  %-18s %s\n", step.name, d)
+			continue
+		}
+		fmt.Printf("FAIL  %-18s %s\n", step.name, d)
+		fmt.Printf("      run %s\n      %s\n", strings.Join(step.args, " "), problem)
+		for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+			fmt.Printf("      | %s\n", line)
+		}
+	}
+	fmt.Printf(tr("%d of %d steps passed.\n"), passed, len(steps))
+	if passed < len(steps) {
+		return &SilentExit{Code: 1}
+	}
+	return nil
+}
+
+// selftestRun runs exe with args and home as home folder and returns its
+// combined output.
+func selftestRun(exe, home string, args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, exe, append([]string{"--lang", "en"}, args...)...)
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, "=", 2)[0]
+		// the variables of run, of privilege escalation and of the home
+		// folder would leak the registry of the user
+		if strings.HasPrefix(key, "RUN_") || contains(userNameEnvs, key) || contains(userIdEnvs, key) ||
+			strings.EqualFold(key, "HOME") || strings.EqualFold(key, "USERPROFILE") {
+			continue
+		}
+		cmd.Env = append(cmd.Env, kv)
+	}
+	cmd.Env = append(cmd.Env, "HOME="+home, "USERPROFILE="+home)
+	if runtime.GOOS == "plan9" {
+		cmd.Env = append(cmd.Env, "home="+home)
+	}
+	cmd.Dir = home
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		err = fmt.Errorf(tr("timed out after 30s"))
+	}
+	return string(out), err
+}
+
+// copyExecutable copies exe into dp and returns the path of the copy.
+func copyExecutable(exe, dp string) (fp string, err error) {
+	src, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	fp = filepath.Join(dp, filepath.Base(exe))
+	dst, err := os.OpenFile(fp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0750)
+	if err != nil {
+		return "", err
+	}
+	defer closeFile(dst, &err)
+	_, err = io.Copy(dst, src)
+	return fp, err
+}
+
+// Checks of selftestStep.
+
+func succeeds(out string, err error) string {
+	if err != nil {
+		return fmt.Sprintf(tr("failed: %s"), err)
+	}
+	return ""
+}
+
+func fails(out string, err error) string {
+	if err == nil {
+		return tr("succeeded, but should have failed")
+	}
+	return ""
+}
+
+func prints(s string) func(string, error) string {
+	return func(out string, err error) string {
+		if !strings.Contains(out, s) {
+			return fmt.Sprintf(tr("the output lacks %q"), s)
+		}
+		return ""
+	}
+}
+
+func lacks(s string) func(string, error) string {
+	return func(out string, err error) string {
+		if strings.Contains(out, "\n"+s) {
+			return fmt.Sprintf(tr("the output still contains %q"), s)
+		}
+		return ""
+	}
+}
+
+func exists(fp string) func(string, error) string {
+	return func(out string, err error) string {
+		if _, statErr := os.Stat(fp); statErr != nil {
+			return statErr.Error()
+		}
+		return ""
+	}
+}
+
+// allOf passes if every check passes and returns the first problem otherwise.
+func allOf(checks ...func(string, error) string) func(string, error) string {
+	return func(out string, err error) string {
+		for _, check := range checks {
+			if problem := check(out, err); problem != "" {
+				return problem
+			}
+		}
+		return ""
+	}
+}
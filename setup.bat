@@ -34,7 +34,9 @@ if exist "%RUN_FILEPATH%" (
 
 
 :: 2) build the executable in the current directory
-go build -o %~dp0\run.exe %~dp0\main.go %~dp0\cmd.go
+pushd "%~dp0"
+go build -o run.exe .
+popd
 
 :: Block mkdir and go build is done.
 :waittofinish
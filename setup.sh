@@ -1,6 +1,7 @@
-#!/bin/bash
+#!/bin/sh
 # build source
-if [ "$EUID" -ne 0 ]
+# POSIX sh, because bash is not installed to /bin on the BSDs.
+if [ "$(id -u)" -ne 0 ]
     then 
         echo "Remember to run this as administrator."
         echo "  $ sudo ./script.sh <path to go installation>"
@@ -10,5 +11,5 @@ fi
 # Need to set PATH, because script will not read ~/.bashrc
 GOINSTALLPATH=$(dirname $1)
 export PATH=$PATH:$GOINSTALLPATH
-go build -o run main.go cmd.go
+go build -o run .
 mv ./run /usr/local/bin/run
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+)
+
+// signalTrap keeps run alive while its script handles a signal, so that run
+// cleans up after the script: it removes the decrypted script, restores the
+// terminal title and records the execution. The interrupt of Ctrl-C reaches
+// the script without help, the terminal sends it to the whole process group;
+// the other signals are forwarded to the script.
+type signalTrap struct {
+	ch      chan os.Signal
+	mu      sync.Mutex
+	process *os.Process
+	caught  os.Signal // caught before the script started
+	// onSignal restores the terminal once the script got a signal
+	onSignal []func()
+}
+
+// trapSignals traps the signals until stop is called.
+func trapSignals() *signalTrap {
+	t := &signalTrap{ch: make(chan os.Signal, 1)}
+	signal.Notify(t.ch, trappedSignals...)
+	go func() {
+		for sig := range t.ch {
+			t.mu.Lock()
+			if t.process == nil {
+				t.caught = sig
+			} else {
+				if sig != os.Interrupt {
+					t.process.Signal(sig)
+				}
+				for _, fn := range t.onSignal {
+					fn()
+				}
+				t.onSignal = nil
+			}
+			t.mu.Unlock()
+		}
+	}()
+	return t
+}
+
+// restoreOnSignal calls fn once the script got a signal. The terminal is thus
+// restored at once, even if a child of the script still holds its output and
+// run cannot return yet.
+func (t *signalTrap) restoreOnSignal(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onSignal = append(t.onSignal, fn)
+}
+
+// start starts exe, unless a signal was caught before.
+func (t *signalTrap) start(exe *exec.Cmd) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.caught != nil {
+		return fmt.Errorf(tr("Interrupted by %s.\n"), t.caught)
+	}
+	if err := runner.Start(exe); err != nil {
+		return err
+	}
+	t.process = exe.Process
+	return nil
+}
+
+func (t *signalTrap) stop() {
+	signal.Stop(t.ch)
+	close(t.ch)
+}
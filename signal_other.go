@@ -0,0 +1,22 @@
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// trappedSignals are the signals which end run, but not before its script.
+// Windows sends SIGTERM when the console is closed.
+var trappedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// signalExitCode returns the exit code of a shell for a process killed by a
+// signal, 128 plus its number, else -1.
+func signalExitCode(state *os.ProcessState) int {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return -1
+}
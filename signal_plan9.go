@@ -0,0 +1,11 @@
+package main
+
+import "os"
+
+// trappedSignals are the notes which end run, but not before its script.
+var trappedSignals = []os.Signal{os.Interrupt}
+
+// signalExitCode is -1, Plan 9 reports notes in the exit string.
+func signalExitCode(state *os.ProcessState) int {
+	return -1
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const USAGE_SIZE = "Usage:\n\trun -size [--prune-cache] [--prune-logs]\n\nShows the disk usage of the registry: every script, the script folder, the\nlogs, the cache of compiled Go scripts, the tool cache, the trash and the\nbackups.\n--prune-cache empties the cache, the scripts are compiled again when run.\n--prune-logs prunes the history with historyMaxEntries and historyMaxAge. The\naudit log is never pruned.\n"
+
+// SizeCmd reports the disk usage of the registry and cleans up on request.
+func SizeCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-size")
+	pruneCache := fs.Bool("prune-cache", false, "")
+	pruneLogs := fs.Bool("prune-logs", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_SIZE))
+	}
+	runDp := baseDir(scriptDp)
+	cacheDp := filepath.Join(runDp, CACHE_DIR)
+
+	if *pruneCache {
+		size, err := dirSize(cacheDp)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(cacheDp); err != nil {
+			return err
+		}
+		fmt.Printf(tr("Removed the cache, %s.\n"), formatSize(size))
+	}
+	if *pruneLogs {
+		conf, err := loadConfig(scriptDp)
+		if err != nil {
+			return err
+		}
+		n, err := pruneWithConfig(scriptDp, conf, 0, "")
+		if err != nil {
+			return err
+		}
+		fmt.Printf(tr("Removed %d entries of the history.\n"), n)
+	}
+	if *pruneCache || *pruneLogs {
+		fmt.Println()
+	}
+
+	// scripts shared by commands are listed once
+	byScript := make(map[string][]string)
+	var collect findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		byScript[cmd.Script] = append(byScript[cmd.Script], cmd.Name)
+		return
+	}
+	if err := findOperation(indexFp, collect); err != nil {
+		return err
+	}
+	type scriptSize struct {
+		fp    string
+		names []string
+		size  int64
+	}
+	scripts := make([]scriptSize, 0, len(byScript))
+	for fp, names := range byScript {
+		s := scriptSize{fp, names, -1}
+		if fi, err := os.Stat(fp); err == nil {
+			s.size = fi.Size()
+		}
+		scripts = append(scripts, s)
+	}
+	sort.Slice(scripts, func(i, j int) bool {
+		if scripts[i].size != scripts[j].size {
+			return scripts[i].size > scripts[j].size
+		}
+		return scripts[i].fp < scripts[j].fp
+	})
+	for _, s := range scripts {
+		size := tr("missing")
+		if s.size >= 0 {
+			size = formatSize(s.size)
+		}
+		fmt.Printf("%10s  %-20s %s\n", size, strings.Join(s.names, ", "), s.fp)
+	}
+	if len(scripts) > 0 {
+		fmt.Println()
+	}
+
+	var logs int64
+	for _, name := range []string{AUDIT_FILE, HISTORY_FILE, HISTORY_PRUNED_FILE} {
+		if fi, err := os.Stat(filepath.Join(runDp, name)); err == nil {
+			logs += fi.Size()
+		}
+	}
+	var total int64
+	parts := []struct {
+		label string
+		fp    string
+		size  int64
+	}{
+		{tr("Script folder"), scriptDp, -1},
+		{tr("Logs"), runDp, logs},
+		{tr("Cache"), cacheDp, -1},
+		{tr("Tool cache"), filepath.Join(runDp, TOOL_CACHE_DIR), -1},
+		{tr("Trash"), filepath.Join(runDp, TRASH_DIR), -1},
+		{tr("Backups"), filepath.Join(runDp, BACKUP_DIR), -1},
+	}
+	for _, p := range parts {
+		size := p.size
+		if size < 0 {
+			var err error
+			if size, err = dirSize(p.fp); err != nil {
+				return err
+			}
+		}
+		total += size
+		fmt.Printf("%-14s %10s  %s\n", p.label, formatSize(size), p.fp)
+	}
+	fmt.Printf("%-14s %10s\n", tr("Total"), formatSize(total))
+	return nil
+}
+
+// dirSize sums the sizes of the files below dp, 0 if it does not exist.
+func dirSize(dp string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dp, func(fp string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// formatSize formats a number of bytes with a binary unit, f. e. 1.5 MiB.
+func formatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, unit := float64(n)/1024, 0
+	for size >= 1024 && unit < 3 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", size, []string{"KiB", "MiB", "GiB", "TiB"}[unit])
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const LOCK_DIR string = "locks"
+
+// acquireSlot takes one of max slots shared by all run processes of the user,
+// f. e. cron jobs, watchers and manual invocations. Without a free slot, it
+// waits for one, or fails with noWait. max 0 is unlimited. Nested runs use the
+// slot of the outermost one, as they would wait for themselves.
+func acquireSlot(scriptDp string, max int, stack []string, noWait bool) (release func(), err error) {
+	if max <= 0 || len(stack) > 1 {
+		return func() {}, nil
+	}
+	dir := filepath.Join(baseDir(scriptDp), LOCK_DIR)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	waiting := false
+	for {
+		for i := 0; i < max; i++ {
+			release, ok, err := tryLock(filepath.Join(dir, fmt.Sprintf("slot-%d", i)))
+			if err != nil || ok {
+				return release, err
+			}
+		}
+		if noWait {
+			return nil, fmt.Errorf(tr("All %d slots of maxConcurrentRuns are taken by running commands.\n"), max)
+		}
+		if !waiting {
+			fmt.Fprintf(os.Stderr, tr("Waiting for a running command to finish, maxConcurrentRuns is %d...\n"), max)
+			waiting = true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
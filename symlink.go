@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// linkTarget returns the final target of fp if it is a symlink, else "". The
+// target of a broken symlink is returned as stored in the link.
+func linkTarget(fp string) string {
+	fi, err := os.Lstat(fp)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return ""
+	}
+	if target, err := filepath.EvalSymlinks(fp); err == nil {
+		return target
+	}
+	target, _ := os.Readlink(fp)
+	return target
+}
+
+// isBrokenLink reports whether fp is a symlink whose target does not exist.
+func isBrokenLink(fp string) bool {
+	if linkTarget(fp) == "" {
+		return false
+	}
+	_, err := os.Stat(fp)
+	return err != nil
+}
+
+// moveLink moves the symlink fp, pointing to target, to newPath for -tidy.
+// The user is asked whether to move the target instead; without a terminal,
+// the link is moved. Either way, nothing breaks: a moved link points to the
+// absolute target, a moved target stays linked from its old location.
+func moveLink(fp, target, newPath string) error {
+	if confirm(fmt.Sprintf(tr("%s is a symlink to %s. Move the target instead of the link?"), fp, target)) {
+		if err := os.Rename(target, newPath); err != nil {
+			return err
+		}
+		if err := os.Remove(fp); err != nil {
+			return err
+		}
+		return os.Symlink(newPath, fp)
+	}
+	if err := os.Symlink(target, newPath); err != nil {
+		return err
+	}
+	return os.Remove(fp)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// systemDir returns the folder of the system-wide registry, shared by all
+// users, f. e. the blessed ops scripts of a jump host. $RUN_SYSTEM_DIR
+// overrides the default. Its layout is the one of ~/.run.
+func systemDir() string {
+	if dir := os.Getenv("RUN_SYSTEM_DIR"); dir != "" {
+		return dir
+	}
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.Getenv("ProgramData"), "run")
+	case "plan9":
+		return "/lib/run"
+	}
+	return "/usr/local/share/run"
+}
+
+// systemIndex returns the index of the system registry for the platform of
+// scriptDp.
+func systemIndex(scriptDp string) string {
+	return filepath.Join(systemDir(), SCRIPT_DIR, filepath.Base(scriptDp), INDEX_FILE)
+}
+
+// findRegistered is Find in the personal index, then in the index of the
+// system registry. Personal commands shadow system commands of the same name.
+func findRegistered(scriptDp, indexFp, name string, cmd *jsonCmd) error {
+	personalErr := Find(indexFp, name, cmd)
+	sysIndexFp := systemIndex(scriptDp)
+	if sysIndexFp == indexFp {
+		return personalErr
+	}
+	// users of a jump host may have no registry of their own
+	if err := personalErr; !errors.Is(err, CmdNotFoundErr) && !os.IsNotExist(err) {
+		return err
+	}
+	switch sysErr := Find(sysIndexFp, name, cmd); {
+	case os.IsNotExist(sysErr):
+		return personalErr
+	default:
+		return sysErr
+	}
+}
+
+// checkWritable refuses changes to a registry the user may not write, f. e.
+// the system registry without membership in its group.
+func checkWritable(scriptDp string) error {
+	file, err := os.CreateTemp(scriptDp, ".write-test-*")
+	if os.IsPermission(err) {
+		return fmt.Errorf(tr("You may not change the registry %s. Ask its administrator for write access, f. e. through its group.\n"), scriptDp)
+	}
+	if err != nil {
+		return nil // f. e. -init creates the folder
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
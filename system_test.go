@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setSystemDir points the system registry to a temporary folder and returns
+// its index, with a command hi.
+func setSystemDir(t *testing.T) (sysIndexFp string) {
+	t.Helper()
+	dir := t.TempDir()
+	old, had := os.LookupEnv("RUN_SYSTEM_DIR")
+	os.Setenv("RUN_SYSTEM_DIR", dir)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv("RUN_SYSTEM_DIR", old)
+		} else {
+			os.Unsetenv("RUN_SYSTEM_DIR")
+		}
+	})
+	sysIndexFp = filepath.Join(dir, SCRIPT_DIR, "unix", INDEX_FILE)
+	if err := os.MkdirAll(filepath.Dir(sysIndexFp), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIndex(sysIndexFp, []jsonCmd{{Name: "hi", Script: "/system/hi.sh", Meta: meta{MaxNumArgs: -1}}}); err != nil {
+		t.Fatal(err)
+	}
+	return sysIndexFp
+}
+
+func TestFindRegisteredSystemOnly(t *testing.T) {
+	setSystemDir(t)
+	// a user without registry of their own
+	scriptDp := filepath.Join(t.TempDir(), BASE_DIR, SCRIPT_DIR, "unix")
+	indexFp := filepath.Join(scriptDp, INDEX_FILE)
+
+	var cmd jsonCmd
+	if err := findRegistered(scriptDp, indexFp, "hi", &cmd); err != nil || cmd.Script != "/system/hi.sh" {
+		t.Errorf("findRegistered(hi) = %v, %+v", err, cmd)
+	}
+	if err := findRegistered(scriptDp, indexFp, "missing", &cmd); err != CmdNotFoundErr {
+		t.Errorf("findRegistered(missing) = %v, want CmdNotFoundErr", err)
+	}
+	if _, args, err := getCommand(scriptDp, []string{"hi", "x"}, indexFp); err != nil || args[0] != "/system/hi.sh" {
+		t.Errorf("getCommand(hi) = %q, %v", args, err)
+	}
+}
+
+func TestFindRegisteredPersonalFirst(t *testing.T) {
+	setSystemDir(t)
+	scriptDp := filepath.Join(t.TempDir(), BASE_DIR, SCRIPT_DIR, "unix")
+	indexFp := filepath.Join(scriptDp, INDEX_FILE)
+	if err := os.MkdirAll(scriptDp, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	personal := []jsonCmd{{Name: "hi", Script: filepath.Join(scriptDp, "hi.sh"), Meta: meta{MaxNumArgs: -1}}}
+	if err := writeIndex(indexFp, personal); err != nil {
+		t.Fatal(err)
+	}
+
+	var cmd jsonCmd
+	if err := findRegistered(scriptDp, indexFp, "hi", &cmd); err != nil || cmd.Script != filepath.Join(scriptDp, "hi.sh") {
+		t.Errorf("findRegistered(hi) = %v, %+v", err, cmd)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const TEMPLATE_DIR string = "templates"
+
+// templateVar is a variable declared in the front matter of a template:
+//
+//	---
+//	service: name of the service
+//	port=8080: port it listens on
+//	---
+//	#!/bin/sh
+//	exec server --name {{service}} --port {{port}}
+//
+// Only declared variables are substituted, other {{...}} stay as they are.
+type templateVar struct {
+	Name        string
+	Default     string
+	Description string
+}
+
+// templateDp returns ~/.run/templates.
+func templateDp(scriptDp string) string {
+	return filepath.Join(baseDir(scriptDp), TEMPLATE_DIR)
+}
+
+// findTemplate returns the template name of the templates folder, with or
+// without its extension.
+func findTemplate(scriptDp, name string) (string, error) {
+	dp := templateDp(scriptDp)
+	entries, err := os.ReadDir(dp)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if e.Name() == name || scriptName(e.Name()) == name {
+			return filepath.Join(dp, e.Name()), nil
+		}
+		names = append(names, scriptName(e.Name()))
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf(tr("There is no template %q, %s holds none.\n"), name, dp)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf(tr("There is no template %q. Available are: %s\n"), name, strings.Join(names, ", "))
+}
+
+// parseTemplate splits a template into its variables and its text.
+func parseTemplate(fp string) ([]templateVar, string, error) {
+	raw, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, "", err
+	}
+	text := strings.ReplaceAll(string(raw), "\r\n", "\n")
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, text, nil
+	}
+	end := strings.Index(text[4:], "\n---\n")
+	if end < 0 {
+		return nil, "", fmt.Errorf(tr("%s: the front matter is not closed by ---.\n"), fp)
+	}
+	head, body := text[4:4+end], text[4+end+5:]
+
+	var vars []templateVar
+	for i, line := range strings.Split(head, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			colon = len(line)
+		}
+		v := templateVar{Name: strings.TrimSpace(line[:colon])}
+		if colon < len(line) {
+			v.Description = strings.TrimSpace(line[colon+1:])
+		}
+		if eq := strings.IndexByte(v.Name, '='); eq >= 0 {
+			v.Name, v.Default = strings.TrimSpace(v.Name[:eq]), strings.TrimSpace(v.Name[eq+1:])
+		}
+		if v.Name == "" || strings.ContainsAny(v.Name, " \t{}") {
+			return nil, "", fmt.Errorf(tr("%s:%d: invalid variable %q.\n"), fp, i+2, line)
+		}
+		vars = append(vars, v)
+	}
+	return vars, body, nil
+}
+
+// fillTemplate returns the text of the template with its variables replaced.
+// Values missing in given are asked for on the terminal, else their default
+// is used; without one, it fails.
+func fillTemplate(fp string, given map[string]string) (string, error) {
+	vars, text, err := parseTemplate(fp)
+	if err != nil {
+		return "", err
+	}
+	for name := range given {
+		declared := false
+		for _, v := range vars {
+			declared = declared || v.Name == name
+		}
+		if !declared {
+			return "", fmt.Errorf(tr("The template %s has no variable %q.\n"), fp, name)
+		}
+	}
+
+	var p *prompter
+	if isTerminal() {
+		p = &prompter{bufio.NewReader(os.Stdin)}
+	}
+	pairs := make([]string, 0, 2*len(vars))
+	for _, v := range vars {
+		val, ok := given[v.Name]
+		switch {
+		case ok:
+		case p != nil:
+			question := v.Name
+			if v.Description != "" {
+				question += " (" + v.Description + ")"
+			}
+			for val == "" {
+				if val, err = p.ask(question, v.Default); err != nil {
+					return "", err
+				}
+			}
+		case v.Default != "":
+			val = v.Default
+		default:
+			return "", fmt.Errorf(tr("The template variable %s has no default. Pass it with --var %s=<value>.\n"), v.Name, v.Name)
+		}
+		pairs = append(pairs, "{{"+v.Name+"}}", val)
+	}
+	return strings.NewReplacer(pairs...).Replace(text), nil
+}
+
+// parseTemplateArgs parses "--template <tpl> [--var <name>=<value>]..." at
+// the start of args and returns the remaining arguments.
+func parseTemplateArgs(args []string) (tpl string, vars map[string]string, rest []string, err error) {
+	if len(args) < 2 {
+		return "", nil, nil, fmt.Errorf(tr("Option %s requires a value.\n"), "--template")
+	}
+	tpl, args = args[1], args[2:]
+	vars = make(map[string]string)
+	for len(args) > 0 && args[0] == "--var" {
+		if len(args) < 2 || strings.IndexByte(args[1], '=') <= 0 {
+			return "", nil, nil, fmt.Errorf(tr("--var expects <name>=<value>.\n"))
+		}
+		kv := strings.SplitN(args[1], "=", 2)
+		vars[kv[0]] = kv[1]
+		args = args[2:]
+	}
+	return tpl, vars, args, nil
+}
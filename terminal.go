@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Escape sequences of terminal emulators. The title stack of xterm restores
+// the previous title; terminals without it keep ours until the shell sets its
+// own.
+const (
+	pushTitle    = "\x1b[22;0t"
+	popTitle     = "\x1b[23;0t"
+	setTitle     = "\x1b]0;%s\x07"
+	progressBusy = "\x1b]9;4;3\x07" // indeterminate progress in the tab
+	progressDone = "\x1b]9;4;0\x07"
+	notify9      = "\x1b]9;%s\x07"
+	notify777    = "\x1b]777;notify;%s;%s\x07"
+)
+
+// terminalStatus shows in the terminal that a command runs: in the title with
+// terminalTitle, and with terminalNotify as progress in the tab and as
+// notification when it ends. It writes to stderr, if that is a terminal. Nested
+// calls of run leave the status of the outermost command.
+type terminalStatus struct {
+	name   string
+	title  bool
+	notify string // "9" or "777", the notifications the terminal supports
+
+	mu       sync.Mutex // restore may be called by the signal trap
+	restored bool
+}
+
+// startTerminalStatus shows that name runs. The returned status must be ended.
+func startTerminalStatus(scriptDp, name string, plain bool) (*terminalStatus, error) {
+	s := &terminalStatus{name: name}
+	if plain || os.Getenv("RUN_INVOCATION_ID") != "" || !isTerminalFile(os.Stderr) {
+		return s, nil
+	}
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return nil, err
+	}
+	s.title = conf.TerminalTitle
+	if conf.TerminalNotify {
+		s.notify = notifySupport()
+	}
+	if s.title {
+		fmt.Fprint(os.Stderr, pushTitle)
+		fmt.Fprintf(os.Stderr, setTitle, fmt.Sprintf(tr("run %s — running…"), name))
+	}
+	if s.notify == "9" {
+		fmt.Fprint(os.Stderr, progressBusy)
+	}
+	return s, nil
+}
+
+// restore restores the title and ends the progress in the tab, once.
+func (s *terminalStatus) restore() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.restored {
+		return
+	}
+	s.restored = true
+	if s.title {
+		fmt.Fprint(os.Stderr, popTitle)
+	}
+	if s.notify == "9" {
+		fmt.Fprint(os.Stderr, progressDone)
+	}
+}
+
+// end restores the terminal and notifies of the result.
+func (s *terminalStatus) end(code int, d time.Duration) {
+	s.restore()
+	if s.notify == "" {
+		return
+	}
+	msg := fmt.Sprintf(tr("run %s finished after %s"), s.name, formatDuration(d))
+	if code != 0 {
+		msg = fmt.Sprintf(tr("run %s failed with exit code %d after %s"), s.name, code, formatDuration(d))
+	}
+	switch s.notify {
+	case "9":
+		fmt.Fprintf(os.Stderr, notify9, msg)
+	case "777":
+		fmt.Fprintf(os.Stderr, notify777, "run", msg)
+	}
+}
+
+// notifySupport guesses the notifications of the terminal from its
+// environment, "" if it knows none. Unknown sequences would be printed by
+// some terminals.
+func notifySupport() string {
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("WT_SESSION") != "" || os.Getenv("ConEmuANSI") == "ON":
+		return "9" // Windows Terminal, ConEmu
+	case program == "iTerm.app" || program == "WezTerm":
+		return "9"
+	case strings.HasPrefix(term, "rxvt") || strings.HasPrefix(term, "foot") || program == "ghostty":
+		return "777"
+	}
+	return ""
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const TOOL_CACHE_DIR = "toolcache"
+
+// MAX_TOOL_DOWNLOAD limits the downloads of pinned programs, which are release
+// archives.
+const MAX_TOOL_DOWNLOAD = 256 << 20
+
+// toolSource tells where a pinned program, f. e. --requires terraform@1.7.5,
+// is downloaded from.
+type toolSource struct {
+	// Url is an HTTPS URL with the placeholders {version}, {os} and {arch},
+	// the GOOS and GOARCH of this machine. A .zip, .tar.gz or .tgz is
+	// unpacked, anything else is the program itself.
+	Url string `json:"url"`
+	// Sha256 are the checksums of the downloads by <version>/<os>/<arch>,
+	// f. e. 1.7.5/linux/amd64. A download without is refused.
+	Sha256 map[string]string `json:"sha256,omitempty"`
+}
+
+// splitPin splits a required program into its name and pinned version, ""
+// if it is not pinned, f. e. terraform@1.7.5.
+func splitPin(req string) (bin, version string) {
+	if i := strings.LastIndexByte(req, '@'); i > 0 {
+		return req[:i], req[i+1:]
+	}
+	return req, ""
+}
+
+// toolDir is the folder of the cached program bin of version for this
+// machine, ~/.run/toolcache/<bin>/<version>/<os>_<arch>.
+func toolDir(scriptDp, bin, version string) string {
+	return filepath.Join(baseDir(scriptDp), TOOL_CACHE_DIR, bin, version, runtime.GOOS+"_"+runtime.GOARCH)
+}
+
+// toolKey is the key of the checksum of version for this machine in
+// toolSource.Sha256.
+func toolKey(version string) string {
+	return version + "/" + runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// toolExe is the file name of the program bin on this machine.
+func toolExe(bin string) string {
+	if runtime.GOOS == "windows" {
+		return bin + ".exe"
+	}
+	return bin
+}
+
+// cachedTool returns the folder of the cached program of req, "" if it is no
+// pinned program or not cached.
+func cachedTool(scriptDp, req string) string {
+	bin, version := splitPin(req)
+	if version == "" {
+		return ""
+	}
+	dp := toolDir(scriptDp, bin, version)
+	if fi, err := os.Stat(filepath.Join(dp, toolExe(bin))); err != nil || fi.IsDir() {
+		return ""
+	}
+	return dp
+}
+
+// provideTools returns the folders of the pinned programs of cmd to put in
+// front of PATH. With fetch, the ones with a source in tools of the config
+// which are not cached yet are downloaded first.
+func provideTools(scriptDp string, cmd *jsonCmd, fetch bool) ([]string, error) {
+	var dirs []string
+	for _, req := range cmd.Meta.RequiresBin {
+		bin, version := splitPin(req)
+		if version == "" {
+			continue
+		}
+		if dp := cachedTool(scriptDp, req); dp != "" {
+			dirs = append(dirs, dp)
+			continue
+		}
+		if !fetch {
+			continue
+		}
+		conf, err := loadConfig(scriptDp)
+		if err != nil {
+			return nil, err
+		}
+		src, ok := conf.Tools[bin]
+		if !ok {
+			continue // whatever is in PATH has to do
+		}
+		if err := fetchTool(scriptDp, bin, version, src); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, toolDir(scriptDp, bin, version))
+	}
+	return dirs, nil
+}
+
+// toolPathEnv returns PATH with dirs in front, nil without dirs.
+func toolPathEnv(dirs []string) []string {
+	if len(dirs) == 0 {
+		return nil
+	}
+	return []string{"PATH=" + strings.Join(append(dirs, os.Getenv("PATH")), string(os.PathListSeparator))}
+}
+
+// fetchTool downloads the program bin of version from src, verifies its
+// checksum and caches it.
+func fetchTool(scriptDp, bin, version string, src toolSource) error {
+	r := strings.NewReplacer("{version}", version, "{os}", runtime.GOOS, "{arch}", runtime.GOARCH)
+	rawUrl := r.Replace(src.Url)
+	key := toolKey(version)
+	if offline {
+		return fmt.Errorf(tr("%s %s is not in the tool cache, it cannot be downloaded offline.\n"), bin, version)
+	}
+	fmt.Fprintf(os.Stderr, tr("run: downloading %s %s from %s\n"), bin, version, rawUrl)
+	raw, err := downloadMax(rawUrl, MAX_TOOL_DOWNLOAD)
+	if err != nil {
+		return err
+	}
+	sum := checksum(raw)
+	if want := src.Sha256[key]; want == "" {
+		return fmt.Errorf(tr("%s has no checksum for %s. If %s is the expected download, add\n\t%q: %q\nto tools.%s.sha256 in %s.\n"), bin, key, rawUrl, key, sum, bin, configFp(scriptDp))
+	} else if !strings.EqualFold(sum, want) {
+		return fmt.Errorf(tr("The checksum of %s does not match, expected %s, got %s. It was not cached.\n"), rawUrl, want, sum)
+	}
+
+	exe, err := extractTool(rawUrl, raw, toolExe(bin))
+	if err != nil {
+		return err
+	}
+	dp := toolDir(scriptDp, bin, version)
+	if err := os.MkdirAll(dp, 0750); err != nil {
+		return err
+	}
+	// written aside and renamed, so that a concurrent run never sees half of it
+	tmp, err := os.CreateTemp(dp, ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(exe); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0750); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dp, toolExe(bin)))
+}
+
+// extractTool returns the program exe of the download of rawUrl: the file of
+// that name in a zip or gzipped tar archive, else the download itself.
+func extractTool(rawUrl string, raw []byte, exe string) ([]byte, error) {
+	name := strings.ToLower(path.Base(strings.SplitN(rawUrl, "?", 2)[0]))
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if path.Base(f.Name) != exe || f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		tarR := tar.NewReader(gz)
+		for {
+			hdr, err := tarR.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == exe {
+				return io.ReadAll(tarR)
+			}
+		}
+	default:
+		return raw, nil
+	}
+	return nil, fmt.Errorf(tr("%s does not contain %s.\n"), rawUrl, exe)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// traceStart is the start of run with --trace, else zero and tracing is off.
+var traceStart time.Time
+
+// trace prints a phase of run with the time since its start to stderr, f. e.
+// to find out why run is slow on a network home folder.
+func trace(format string, a ...interface{}) {
+	if traceStart.IsZero() {
+		return
+	}
+	elapsed := float64(time.Since(traceStart).Microseconds()) / 1000
+	fmt.Fprintf(os.Stderr, "[trace %9.3fms] %s\n", elapsed, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+// applyUmask is a no-op, Windows and Plan 9 have no umask.
+func applyUmask(umask string) (restore func(), err error) {
+	return func() {}, nil
+}
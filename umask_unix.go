@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import "syscall"
+
+// applyUmask sets the umask of run, which the script inherits when it is
+// started. restore sets the previous one again.
+func applyUmask(umask string) (restore func(), err error) {
+	if umask == "" {
+		return func() {}, nil
+	}
+	mask, err := parseUmask(umask)
+	if err != nil {
+		return nil, err
+	}
+	old := syscall.Umask(mask)
+	return func() { syscall.Umask(old) }, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const USAGE_UNINSTALL = "Usage:\n\trun -uninstall [--all] [--yes]\n\nRemoves the run executable and what run generated in ~/.run: the cache, the\nhistory, the hints and the locks. Your scripts, the index, the config, the\naudit log, the backups and the trash are kept, unless --all removes the whole\n~/.run. --yes skips the confirmation, which is required without a terminal.\n"
+
+// generatedFiles are the files and folders of ~/.run which run creates by
+// itself and which hold nothing the user wrote.
+var generatedFiles = []string{
+	CACHE_DIR, LOCK_DIR, HINTS_FILE, HISTORY_FILE, HISTORY_PRUNED_FILE, "What_is_this.txt",
+}
+
+// UninstallCmd removes run. run never edits shell rc files or schedulers, thus
+// on unix the executable and ~/.run are all there is. On Windows, setup.bat
+// also created an install folder and added it to the PATH of the machine;
+// both are reported, a running run.exe cannot delete its folder and editing
+// the PATH of the machine takes an administrator.
+func UninstallCmd(scriptDp string, args []string) error {
+	fs := newFlagSet("-uninstall")
+	all := fs.Bool("all", false, "")
+	yes := fs.Bool("yes", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_UNINSTALL))
+	}
+	runDp := baseDir(scriptDp)
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	var remove []string
+	if *all {
+		remove = []string{runDp}
+	} else {
+		for _, name := range generatedFiles {
+			if _, err := os.Lstat(filepath.Join(runDp, name)); err == nil {
+				remove = append(remove, filepath.Join(runDp, name))
+			}
+		}
+	}
+	remove = append(remove, exe)
+
+	fmt.Println(tr("This removes:"))
+	for _, fp := range remove {
+		fmt.Println("  " + fp)
+	}
+	if !*yes && !confirm(tr("Uninstall run?")) {
+		if !isTerminal() {
+			return fmt.Errorf(tr("Pass --yes to uninstall without a terminal.\n"))
+		}
+		return fmt.Errorf(tr("Nothing was removed.\n"))
+	}
+
+	installDp := setupInstallDir()
+	var failed []string
+	for _, fp := range remove {
+		var err error
+		if fp == exe && runtime.GOOS == "windows" {
+			// Windows cannot delete a running executable
+			err = fmt.Errorf(tr("it is running"))
+			if installDp != "" && strings.EqualFold(filepath.Dir(exe), installDp) {
+				fp = installDp
+			}
+		} else {
+			err = os.RemoveAll(fp)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", fp, err))
+		}
+	}
+	if installDp != "" && inPathList(installDp) {
+		failed = append(failed, fmt.Sprintf(tr("%s in the PATH of the machine, setup.bat added it: remove it in the environment variables of the system settings"), installDp))
+	}
+
+	if !*all {
+		entries, err := os.ReadDir(runDp)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var kept []string
+		for _, e := range entries {
+			kept = append(kept, filepath.Join(runDp, e.Name()))
+		}
+		sort.Strings(kept)
+		if len(kept) > 0 {
+			fmt.Println(tr("Kept, remove it yourself or run -uninstall --all:"))
+			for _, fp := range kept {
+				fmt.Println("  " + fp)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		if runtime.GOOS == "windows" {
+			fmt.Println(tr("Remove these yourself, f. e. as administrator:"))
+		} else {
+			fmt.Println(tr("Remove these yourself, f. e. with sudo:"))
+		}
+		for _, f := range failed {
+			fmt.Println("  " + f)
+		}
+		return &SilentExit{Code: 1}
+	}
+	fmt.Println(tr("run is uninstalled."))
+	return nil
+}
+
+// setupInstallDir returns the folder setup.bat installs run.exe into, "" on
+// other systems.
+func setupInstallDir() string {
+	pf := os.Getenv("ProgramFiles")
+	if runtime.GOOS != "windows" || pf == "" {
+		return ""
+	}
+	return filepath.Join(pf, "Liamvdv", "Run")
+}
+
+// inPathList reports whether dp is a folder of PATH.
+func inPathList(dp string) bool {
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if strings.EqualFold(filepath.Clean(dir), dp) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const USAGE_VARIANT = "Usage:\n\trun -variant <cmd> <suffix> [--args \"<args>\"] [--env KEY=VALUE ...]\n\nRegisters <cmd>-<suffix>, which runs the script of <cmd> with the arguments\nin front of the given ones and the environment variables, f. e.\n\trun -variant deploy prod --args \"--target prod\"\n"
+
+// VariantCmd registers a variant of a command: a command sharing its script
+// and options, but with default arguments and further environment variables,
+// f. e. deploy-prod and deploy-stg of deploy.
+func VariantCmd(indexFp string, args []string) error {
+	if len(args) < 2 || strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[1], "-") {
+		return fmt.Errorf(tr(USAGE_VARIANT))
+	}
+	baseName, suffix := args[0], args[1]
+	fs := newFlagSet("-variant")
+	defaultArgs := fs.String("args", "", "")
+	var env stringList
+	fs.Var(&env, "env", "")
+	if err := fs.Parse(args[2:]); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_VARIANT))
+	}
+	split, err := splitArgs(*defaultArgs)
+	if err != nil {
+		return err
+	}
+
+	var base jsonCmd
+	if err := Find(indexFp, baseName, &base); err != nil {
+		return err
+	}
+	variant := base
+	variant.Name = baseName + "-" + suffix
+	if err := checkName(variant.Name); err != nil {
+		return err
+	}
+	switch err := Find(indexFp, variant.Name, &jsonCmd{}); {
+	case err == nil:
+		return fmt.Errorf(tr("%s is registered already.\n"), variant.Name)
+	case !errors.Is(err, CmdNotFoundErr):
+		return err
+	}
+
+	m := &variant.Meta
+	// a variant of a variant is one of the same base
+	if m.VariantOf == "" {
+		m.VariantOf = baseName
+	}
+	m.DefaultArgs = append(append([]string(nil), base.Meta.DefaultArgs...), split...)
+	m.Env = append([]string(nil), base.Meta.Env...)
+	for _, kv := range env {
+		m.Env = setEnv(m.Env, kv)
+	}
+	// the limits count the arguments given on the command line
+	m.MinNumArgs -= len(split)
+	if m.MinNumArgs < 0 {
+		m.MinNumArgs = 0
+	}
+	if m.MaxNumArgs != -1 {
+		if m.MaxNumArgs -= len(split); m.MaxNumArgs < 0 {
+			return fmt.Errorf(tr("%s takes at most %d argument(s), %d are too many.\n"), baseName, base.Meta.MaxNumArgs, len(split))
+		}
+	}
+	m.Args = nil // names of positional arguments no longer fit
+	m.Pinned = false
+	return insertIntoIndex(indexFp, &variant)
+}
+
+// splitArgs splits s into arguments like a shell: at spaces, except within
+// single or double quotes, and a backslash escapes the next character.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf(tr("Unterminated quote or escape in %q.\n"), s)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const USAGE_VERIFY_ALL = "Usage:\n\trun -verify-all [--fetch]\n\nChecks whether every command can run on this machine, without running it: its\nscript, the interpreter of its shebang, the programs it requires, the pinned\nprograms of the tool cache and its working directory, input file, validation\nscript and decryption. Prints a matrix with a line per problem below and exits\nwith 1 if a command is not ready. --fetch downloads the pinned programs which\nare not cached yet, f. e. before the machine goes offline.\n"
+
+// Columns of -verify-all.
+var verifyChecks = []string{"Script", "Interpreter", "Programs", "Tools", "Setup"}
+
+// readiness is the result of -verify-all for a command: a problem list by
+// check, nil if the check does not apply.
+type readiness struct {
+	name     string
+	skipped  string // why the command does not run on this machine at all
+	problems map[string][]string
+}
+
+func (r *readiness) ready() bool {
+	for _, problems := range r.problems {
+		if len(problems) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyAllCmd is the pre-flight check after syncing the registry onto a new
+// machine. Unlike -doctor, which watches the registry, it asks what this
+// machine lacks.
+func VerifyAllCmd(scriptDp, indexFp string, args []string) error {
+	fs := newFlagSet("-verify-all")
+	fetch := fs.Bool("fetch", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf(tr(USAGE_VERIFY_ALL))
+	}
+	conf, err := loadConfig(scriptDp)
+	if err != nil {
+		return err
+	}
+	var results []readiness
+	var check findFn = func(cmd *jsonCmd) (esc bool, err error) {
+		results = append(results, verifyCmd(scriptDp, conf, cmd, *fetch))
+		return
+	}
+	if err := findOperation(indexFp, check); err != nil {
+		return err
+	}
+
+	width := len(tr("Command"))
+	for _, r := range results {
+		if len(r.name) > width {
+			width = len(r.name)
+		}
+	}
+	fmt.Printf("%-*s", width, tr("Command"))
+	for _, c := range verifyChecks {
+		fmt.Printf("  %-11s", tr(c))
+	}
+	fmt.Println(tr("Ready"))
+	ready, skipped := 0, 0
+	var details []string
+	for _, r := range results {
+		fmt.Printf("%-*s", width, r.name)
+		for _, c := range verifyChecks {
+			cell := "-"
+			switch problems, ok := r.problems[c]; {
+			case r.skipped != "" || !ok:
+			case len(problems) == 0:
+				cell = tr("ok")
+			default:
+				cell = tr("FAIL")
+				for _, p := range problems {
+					details = append(details, r.name+": "+p)
+				}
+			}
+			fmt.Printf("  %-11s", cell)
+		}
+		switch {
+		case r.skipped != "":
+			skipped++
+			fmt.Println(tr("skipped"))
+			details = append(details, fmt.Sprintf(tr("%s: skipped, it is %s"), r.name, r.skipped))
+		case r.ready():
+			ready++
+			fmt.Println(tr("yes"))
+		default:
+			fmt.Println(tr("no"))
+		}
+	}
+	if len(details) > 0 {
+		fmt.Println()
+		for _, d := range details {
+			fmt.Println(d)
+		}
+	}
+	fmt.Printf(tr("\n%d of %d commands ready, %d skipped.\n"), ready, len(results)-skipped, skipped)
+	if ready+skipped < len(results) {
+		return &SilentExit{Code: 1}
+	}
+	return nil
+}
+
+// verifyCmd checks what cmd needs of this machine.
+func verifyCmd(scriptDp string, conf *config, cmd *jsonCmd, fetch bool) readiness {
+	r := readiness{name: cmd.Name, problems: make(map[string][]string)}
+	if r.skipped = unavailable(cmd); r.skipped != "" {
+		return r
+	}
+	m := &cmd.Meta
+	script := cmd.ScriptPath()
+	encrypted, _ := isEncrypted(script)
+
+	var problems []string
+	fi, err := os.Stat(script)
+	switch {
+	case isBrokenLink(script):
+		problems = append(problems, fmt.Sprintf(tr("script %s is a broken symlink to %s"), script, linkTarget(script)))
+	case err != nil:
+		problems = append(problems, fmt.Sprintf(tr("script %s does not exist"), script))
+	case fi.IsDir():
+		problems = append(problems, fmt.Sprintf(tr("script %s is a folder"), script))
+	case runtime.GOOS != "windows" && !encrypted && !isGoScript(script) && fi.Mode().Perm()&0o111 == 0:
+		problems = append(problems, fmt.Sprintf(tr("script %s is not executable"), script))
+	}
+	r.problems["Script"] = problems
+
+	if len(problems) == 0 && !encrypted {
+		if interp, err := verifyInterpreter(scriptDp, script); interp != "" {
+			r.problems["Interpreter"] = nil
+			if err != nil {
+				r.problems["Interpreter"] = []string{err.Error()}
+			}
+		}
+	}
+
+	if len(m.RequiresBin) > 0 {
+		problems = nil
+		if missing := missingBins(scriptDp, cmd); len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf(tr("requires %s, not found in PATH"), strings.Join(missing, ", ")))
+		}
+		r.problems["Programs"] = problems
+	}
+
+	problems = nil
+	tools := false
+	for _, req := range m.RequiresBin {
+		bin, version := splitPin(req)
+		src, ok := conf.Tools[bin]
+		if version == "" || !ok {
+			continue // checked as program in PATH
+		}
+		tools = true
+		switch {
+		case cachedTool(scriptDp, req) != "":
+		case src.Sha256[toolKey(version)] == "":
+			problems = append(problems, fmt.Sprintf(tr("%s has no checksum for %s in tools of the config"), bin, toolKey(version)))
+		case fetch:
+			if err := fetchTool(scriptDp, bin, version, src); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", req, strings.TrimSpace(err.Error())))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf(tr("%s is not in the tool cache, -verify-all --fetch downloads it"), req))
+		}
+	}
+	if tools {
+		r.problems["Tools"] = problems
+	}
+
+	problems = nil
+	setup := false
+	if m.Workdir != "" {
+		setup = true
+		if fi, err := os.Stat(m.Workdir); err != nil || !fi.IsDir() {
+			problems = append(problems, fmt.Sprintf(tr("working directory %s does not exist"), m.Workdir))
+		}
+	}
+	for _, fp := range []string{m.StdinFile, m.Validate} {
+		if fp == "" {
+			continue
+		}
+		setup = true
+		if _, err := os.Stat(fp); err != nil {
+			problems = append(problems, fmt.Sprintf(tr("%s does not exist"), fp))
+		}
+	}
+	for _, dir := range m.PathPrepend {
+		setup = true
+		// relative folders depend on where the command is run
+		if fp, err := expandHome(dir); err == nil && filepath.IsAbs(fp) {
+			if fi, err := os.Stat(fp); err != nil || !fi.IsDir() {
+				problems = append(problems, fmt.Sprintf(tr("folder %s of pathPrepend does not exist"), dir))
+			}
+		}
+	}
+	if encrypted {
+		setup = true
+		if _, err := exec.LookPath("age"); err != nil {
+			problems = append(problems, tr("the script is encrypted, but age is not in PATH"))
+		}
+	}
+	if setup {
+		r.problems["Setup"] = problems
+	}
+	return r
+}
+
+// verifyInterpreter returns the program script is run with, "" if it is
+// executed itself, and an error if this machine lacks it.
+func verifyInterpreter(scriptDp, script string) (string, error) {
+	if isGoScript(script) {
+		binFp, err := compiledPath(scriptDp, script, filepath.Dir(script))
+		if err != nil {
+			return "go", err
+		}
+		if _, err := os.Stat(binFp); err == nil {
+			return "go", nil
+		}
+		if _, err := exec.LookPath("go"); err != nil {
+			return "go", fmt.Errorf(tr("%s is not compiled yet and go is not in PATH"), script)
+		}
+		return "go", nil
+	}
+	// Windows and Termux put the interpreter in front of the script
+	if line := interpreterCmd(script, nil); len(line) > 1 {
+		if _, err := exec.LookPath(line[0]); err != nil {
+			return line[0], fmt.Errorf(tr("interpreter %s not found"), line[0])
+		}
+		return line[0], nil
+	}
+	fields := shebang(script)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	if runtime.GOOS == "windows" {
+		return "bash", fmt.Errorf(tr("the script has a shebang, but there is no bash of Git for Windows"))
+	}
+	interp := fields[0]
+	if filepath.Base(interp) == "env" {
+		// #!/usr/bin/env -S bash -e or #!/usr/bin/env FOO=1 python3
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				if _, err := exec.LookPath(f); err != nil {
+					return f, fmt.Errorf(tr("interpreter %s not found in PATH"), f)
+				}
+				return f, nil
+			}
+		}
+	}
+	if _, err := exec.LookPath(interp); err != nil {
+		return interp, fmt.Errorf(tr("interpreter %s not found"), interp)
+	}
+	return interp, nil
+}
+
+// shebang returns the fields of the shebang of script, nil without.
+func shebang(script string) []string {
+	file, err := os.Open(script)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	line, _ := bufio.NewReader(file).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return nil
+	}
+	return strings.Fields(line[2:])
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// WSL_BRIDGE_ENV marks a run started through the bridge of wslCommand, which
+// does not bridge back, or a name unknown on both sides would ping-pong.
+const WSL_BRIDGE_ENV = "RUN_WSL_BRIDGE"
+
+// isWSL reports whether run runs in the Windows Subsystem for Linux.
+func isWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	_, err := os.Stat("/proc/sys/fs/binfmt_misc/WSLInterop")
+	return err == nil
+}
+
+// wslCommand returns the command running name with args on the other side of
+// WSL, nil if there is none. In WSL, a command of the registry of the Windows
+// user is run by run.exe on Windows. It is started directly, not through
+// cmd.exe, which would interpret & and | in the arguments. On Windows, run in
+// WSL is asked through wsl.exe; its registry is not readable from Windows,
+// thus it reports the command if it does not know it either. Arguments which
+// are absolute paths are translated.
+func wslCommand(name string, args []string) (*jsonCmd, []string, error) {
+	var bridge []string
+	var translate func(string) string
+	workdir := ""
+	switch {
+	case isWSL():
+		winHome, err := windowsHome()
+		if err != nil {
+			trace("WSL interop: %s", err)
+			return nil, nil, nil
+		}
+		indexFp := filepath.Join(winHome, BASE_DIR, SCRIPT_DIR, WINDOWS.String(), INDEX_FILE)
+		if err := Find(indexFp, name, &jsonCmd{}); err != nil {
+			trace("WSL interop: %s is not in %s: %s", name, indexFp, err)
+			return nil, nil, nil
+		}
+		runExe, err := exec.LookPath("run.exe")
+		if err != nil {
+			trace("WSL interop: run.exe is not in PATH: %s", err)
+			return nil, nil, nil
+		}
+		bridge, translate = []string{runExe}, wslToWindows
+		// batch scripts cannot start in a folder of the Linux file system
+		if wd, err := os.Getwd(); err != nil || !strings.HasPrefix(wd, "/mnt/") {
+			workdir = winHome
+		}
+	case runtime.GOOS == "windows":
+		wslExe, err := exec.LookPath("wsl.exe")
+		if err != nil {
+			return nil, nil, nil
+		}
+		bridge, translate = []string{wslExe, "-e", "run"}, windowsToWsl
+	default:
+		return nil, nil, nil
+	}
+	trace("WSL interop: running %s through %s", name, bridge[0])
+
+	line := append(bridge, name)
+	for _, arg := range args {
+		line = append(line, translate(arg))
+	}
+	wslEnv := WSL_BRIDGE_ENV
+	if prev := os.Getenv("WSLENV"); prev != "" {
+		wslEnv = prev + ":" + wslEnv
+	}
+	cmd := jsonCmd{Name: name, Script: bridge[0], Meta: meta{
+		MaxNumArgs: -1,
+		Env:        []string{WSL_BRIDGE_ENV + "=1", "WSLENV=" + wslEnv},
+		Workdir:    workdir,
+	}}
+	return &cmd, line, nil
+}
+
+// windowsHome returns the home folder of the Windows user as path of WSL.
+func windowsHome() (string, error) {
+	echo := exec.Command("cmd.exe", "/c", "echo", "%USERPROFILE%")
+	echo.Dir = "/mnt/c" // avoids the warning about UNC paths
+	out, err := echo.Output()
+	if err != nil {
+		return "", err
+	}
+	home := strings.TrimSpace(string(out))
+	if home == "" || strings.Contains(home, "%") {
+		return "", errors.New("%USERPROFILE% is not defined")
+	}
+	return windowsToWsl(home), nil
+}
+
+var (
+	wslDrivePath     = regexp.MustCompile(`^/mnt/([a-zA-Z])(/.*)?$`)
+	windowsDrivePath = regexp.MustCompile(`^([a-zA-Z]):[\\/](.*)$`)
+)
+
+// wslToWindows translates /mnt/c/Users to C:\Users, other arguments are
+// returned as they are.
+func wslToWindows(arg string) string {
+	m := wslDrivePath.FindStringSubmatch(arg)
+	if m == nil {
+		return arg
+	}
+	return strings.ToUpper(m[1]) + `:\` + strings.ReplaceAll(strings.TrimPrefix(m[2], "/"), "/", `\`)
+}
+
+// windowsToWsl translates C:\Users to /mnt/c/Users, other arguments are
+// returned as they are.
+func windowsToWsl(arg string) string {
+	m := windowsDrivePath.FindStringSubmatch(arg)
+	if m == nil {
+		return arg
+	}
+	return "/mnt/" + strings.ToLower(m[1]) + "/" + strings.ReplaceAll(m[2], `\`, "/")
+}